@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
 	"net/http"
@@ -10,37 +11,57 @@ import (
 	"time"
 
 	"example.com/temporal-go/internal/builder"
+	"example.com/temporal-go/internal/config"
 	"example.com/temporal-go/internal/logging"
 	"example.com/temporal-go/internal/sqliteutil"
 )
 
 func main() {
-	var (
-		dbPath = flag.String("db", "builder.db", "path to the builder sqlite database file")
-		addr   = flag.String("addr", ":8081", "HTTP listen address for the builder API")
-	)
-	flag.Parse()
-
 	ctx := context.Background()
 	logger := logging.New()
 
-	db, err := sqliteutil.Open(*dbPath)
+	cfg, err := config.LoadBuilder(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(2)
+	}
+
+	db, err := sqliteutil.Open(cfg.DBPath)
 	if err != nil {
 		logger.Error("open builder db failed", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	store := builder.NewStore(db)
+	seeder := builder.SeederConfig{Amounts: cfg.SeedAmounts, Signups: cfg.SeedSignups, Seed: cfg.Seed}
+	if cfg.SeedPools != "" {
+		pools, err := builder.LoadSeederPools(cfg.SeedPools)
+		if err != nil {
+			logger.Error("load seeder pools failed", "path", cfg.SeedPools, "error", err)
+			os.Exit(1)
+		}
+		seeder.Pools = pools
+	}
+	store := builder.NewStore(db, builder.WithSeederConfig(seeder))
 	if err := store.Init(ctx); err != nil {
 		logger.Error("init builder schema failed", "error", err)
 		os.Exit(1)
 	}
 
 	serverLogger := logger.With("component", "builder.http")
+	if cfg.DevMode {
+		serverLogger.Warn("dev mode enabled: test-only request hooks are active")
+	}
+	requestedPageSize := cfg.MaxPageSize
+	cfg.MaxPageSize = builder.ClampMaxPageSize(requestedPageSize)
+	builderServer := builder.NewServer(store, serverLogger, builder.WithAdminToken(cfg.AdminToken), builder.WithConfig(cfg), builder.WithDevMode(cfg.DevMode), builder.WithMaxPageSize(cfg.MaxPageSize))
+	logger.Info("max page size", "requested", requestedPageSize, "effective", builderServer.MaxPageSize())
 	server := &http.Server{
-		Addr:    *addr,
-		Handler: builder.NewServer(store, serverLogger).Router(),
+		Addr:    cfg.Addr,
+		Handler: builderServer.Router(),
 	}
 
 	// The builder service is a long running HTTP server; add a short comment describing the workflow for clarity.
@@ -49,25 +70,26 @@ func main() {
 	// 3. Serve paginated data to the worker so sync jobs can exercise pagination logic.
 
 	go func() {
-		serverLogger.Info("builder API listening", "addr", *addr, "db", *dbPath)
+		serverLogger.Info("builder API listening", "addr", cfg.Addr, "db", cfg.DBPath)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			serverLogger.Error("builder server error", "error", err)
 		}
 	}()
 
-	waitForShutdown(serverLogger, server)
+	waitForShutdown(serverLogger, server, cfg.ShutdownTimeout)
 }
 
-func waitForShutdown(logger *slog.Logger, server *http.Server) {
+func waitForShutdown(logger *slog.Logger, server *http.Server, timeout time.Duration) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	<-sigCh
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Error("graceful shutdown failed", "error", err)
+		logger.Error("graceful shutdown deadline hit; force closing connections", "timeout", timeout, "error", err)
+		_ = server.Close()
 		return
 	}
 	logger.Info("builder server stopped")
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
 	"net/http"
@@ -10,90 +11,146 @@ import (
 	"time"
 
 	"go.temporal.io/sdk/client"
-	temporalworker "go.temporal.io/sdk/worker"
 
+	"example.com/temporal-go/internal/config"
 	"example.com/temporal-go/internal/logging"
+	"example.com/temporal-go/internal/metrics"
 	"example.com/temporal-go/internal/sqliteutil"
 	workersvc "example.com/temporal-go/internal/worker"
 )
 
 func main() {
-	var (
-		dbPath          = flag.String("db", "events.db", "path to the worker sqlite database file")
-		addr            = flag.String("addr", ":8082", "HTTP listen address for the worker API")
-		temporalAddress = flag.String("temporal", os.Getenv("TEMPORAL_ADDRESS"), "Temporal service address")
-	)
-	flag.Parse()
-
 	baseLogger := logging.New()
 	logger := baseLogger.With("component", "worker.bootstrap")
 
-	db, err := sqliteutil.Open(*dbPath)
+	cfg, err := config.LoadWorker(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(2)
+	}
+
+	db, err := sqliteutil.Open(cfg.DBPath)
 	if err != nil {
 		logger.Error("open worker db failed", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	store := workersvc.NewStore(db)
+	storeOpts := []workersvc.StoreOption{workersvc.WithMaxPropertiesBytes(cfg.MaxPropertiesBytes), workersvc.WithDedupeScope(cfg.DedupeScope)}
+	if cfg.CaseInsensitiveSiteIDs {
+		storeOpts = append(storeOpts, workersvc.WithCaseInsensitiveSiteIDs())
+	}
+	store := workersvc.NewStore(db, storeOpts...)
 	if err := store.Init(context.Background()); err != nil {
 		logger.Error("init worker schema failed", "error", err)
 		os.Exit(1)
 	}
 
-	builderClient := workersvc.NewBuilderClient()
+	metricsRegistry := metrics.NewRegistry()
+	builderClient := workersvc.NewBuilderClient(
+		workersvc.WithClientMetrics(metricsRegistry),
+		workersvc.WithCircuitBreaker(cfg.BreakerFailures, cfg.BreakerCooldown),
+		workersvc.WithRedirectPolicy(cfg.BuilderRedirectPolicy),
+	)
 
-	temporalHostPort := *temporalAddress
-	if temporalHostPort == "" {
-		temporalHostPort = client.DefaultHostPort
-	}
-	temporalClient, err := client.NewClient(client.Options{HostPort: temporalHostPort})
+	temporalHostPort := cfg.TemporalAddress
+	temporalClient, err := client.NewClient(client.Options{HostPort: temporalHostPort, Namespace: cfg.TemporalNamespace})
 	if err != nil {
 		logger.Error("connect temporal failed", "host", temporalHostPort, "error", err)
 		os.Exit(1)
 	}
 
 	serverLogger := baseLogger.With("component", "worker.http")
-	orchestrator := workersvc.NewTemporalOrchestrator(temporalClient, baseLogger)
-	workerServer := workersvc.NewServer(store, builderClient, orchestrator, serverLogger)
+	orchestrator := workersvc.NewTemporalOrchestrator(temporalClient, baseLogger, workersvc.WithSyncRunStore(store))
+	serverOpts := []workersvc.ServerOption{workersvc.WithMetrics(metricsRegistry), workersvc.WithSyncPageConcurrency(cfg.SyncPageConcurrency), workersvc.WithBuilderPageSize(cfg.BuilderPageSize), workersvc.WithAdminToken(cfg.AdminToken), workersvc.WithSkipLogSample(cfg.SkipLogSample), workersvc.WithSuppressedAttribution(workersvc.ParseEventNames(cfg.SuppressAttribution)), workersvc.WithAttributionModel(cfg.AttributionModel)}
+	if cfg.ExchangeRates != "" {
+		// Already validated by config.LoadWorker.
+		rates, _ := workersvc.ParseExchangeRates(cfg.ExchangeRates)
+		serverOpts = append(serverOpts, workersvc.WithExchangeRates(rates))
+		logger.Info("exchange rates loaded", "currencies", len(rates))
+	}
+	if cfg.EventSinkURL != "" {
+		serverOpts = append(serverOpts, workersvc.WithEventSink(workersvc.NewHTTPEventSink(cfg.EventSinkURL, cfg.EventSinkRetries)))
+		logger.Info("event sink enabled", "url", cfg.EventSinkURL, "retries", cfg.EventSinkRetries)
+	}
+	requestedConcurrency := cfg.SyncPageConcurrency
+	cfg.SyncPageConcurrency = workersvc.ClampSyncPageConcurrency(requestedConcurrency)
+	cfg.BuilderPageSize = workersvc.ClampBuilderPageSize(cfg.BuilderPageSize)
+	serverOpts = append(serverOpts, workersvc.WithConfig(cfg))
+	workerServer := workersvc.NewServer(store, builderClient, orchestrator, serverLogger, serverOpts...)
+	logger.Info("sync page concurrency", "requested", requestedConcurrency, "effective", workerServer.SyncPageConcurrency())
 	server := &http.Server{
-		Addr:    *addr,
+		Addr:    cfg.Addr,
 		Handler: workerServer.Router(),
 	}
 
-	syncWorker := workersvc.RegisterSyncWorker(temporalClient, workerServer, baseLogger)
+	var syncWorkerOpts []workersvc.SyncWorkerOption
+	if cfg.TemporalMetrics {
+		syncWorkerOpts = append(syncWorkerOpts, workersvc.WithTemporalMetrics(metricsRegistry))
+	}
+	syncWorker := workersvc.RegisterSyncWorker(temporalClient, workerServer, baseLogger, syncWorkerOpts...)
 
 	appCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	workerServer.StartAutoSync(appCtx, 10*time.Minute)
+	if cfg.AutoSyncMode == workersvc.AutoSyncModeCron {
+		workerServer.StartAutoSyncCron(appCtx, cfg.AutoSyncCron)
+	} else {
+		workerServer.StartAutoSync(appCtx, cfg.AutoSyncInterval, cfg.AutoSyncDelay, cfg.AutoSyncJitter)
+	}
+	workerServer.StartRetentionPurge(appCtx, cfg.EventRetention, cfg.RetentionInterval)
+	workerServer.StartEventCompaction(appCtx, cfg.CompactWindow, cfg.CompactInterval, cfg.CompactDryRun)
+	workerServer.StartWatermarkStalenessCheck(appCtx, cfg.WatermarkStaleAfter, cfg.WatermarkCheckInterval)
 
 	go func() {
-		serverLogger.Info("worker API listening", "addr", *addr, "db", *dbPath, "temporal", temporalHostPort)
+		serverLogger.Info("worker API listening", "addr", cfg.Addr, "db", cfg.DBPath, "temporal", temporalHostPort)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			serverLogger.Error("worker server error", "error", err)
 		}
 	}()
 
+	stopSyncWorker := make(chan interface{})
+	syncWorkerDone := make(chan struct{})
 	go func() {
+		defer close(syncWorkerDone)
 		logger.Info("temporal sync worker starting", "task_queue", workersvc.SyncTaskQueue())
-		if err := syncWorker.Run(temporalworker.InterruptCh()); err != nil {
+		if err := syncWorker.Run(stopSyncWorker); err != nil {
 			logger.Error("temporal sync worker stopped", "error", err)
 		}
 	}()
 
-	waitForShutdown(appCtx, server, temporalClient, baseLogger)
+	waitForShutdown(appCtx, server, workerServer, stopSyncWorker, syncWorkerDone, temporalClient, cfg.ShutdownTimeout, baseLogger)
 }
 
-func waitForShutdown(ctx context.Context, server *http.Server, temporalClient client.Client, logger *slog.Logger) {
+// waitForShutdown blocks until ctx is cancelled, then drains the HTTP server, the Temporal worker,
+// and the background loops within a single deadline. Anything still running when the deadline
+// passes is abandoned and logged.
+func waitForShutdown(ctx context.Context, server *http.Server, workerServer *workersvc.Server, stopSyncWorker chan interface{}, syncWorkerDone <-chan struct{}, temporalClient client.Client, timeout time.Duration, logger *slog.Logger) {
 	<-ctx.Done()
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	logger.Info("worker shutting down", "timeout", timeout)
 
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.Error("graceful shutdown failed", "error", err)
+		logger.Error("graceful shutdown deadline hit; force closing connections", "error", err)
+		_ = server.Close()
 	} else {
 		logger.Info("worker server stopped")
 	}
+
+	close(stopSyncWorker)
+	select {
+	case <-syncWorkerDone:
+		logger.Info("temporal sync worker drained")
+	case <-shutdownCtx.Done():
+		logger.Error("temporal sync worker did not drain before shutdown deadline")
+	}
+
+	if err := workerServer.WaitBackground(shutdownCtx); err != nil {
+		logger.Error("background loops did not stop before shutdown deadline", "error", err)
+	}
 	temporalClient.Close()
 }
@@ -0,0 +1,28 @@
+package builder
+
+import "time"
+
+// Config is the resolved startup configuration of the builder binary. config.LoadBuilder builds
+// it from flags and environment, and WithConfig exposes it at /builder/config. Durations are reported in
+// nanoseconds.
+type Config struct {
+	DBPath          string        `json:"db_path"`
+	Addr            string        `json:"addr"`
+	AdminToken      string        `json:"admin_token"`
+	SeedAmounts     string        `json:"seed_amounts"`
+	SeedSignups     string        `json:"seed_signups"`
+	SeedPools       string        `json:"seed_pools"`
+	Seed            int64         `json:"seed"`
+	DevMode         bool          `json:"dev_mode"`
+	MaxPageSize     int           `json:"max_page_size"`
+	ShutdownTimeout time.Duration `json:"shutdown_timeout_ns"`
+}
+
+// Redacted returns a copy safe to serve. A configured admin token is masked, so callers can still
+// tell whether one is set.
+func (c Config) Redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = "[redacted]"
+	}
+	return c
+}
@@ -0,0 +1,12 @@
+package builder
+
+import "testing"
+
+func TestConfigRedacted(t *testing.T) {
+	if got := (Config{AdminToken: "secret"}).Redacted().AdminToken; got != "[redacted]" {
+		t.Errorf("admin_token = %q, want [redacted]", got)
+	}
+	if got := (Config{}).Redacted().AdminToken; got != "" {
+		t.Errorf("unset admin_token = %q, want empty", got)
+	}
+}
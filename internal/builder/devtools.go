@@ -0,0 +1,44 @@
+package builder
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxInjectedDelay caps ?delay_ms= so a typo cannot park a request for hours.
+const maxInjectedDelay = time.Minute
+
+// WithDevMode enables test-only request hooks such as ?delay_ms=. They are ignored otherwise.
+func WithDevMode(enabled bool) ServerOption {
+	return func(s *Server) {
+		s.devMode = enabled
+	}
+}
+
+// injectDelay sleeps for ?delay_ms= before serving the request when dev mode is on, so worker
+// timeouts can be triggered on demand. The sleep ends early if the client gives up, in which
+// case nothing is written.
+func (s *Server) injectDelay(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.Query().Get("delay_ms")
+		if !s.devMode || raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms < 0 {
+			writeError(w, http.StatusBadRequest, "delay_ms must be a non-negative integer")
+			return
+		}
+		delay := min(time.Duration(ms)*time.Millisecond, maxInjectedDelay)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			next.ServeHTTP(w, r)
+		case <-r.Context().Done():
+			s.logger.Info("injected delay abandoned", "path", r.URL.Path, "delay", delay, "error", r.Context().Err())
+		}
+	})
+}
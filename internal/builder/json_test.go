@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// wrappedWriter stands in for middleware that wraps the response writer after negotiation.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestWriteJSONCompactThroughWrappedWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(wrappedWriter{compactJSONWriter{rec}}, http.StatusOK, map[string]any{"ok": true})
+	if got := rec.Body.String(); got != "{\"ok\":true}\n" {
+		t.Fatalf("compact body = %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	writeJSON(wrappedWriter{rec}, http.StatusOK, map[string]any{"ok": true})
+	if got := rec.Body.String(); got != "{\n  \"ok\": true\n}\n" {
+		t.Fatalf("default body = %q", got)
+	}
+}
@@ -33,24 +33,78 @@ type Order struct {
 
 // UserPage wraps paginated user results returned to the worker.
 type UserPage struct {
-	Users     []User `json:"users"`
-	Page      int    `json:"page"`
-	PageSize  int    `json:"page_size"`
-	Total     int    `json:"total"`
-	HasMore   bool   `json:"has_more"`
-	NextPage  *int   `json:"next_page,omitempty"`
-	StartDate string `json:"start_date,omitempty"`
-	EndDate   string `json:"end_date,omitempty"`
+	Users    []User `json:"users"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int    `json:"total"`
+	HasMore  bool   `json:"has_more"`
+	NextPage *int   `json:"next_page,omitempty"`
+	// NextCursor resumes after the last user; see Store.ListUsersAfter.
+	NextCursor string `json:"next_cursor,omitempty"`
+	StartDate  string `json:"start_date,omitempty"`
+	EndDate    string `json:"end_date,omitempty"`
 }
 
 // OrderPage wraps paginated order results returned to the worker.
 type OrderPage struct {
-	Orders    []Order `json:"orders"`
-	Page      int     `json:"page"`
-	PageSize  int     `json:"page_size"`
-	Total     int     `json:"total"`
-	HasMore   bool    `json:"has_more"`
-	NextPage  *int    `json:"next_page,omitempty"`
-	StartDate string  `json:"start_date,omitempty"`
-	EndDate   string  `json:"end_date,omitempty"`
+	Orders   []Order `json:"orders"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"page_size"`
+	Total    int     `json:"total"`
+	HasMore  bool    `json:"has_more"`
+	NextPage *int    `json:"next_page,omitempty"`
+	// NextCursor resumes after the last order; see Store.ListOrdersAfter.
+	NextCursor string `json:"next_cursor,omitempty"`
+	StartDate  string `json:"start_date,omitempty"`
+	EndDate    string `json:"end_date,omitempty"`
+}
+
+// Activity types in the activity stream.
+const (
+	ActivityTypeSignup = "signup"
+	ActivityTypeOrder  = "order"
+)
+
+// Activity is one row of a site's activity stream: a user's signup or an order, at the time it
+// happened. Exactly one of User or Order is set, matching Type.
+type Activity struct {
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	User  *User     `json:"user,omitempty"`
+	Order *Order    `json:"order,omitempty"`
+}
+
+// ActivityPage wraps a page of the activity stream. Total counts signups and orders together.
+type ActivityPage struct {
+	Activities []Activity `json:"activities"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"page_size"`
+	Total      int        `json:"total"`
+	HasMore    bool       `json:"has_more"`
+	NextPage   *int       `json:"next_page,omitempty"`
+	StartDate  string     `json:"start_date,omitempty"`
+	EndDate    string     `json:"end_date,omitempty"`
+}
+
+// Change types emitted by the changes feed.
+const (
+	ChangeTypeUser  = "user"
+	ChangeTypeOrder = "order"
+)
+
+// Change is a single entry in a site's ordered changes feed. Exactly one of User or Order is set.
+type Change struct {
+	Seq       int64     `json:"seq"`
+	Type      string    `json:"type"`
+	ChangedAt time.Time `json:"changed_at"`
+	User      *User     `json:"user,omitempty"`
+	Order     *Order    `json:"order,omitempty"`
+}
+
+// ChangePage wraps a batch of changes after a given sequence number.
+type ChangePage struct {
+	Changes   []Change `json:"changes"`
+	Since     int64    `json:"since"`
+	NextSince int64    `json:"next_since"`
+	HasMore   bool     `json:"has_more"`
 }
@@ -0,0 +1,124 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Amount distributions for seeded order totals.
+const (
+	AmountsUniform   = "uniform"
+	AmountsLogNormal = "lognormal"
+)
+
+// Signup time distributions for seeded users.
+const (
+	SignupsUniform = "uniform"
+	SignupsRecent  = "recent"
+)
+
+const (
+	// signupWindow is how far back seeded signups may go.
+	signupWindow = 120 * 24 * time.Hour
+	// recentSignupMean is the mean age of a signup under the "recent" distribution.
+	recentSignupMean = 14 * 24 * time.Hour
+
+	minOrderAmount = 1000
+	maxOrderAmount = 2000000
+	// logNormalMedian and logNormalSigma shape the "lognormal" order amounts: most orders sit
+	// near the median with a long tail of large ones.
+	logNormalMedian = 20000
+	logNormalSigma  = 0.9
+)
+
+// SeederConfig controls how random users and orders are generated.
+type SeederConfig struct {
+	Amounts string
+	Signups string
+	// Pools supplies the names and email domains seeded users are drawn from.
+	Pools SeederPools
+	// Seed makes generation reproducible when non-zero; zero seeds from the clock.
+	Seed int64
+}
+
+// SeederPools lists the values seeded user names and emails are picked from. Empty pools fall
+// back to the built-in defaults.
+type SeederPools struct {
+	FirstNames []string `json:"first_names"`
+	LastNames  []string `json:"last_names"`
+	Domains    []string `json:"domains"`
+}
+
+// DefaultSeederConfig keeps the original uniform behaviour.
+func DefaultSeederConfig() SeederConfig {
+	return SeederConfig{
+		Amounts: AmountsUniform,
+		Signups: SignupsUniform,
+		Pools:   SeederPools{FirstNames: firstNames, LastNames: lastNames, Domains: domains},
+	}
+}
+
+// LoadSeederPools reads pools from a JSON file shaped like SeederPools. Omitted pools keep
+// the defaults.
+func LoadSeederPools(path string) (SeederPools, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return SeederPools{}, fmt.Errorf("read seeder pools: %w", err)
+	}
+	var pools SeederPools
+	if err := json.Unmarshal(raw, &pools); err != nil {
+		return SeederPools{}, fmt.Errorf("decode seeder pools: %w", err)
+	}
+	return pools.withDefaults(), nil
+}
+
+func (p SeederPools) withDefaults() SeederPools {
+	if len(p.FirstNames) == 0 {
+		p.FirstNames = firstNames
+	}
+	if len(p.LastNames) == 0 {
+		p.LastNames = lastNames
+	}
+	if len(p.Domains) == 0 {
+		p.Domains = domains
+	}
+	return p
+}
+
+// Validate reports unknown distribution names.
+func (c SeederConfig) Validate() error {
+	switch c.Amounts {
+	case AmountsUniform, AmountsLogNormal:
+	default:
+		return fmt.Errorf("unknown amount distribution %q (use %s or %s)", c.Amounts, AmountsUniform, AmountsLogNormal)
+	}
+	switch c.Signups {
+	case SignupsUniform, SignupsRecent:
+	default:
+		return fmt.Errorf("unknown signup distribution %q (use %s or %s)", c.Signups, SignupsUniform, SignupsRecent)
+	}
+	return nil
+}
+
+func (c SeederConfig) orderAmount(r *rand.Rand) int64 {
+	if c.Amounts != AmountsLogNormal {
+		return int64(minOrderAmount + r.Intn(150000))
+	}
+	amount := math.Exp(math.Log(logNormalMedian) + r.NormFloat64()*logNormalSigma)
+	return int64(math.Min(math.Max(amount, minOrderAmount), maxOrderAmount))
+}
+
+func (c SeederConfig) signupTime(r *rand.Rand) time.Time {
+	if c.Signups != SignupsRecent {
+		return randomTimeInPast(r, signupWindow)
+	}
+	age := time.Duration(r.ExpFloat64() * float64(recentSignupMean))
+	if age >= signupWindow {
+		age = time.Duration(r.Int63n(int64(signupWindow)))
+	}
+	return time.Now().UTC().Add(-age)
+}
@@ -2,11 +2,14 @@ package builder
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -17,31 +20,75 @@ import (
 
 // Server exposes HTTP APIs that mimic an external e-commerce site builder.
 type Server struct {
-	store  *Store
-	logger *slog.Logger
+	store      *Store
+	logger     *slog.Logger
+	adminToken string
+	config     Config
+	devMode    bool
+	// maxPageSize caps page_size on the paginated listings and limit on the changes feed.
+	maxPageSize int
+}
+
+// ServerOption customises optional Server behaviour.
+type ServerOption func(*Server)
+
+// WithAdminToken requires the X-Admin-Token header on admin endpoints that reveal secrets.
+// Those endpoints are disabled when no token is set.
+func WithAdminToken(token string) ServerOption {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithConfig exposes cfg, redacted, at /builder/config.
+func WithConfig(cfg Config) ServerOption {
+	return func(s *Server) {
+		s.config = cfg
+	}
+}
+
+// WithMaxPageSize lets callers request pages of up to n rows instead of 10, which speeds up large
+// backfills. n is clamped with ClampMaxPageSize. The default page size stays 10, so clients only
+// get bigger pages when they ask for them.
+func WithMaxPageSize(n int) ServerOption {
+	return func(s *Server) {
+		s.maxPageSize = ClampMaxPageSize(n)
+	}
 }
 
 // NewServer builds a server backed by the provided store.
-func NewServer(store *Store, logger *slog.Logger) *Server {
-	return &Server{store: store, logger: logger}
+func NewServer(store *Store, logger *slog.Logger, opts ...ServerOption) *Server {
+	s := &Server{store: store, logger: logger, maxPageSize: maxPageSize}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Router wires all builder routes under a single chi router.
 func (s *Server) Router() http.Handler {
 	r := chi.NewRouter()
+	r.Use(negotiateJSONFormat)
 	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"ok":true}`))
 	})
 
 	r.Route("/builder", func(r chi.Router) {
+		r.Get("/config", s.handleConfig)
 		r.Get("/sites", s.handleListSites)
 		r.Post("/sites", s.handleCreateSite)
+		r.Post("/sites/batch", s.handleCreateSiteBatch)
 		r.Route("/sites/{siteID}", func(r chi.Router) {
 			r.Get("/", s.handleGetSite)
 			r.Delete("/", s.handleDeleteSite)
+			r.With(s.requireAdminToken).Get("/access-key", s.handleRevealAccessKey)
 			r.Post("/random-user", s.handleRandomUser)
 			r.Post("/random-order", s.handleRandomOrder)
+			r.Post("/simulate", s.handleSimulate)
+			r.Post("/clone", s.handleCloneSite)
+			r.Post("/reset", s.handleResetSite)
+			r.Get("/debug/duplicate-emails", s.handleDuplicateEmails)
 		})
 	})
 
@@ -49,8 +96,19 @@ func (s *Server) Router() http.Handler {
 		r.Group(func(r chi.Router) {
 			r.Use(s.requireAccessKey)
 			r.Get("/", s.handleAccessSiteProfile)
-			r.Get("/users", s.handleListUsers)
-			r.Get("/orders", s.handleListOrders)
+			r.With(s.injectDelay).Get("/users", s.handleListUsers)
+			r.Head("/users", s.handleHeadUsers)
+			r.Get("/users/count", s.handleCountUsers)
+			r.Get("/users/no-orders", s.handleListUsersWithoutOrders)
+			r.With(s.injectDelay).Get("/orders", s.handleListOrders)
+			r.Head("/orders", s.handleHeadOrders)
+			r.Get("/orders/count", s.handleCountOrders)
+			r.Get("/orders/top", s.handleTopOrders)
+			r.Get("/orders/latest-per-user", s.handleLatestOrderPerUser)
+			r.Get("/users/export", s.handleExportUsers)
+			r.Get("/orders/export", s.handleExportOrders)
+			r.Get("/changes", s.handleListChanges)
+			r.With(s.injectDelay).Get("/activity", s.handleListActivity)
 		})
 	})
 
@@ -59,22 +117,80 @@ func (s *Server) Router() http.Handler {
 
 func (s *Server) handleCreateSite(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
-		Name string `json:"name"`
+		Name      string `json:"name"`
+		CreatedAt string `json:"created_at"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
 		return
 	}
+	var createdAt time.Time
+	if raw := strings.TrimSpace(payload.CreatedAt); raw != "" {
+		ts, err := parseTime(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "created_at: %v", err)
+			return
+		}
+		createdAt = ts
+	}
 	ctx := r.Context()
-	site, err := s.store.CreateSite(ctx, payload.Name)
+	site, err := s.store.CreateSiteAt(ctx, payload.Name, createdAt)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusBadRequest, "%v", err)
 		return
 	}
 	s.logger.Info("builder site created", "site_id", site.ID, "name", site.Name)
 	writeJSON(w, http.StatusCreated, MarshalSite(site, true))
 }
 
+// handleCreateSiteBatch creates every site in the body array in one transaction. Invalid entries
+// are reported by index and nothing is created.
+func (s *Server) handleCreateSiteBatch(w http.ResponseWriter, r *http.Request) {
+	var payload []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	names := make([]string, len(payload))
+	for i, p := range payload {
+		names[i] = p.Name
+	}
+	sites, err := s.store.CreateSites(r.Context(), names)
+	if err != nil {
+		var batchErr *SiteBatchError
+		if errors.As(err, &batchErr) {
+			invalid := make([]map[string]any, 0, len(batchErr.Invalid))
+			for i := range names {
+				if msg, ok := batchErr.Invalid[i]; ok {
+					invalid = append(invalid, map[string]any{"index": i, "message": msg})
+				}
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error": map[string]any{
+					"message": err.Error(),
+					"status":  http.StatusBadRequest,
+					"invalid": invalid,
+				},
+			})
+			return
+		}
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(sites))
+	for _, site := range sites {
+		resp = append(resp, MarshalSite(site, true))
+	}
+	s.logger.Info("builder sites created", "count", len(sites))
+	writeJSON(w, http.StatusCreated, map[string]any{"sites": resp})
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.config.Redacted())
+}
+
 func (s *Server) handleListSites(w http.ResponseWriter, r *http.Request) {
 	sites, err := s.store.ListSites(r.Context())
 	if err != nil {
@@ -83,7 +199,7 @@ func (s *Server) handleListSites(w http.ResponseWriter, r *http.Request) {
 	}
 	resp := make([]map[string]any, 0, len(sites))
 	for _, site := range sites {
-		resp = append(resp, MarshalSite(site, true))
+		resp = append(resp, MarshalSite(site, false))
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"sites": resp})
 }
@@ -95,7 +211,44 @@ func (s *Server) handleGetSite(w http.ResponseWriter, r *http.Request) {
 		handleNotFound(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, MarshalSite(site, true))
+	writeJSON(w, http.StatusOK, MarshalSite(site, false))
+}
+
+// handleDuplicateEmails is a data-quality check listing emails shared by several users.
+func (s *Server) handleDuplicateEmails(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	if _, err := s.store.GetSite(r.Context(), siteID); err != nil {
+		handleNotFound(w, err)
+		return
+	}
+	dupes, err := s.store.FindDuplicateEmails(r.Context(), siteID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id":    siteID,
+		"duplicates": dupes,
+		"count":      len(dupes),
+	})
+}
+
+// handleRevealAccessKey is the single deliberate path for retrieving a site's access key after
+// creation. Every reveal is logged for auditing.
+func (s *Server) handleRevealAccessKey(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	site, err := s.store.GetSite(r.Context(), siteID)
+	if err != nil {
+		handleNotFound(w, err)
+		return
+	}
+	revealedAt := time.Now().UTC()
+	s.logger.Warn("builder access key revealed", "site_id", site.ID, "revealed_at", revealedAt.Format(time.RFC3339), "remote_addr", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id":     site.ID,
+		"access_key":  site.AccessKey,
+		"revealed_at": revealedAt.Format(time.RFC3339),
+	})
 }
 
 func (s *Server) handleDeleteSite(w http.ResponseWriter, r *http.Request) {
@@ -109,6 +262,52 @@ func (s *Server) handleDeleteSite(w http.ResponseWriter, r *http.Request) {
 	s.logger.Info("builder site deleted", "site_id", siteID)
 }
 
+// handleResetSite empties a site's users and orders but keeps the site and access key, so a
+// worker registration survives test cleanup.
+func (s *Server) handleResetSite(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	result, err := s.store.ResetSite(r.Context(), siteID)
+	if err != nil {
+		handleNotFound(w, err)
+		return
+	}
+	s.logger.Info("builder site reset", "site_id", siteID, "users_removed", result.Users, "orders_removed", result.Orders)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id":        siteID,
+		"users_removed":  result.Users,
+		"orders_removed": result.Orders,
+	})
+}
+
+func (s *Server) handleCloneSite(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+			return
+		}
+	}
+	result, err := s.store.CloneSite(r.Context(), siteID, payload.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			handleNotFound(w, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.logger.Info("builder site cloned", "source_site_id", siteID, "site_id", result.Site.ID, "users", result.Users, "orders", result.Orders)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"site":          MarshalSite(result.Site, true),
+		"source_id":     siteID,
+		"users_copied":  result.Users,
+		"orders_copied": result.Orders,
+	})
+}
+
 func (s *Server) handleRandomUser(w http.ResponseWriter, r *http.Request) {
 	siteID := chi.URLParam(r, "siteID")
 	user, err := s.store.CreateRandomUser(r.Context(), siteID)
@@ -124,13 +323,40 @@ func (s *Server) handleRandomOrder(w http.ResponseWriter, r *http.Request) {
 	siteID := chi.URLParam(r, "siteID")
 	order, err := s.store.CreateRandomOrder(r.Context(), siteID)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusBadRequest, "%v", err)
 		return
 	}
 	s.logger.Info("builder random order created", "site_id", siteID, "order_id", order.ID, "user_id", order.UserID)
 	writeJSON(w, http.StatusCreated, MarshalOrder(order))
 }
 
+// defaultSimulatedUsers is used when POST /simulate omits users.
+const defaultSimulatedUsers = 10
+
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	payload := struct {
+		Users int `json:"users"`
+	}{Users: defaultSimulatedUsers}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+			return
+		}
+	}
+	result, err := s.store.Simulate(r.Context(), siteID, payload.Users)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			handleNotFound(w, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.logger.Info("builder journeys simulated", "site_id", siteID, "users", result.Users, "touches", result.Touches, "orders", result.Orders)
+	writeJSON(w, http.StatusCreated, result)
+}
+
 func (s *Server) handleAccessSiteProfile(w http.ResponseWriter, r *http.Request) {
 	site := s.siteFromContext(r.Context())
 	writeJSON(w, http.StatusOK, MarshalSite(site, true))
@@ -139,17 +365,133 @@ func (s *Server) handleAccessSiteProfile(w http.ResponseWriter, r *http.Request)
 func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	site := s.siteFromContext(ctx)
-	page, size := parsePaging(r)
+	page, size := s.parsePaging(r)
 	start, end, err := parseDateRange(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusBadRequest, "%v", err)
 		return
 	}
-	result, err := s.store.ListUsers(ctx, site.ID, page, size, start, end)
+	var result UserPage
+	if cursor := strings.TrimSpace(r.URL.Query().Get("cursor")); cursor != "" {
+		result, err = s.store.ListUsersAfter(ctx, site.ID, cursor, size, start, end)
+	} else {
+		result, err = s.store.ListUsers(ctx, site.ID, page, size, start, end)
+	}
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "list users: %v", err)
 		return
 	}
+	writeJSON(w, http.StatusOK, userPagePayload(result))
+}
+
+// handleCountUsers returns only the number of users matching the list filters, so callers can
+// decide whether a sync is worthwhile without transferring rows.
+func (s *Server) handleCountUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	total, err := s.store.CountUsers(ctx, site.ID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "count users: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": total})
+}
+
+// handleCountOrders is the orders counterpart of handleCountUsers.
+func (s *Server) handleCountOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	total, err := s.store.CountOrders(ctx, site.ID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "count orders: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total": total})
+}
+
+// handleHeadUsers answers HEAD on the user list with X-Total-Count and X-Total-Pages only, so
+// clients can size a crawl without fetching a page.
+func (s *Server) handleHeadUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	_, size := s.parsePaging(r)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	total, err := s.store.CountUsers(ctx, site.ID, start, end)
+	if err != nil {
+		s.logger.Error("count users failed", "site_id", site.ID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeTotalHeaders(w, total, size)
+}
+
+// handleHeadOrders is the order-list counterpart of handleHeadUsers.
+func (s *Server) handleHeadOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	_, size := s.parsePaging(r)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	total, err := s.store.CountOrders(ctx, site.ID, start, end)
+	if err != nil {
+		s.logger.Error("count orders failed", "site_id", site.ID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeTotalHeaders(w, total, size)
+}
+
+func writeTotalHeaders(w http.ResponseWriter, total, pageSize int) {
+	pages := 0
+	if pageSize > 0 {
+		pages = (total + pageSize - 1) / pageSize
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("X-Total-Pages", strconv.Itoa(pages))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleListUsersWithoutOrders serves users with zero orders for churn analysis,
+// filtered on signup_at and paginated like the regular user listing.
+func (s *Server) handleListUsersWithoutOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	page, size := s.parsePaging(r)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	result, err := s.store.ListUsersWithoutOrders(ctx, site.ID, page, size, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "list users without orders: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userPagePayload(result))
+}
+
+func userPagePayload(result UserPage) map[string]any {
 	payload := map[string]any{
 		"page":      result.Page,
 		"page_size": result.PageSize,
@@ -160,29 +502,57 @@ func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	if result.NextPage != nil {
 		payload["next_page"] = result.NextPage
 	}
+	if result.NextCursor != "" {
+		payload["next_cursor"] = result.NextCursor
+	}
 	if result.StartDate != "" {
 		payload["start_date"] = result.StartDate
 	}
 	if result.EndDate != "" {
 		payload["end_date"] = result.EndDate
 	}
-	writeJSON(w, http.StatusOK, payload)
+	return payload
 }
 
 func (s *Server) handleListOrders(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	site := s.siteFromContext(ctx)
-	page, size := parsePaging(r)
+	page, size := s.parsePaging(r)
 	start, end, err := parseDateRange(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusBadRequest, "%v", err)
 		return
 	}
-	result, err := s.store.ListOrders(ctx, site.ID, page, size, start, end)
+	var result OrderPage
+	if cursor := strings.TrimSpace(r.URL.Query().Get("cursor")); cursor != "" {
+		result, err = s.store.ListOrdersAfter(ctx, site.ID, cursor, size, start, end)
+	} else {
+		result, err = s.store.ListOrders(ctx, site.ID, page, size, start, end)
+	}
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "list orders: %v", err)
 		return
 	}
+	writeJSON(w, http.StatusOK, orderPagePayload(result))
+}
+
+func (s *Server) handleLatestOrderPerUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	page, size := s.parsePaging(r)
+	result, err := s.store.ListLatestOrderPerUser(ctx, site.ID, page, size)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "list latest orders: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, orderPagePayload(result))
+}
+
+func orderPagePayload(result OrderPage) map[string]any {
 	payload := map[string]any{
 		"page":      result.Page,
 		"page_size": result.PageSize,
@@ -193,6 +563,42 @@ func (s *Server) handleListOrders(w http.ResponseWriter, r *http.Request) {
 	if result.NextPage != nil {
 		payload["next_page"] = result.NextPage
 	}
+	if result.NextCursor != "" {
+		payload["next_cursor"] = result.NextCursor
+	}
+	if result.StartDate != "" {
+		payload["start_date"] = result.StartDate
+	}
+	if result.EndDate != "" {
+		payload["end_date"] = result.EndDate
+	}
+	return payload
+}
+
+func (s *Server) handleListActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	page, size := s.parsePaging(r)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	result, err := s.store.ListActivity(ctx, site.ID, page, size, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "list activity: %v", err)
+		return
+	}
+	payload := map[string]any{
+		"page":       result.Page,
+		"page_size":  result.PageSize,
+		"total":      result.Total,
+		"has_more":   result.HasMore,
+		"activities": result.Activities,
+	}
+	if result.NextPage != nil {
+		payload["next_page"] = result.NextPage
+	}
 	if result.StartDate != "" {
 		payload["start_date"] = result.StartDate
 	}
@@ -202,6 +608,112 @@ func (s *Server) handleListOrders(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, payload)
 }
 
+func (s *Server) handleTopOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	currency := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	if currency == "" {
+		writeError(w, http.StatusBadRequest, "currency is required")
+		return
+	}
+	limit := parseIntDefault(r.URL.Query().Get("limit"), maxPageSize)
+	orders, err := s.store.TopOrders(ctx, site.ID, currency, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "top orders: %v", err)
+		return
+	}
+	payload := make([]map[string]any, 0, len(orders))
+	for _, o := range orders {
+		payload = append(payload, MarshalOrder(o))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"currency": currency,
+		"count":    len(payload),
+		"orders":   payload,
+	})
+}
+
+// handleListChanges serves the site's ordered changes feed. Consumers pass the last seq they
+// processed as since and resume from next_since.
+func (s *Server) handleListChanges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	since, err := strconv.ParseInt(defaultString(r.URL.Query().Get("since"), "0"), 10, 64)
+	if err != nil || since < 0 {
+		writeError(w, http.StatusBadRequest, "since must be a non-negative integer")
+		return
+	}
+	limit := min(parseIntDefault(r.URL.Query().Get("limit"), maxPageSize), s.maxPageSize)
+	page, err := s.store.ListChanges(ctx, site.ID, since, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "list changes: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleExportUsers streams every matching user as CSV straight from the database cursor so
+// large sites never have to be buffered in memory.
+func (s *Server) handleExportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.csv"`, site.ID))
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "site_id", "email", "first_name", "last_name", "signup_at"})
+	count := 0
+	err = s.store.IterateUsers(ctx, site.ID, start, end, func(u User) error {
+		count++
+		return cw.Write([]string{u.ID, u.SiteID, u.Email, u.FirstName, u.LastName, u.SignupAt.Format(time.RFC3339)})
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		s.logger.Error("export users failed", "site_id", site.ID, "rows", count, "error", err)
+		return
+	}
+	s.logger.Info("builder users exported", "site_id", site.ID, "rows", count)
+}
+
+// handleExportOrders streams every matching order as CSV straight from the database cursor.
+func (s *Server) handleExportOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	site := s.siteFromContext(ctx)
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="orders-%s.csv"`, site.ID))
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "site_id", "user_id", "order_number", "total_amount", "currency", "placed_at"})
+	count := 0
+	err = s.store.IterateOrders(ctx, site.ID, start, end, func(o Order) error {
+		count++
+		return cw.Write([]string{
+			o.ID, o.SiteID, o.UserID, o.OrderNumber,
+			strconv.FormatInt(o.TotalAmount, 10), o.Currency, o.PlacedAt.Format(time.RFC3339),
+		})
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		s.logger.Error("export orders failed", "site_id", site.ID, "rows", count, "error", err)
+		return
+	}
+	s.logger.Info("builder orders exported", "site_id", site.ID, "rows", count)
+}
+
 func (s *Server) requireAccessKey(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		siteID := chi.URLParam(r, "siteID")
@@ -212,6 +724,10 @@ func (s *Server) requireAccessKey(next http.Handler) http.Handler {
 		}
 		site, err := s.store.ValidateAccessKey(r.Context(), siteID, accessKey)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeError(w, http.StatusNotFound, "site not found")
+				return
+			}
 			writeError(w, http.StatusUnauthorized, "invalid site or access key")
 			return
 		}
@@ -220,16 +736,37 @@ func (s *Server) requireAccessKey(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdminToken guards endpoints that reveal secrets. They fail closed: without a configured
+// admin token they are disabled rather than open.
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			writeError(w, http.StatusForbidden, "admin endpoints are disabled; start the builder with --admin-token")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(s.adminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid X-Admin-Token header")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) siteFromContext(ctx context.Context) Site {
 	return ctx.Value(siteContextKey{}).(Site)
 }
 
 type siteContextKey struct{}
 
-func parsePaging(r *http.Request) (int, int) {
+// MaxPageSize reports the effective maximum page size after clamping.
+func (s *Server) MaxPageSize() int {
+	return s.maxPageSize
+}
+
+func (s *Server) parsePaging(r *http.Request) (int, int) {
 	page := parseIntDefault(r.URL.Query().Get("page"), 1)
 	size := parseIntDefault(r.URL.Query().Get("page_size"), maxPageSize)
-	page, size = EnsurePageSize(page, size)
+	page, size = EnsurePageSize(page, min(size, s.maxPageSize))
 	return page, size
 }
 
@@ -244,6 +781,13 @@ func parseIntDefault(v string, fallback int) int {
 	return n
 }
 
+func defaultString(v, fallback string) string {
+	if strings.TrimSpace(v) == "" {
+		return fallback
+	}
+	return v
+}
+
 func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
 	var startPtr, endPtr *time.Time
 	if start := strings.TrimSpace(r.URL.Query().Get("start")); start != "" {
@@ -273,11 +817,70 @@ func parseTime(value string) (time.Time, error) {
 	return time.Time{}, errors.New("invalid time format, use RFC3339 or YYYY-MM-DD")
 }
 
+// compactJSONWriter marks a response whose JSON body should be written without indentation.
+type compactJSONWriter struct {
+	http.ResponseWriter
+}
+
+func (w compactJSONWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (compactJSONWriter) compactJSON() bool { return true }
+
+// compactJSONResponder is implemented by response writers that carry a compact JSON request.
+type compactJSONResponder interface {
+	compactJSON() bool
+}
+
+// wantsCompactResponse reports whether w, or any writer it wraps through Unwrap, asked for
+// compact JSON, so middleware that wraps the writer later does not lose the preference.
+func wantsCompactResponse(w http.ResponseWriter) bool {
+	for {
+		if c, ok := w.(compactJSONResponder); ok {
+			return c.compactJSON()
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// negotiateJSONFormat switches writeJSON to compact output for machine consumers that ask for
+// it with ?pretty=false or an Accept of application/json;pretty=false. Pretty-printing stays the
+// default so responses remain readable when debugging by hand.
+func negotiateJSONFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantsCompactJSON(r) {
+			w = compactJSONWriter{w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func wantsCompactJSON(r *http.Request) bool {
+	if v := r.URL.Query().Get("pretty"); v != "" {
+		pretty, err := strconv.ParseBool(v)
+		return err == nil && !pretty
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "application/json" && params["pretty"] == "false" {
+			return true
+		}
+	}
+	return false
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
+	if !wantsCompactResponse(w) {
+		enc.SetIndent("", "  ")
+	}
 	_ = enc.Encode(payload)
 }
 
@@ -295,5 +898,5 @@ func handleNotFound(w http.ResponseWriter, err error) {
 		writeError(w, http.StatusNotFound, "resource not found")
 		return
 	}
-	writeError(w, http.StatusInternalServerError, err.Error())
+	writeError(w, http.StatusInternalServerError, "%v", err)
 }
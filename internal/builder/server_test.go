@@ -0,0 +1,151 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"example.com/temporal-go/internal/sqliteutil"
+)
+
+// newTestStore opens an initialised builder store in a temporary directory.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := sqliteutil.Open(filepath.Join(t.TempDir(), "builder.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := NewStore(db)
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatalf("init store: %v", err)
+	}
+	return store
+}
+
+func newTestServer(store *Store, opts ...ServerOption) *Server {
+	return NewServer(store, slog.New(slog.NewTextHandler(io.Discard, nil)), opts...)
+}
+
+// get sends a GET through h with the given headers set.
+func get(h http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRevealAccessKeyRequiresAdminToken(t *testing.T) {
+	store := newTestStore(t)
+	site, err := store.CreateSite(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	target := "/builder/sites/" + site.ID + "/access-key"
+
+	open := newTestServer(store).Router()
+	if rec := get(open, target, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("without a configured token: status %d, want 403", rec.Code)
+	}
+
+	guarded := newTestServer(store, WithAdminToken("secret")).Router()
+	for name, header := range map[string]map[string]string{
+		"missing": nil,
+		"wrong":   {"X-Admin-Token": "nope"},
+	} {
+		if rec := get(guarded, target, header); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s token: status %d, want 401", name, rec.Code)
+		}
+	}
+	rec := get(guarded, target, map[string]string{"X-Admin-Token": "secret"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid token: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAccessKeyFailuresDistinguishUnknownSites(t *testing.T) {
+	store := newTestStore(t)
+	site, err := store.CreateSite(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	h := newTestServer(store).Router()
+	for name, tc := range map[string]struct {
+		siteID, key string
+		want        int
+	}{
+		"valid":       {site.ID, site.AccessKey, http.StatusOK},
+		"missing key": {site.ID, "", http.StatusUnauthorized},
+		"wrong key":   {site.ID, "nope", http.StatusUnauthorized},
+		"unknown":     {"no-such-site", "nope", http.StatusNotFound},
+	} {
+		var header map[string]string
+		if tc.key != "" {
+			header = map[string]string{"X-Access-Key": tc.key}
+		}
+		if rec := get(h, "/builder/api/sites/"+tc.siteID, header); rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestClampMaxPageSize(t *testing.T) {
+	for n, want := range map[int]int{-5: 1, 0: 1, 1: 1, 100: 100, MaxPageSizeCeiling: MaxPageSizeCeiling, 10_000: MaxPageSizeCeiling} {
+		if got := ClampMaxPageSize(n); got != want {
+			t.Errorf("ClampMaxPageSize(%d) = %d, want %d", n, got, want)
+		}
+	}
+	if got := newTestServer(newTestStore(t), WithMaxPageSize(10_000)).MaxPageSize(); got != MaxPageSizeCeiling {
+		t.Fatalf("MaxPageSize() = %d, want the %d ceiling", got, MaxPageSizeCeiling)
+	}
+}
+
+func TestListUsersPageSizeIsOptIn(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	site, err := store.CreateSite(ctx, "shop")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	for range 30 {
+		if _, err := store.CreateRandomUser(ctx, site.ID); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	header := map[string]string{"X-Access-Key": site.AccessKey}
+	base := "/builder/api/sites/" + site.ID + "/users"
+
+	for name, tc := range map[string]struct {
+		opts   []ServerOption
+		target string
+		want   int
+	}{
+		"default server caps requests": {nil, base + "?page_size=25", maxPageSize},
+		"raised max, no page_size":     {[]ServerOption{WithMaxPageSize(50)}, base, maxPageSize},
+		"raised max, page_size asked":  {[]ServerOption{WithMaxPageSize(50)}, base + "?page_size=25", 25},
+		"page_size above raised max":   {[]ServerOption{WithMaxPageSize(20)}, base + "?page_size=25", 20},
+	} {
+		rec := get(newTestServer(store, tc.opts...).Router(), tc.target, header)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", name, rec.Code, rec.Body)
+		}
+		var body struct {
+			PageSize int    `json:"page_size"`
+			Users    []User `json:"users"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		if body.PageSize != tc.want || len(body.Users) != tc.want {
+			t.Errorf("%s: page_size %d with %d users, want %d", name, body.PageSize, len(body.Users), tc.want)
+		}
+	}
+}
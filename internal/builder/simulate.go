@@ -0,0 +1,122 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// MaxSimulatedUsers caps how many user journeys Simulate generates in one call.
+const MaxSimulatedUsers = 500
+
+var (
+	simulatedTouchEvents = []string{"page_view", "product_view"}
+	simulatedUTMSources  = []string{"google", "facebook", "instagram", "newsletter", "naver"}
+)
+
+// SimulatedTouch is a browsing event in a simulated journey. The builder has no event store, so
+// touches are returned in the shape the worker's POST /worker/events accepts and the caller
+// replays them there.
+type SimulatedTouch struct {
+	SiteID    string    `json:"site_id"`
+	UserID    string    `json:"user_id"`
+	EventName string    `json:"event_name"`
+	UTMSource string    `json:"utm_source"`
+	Timestamp time.Time `json:"timestamp"`
+	DedupeKey string    `json:"dedupe_key"`
+}
+
+// SimulatedJourney is one user's signup, touches, and order, in causal order.
+type SimulatedJourney struct {
+	User    User             `json:"user"`
+	Touches []SimulatedTouch `json:"touches"`
+	Order   Order            `json:"order"`
+}
+
+// SimulationResult summarizes a Simulate call.
+type SimulationResult struct {
+	SiteID   string             `json:"site_id"`
+	Users    int                `json:"users"`
+	Touches  int                `json:"touches"`
+	Orders   int                `json:"orders"`
+	Journeys []SimulatedJourney `json:"journeys"`
+}
+
+// Simulate seeds count users into a site, each with an order, and generates 1–3 utm-tagged
+// touches between the signup and the order. Every timestamp follows the previous one and the
+// order lands in the past, so first/last-touch attribution has a well-defined answer. Users and
+// orders are written in one transaction; touches are only returned.
+func (s *Store) Simulate(ctx context.Context, siteID string, count int) (SimulationResult, error) {
+	if count < 1 || count > MaxSimulatedUsers {
+		return SimulationResult{}, fmt.Errorf("users must be between 1 and %d", MaxSimulatedUsers)
+	}
+	if _, err := s.GetSite(ctx, siteID); err != nil {
+		return SimulationResult{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SimulationResult{}, fmt.Errorf("begin simulate tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result := SimulationResult{SiteID: siteID, Journeys: make([]SimulatedJourney, 0, count)}
+	for i := 0; i < count; i++ {
+		journey := s.simulateJourney(siteID, now)
+		if err := insertUser(ctx, tx, journey.User); err != nil {
+			return SimulationResult{}, err
+		}
+		if err := insertOrder(ctx, tx, journey.Order); err != nil {
+			return SimulationResult{}, err
+		}
+		result.Journeys = append(result.Journeys, journey)
+		result.Users++
+		result.Orders++
+		result.Touches += len(journey.Touches)
+	}
+	if err := tx.Commit(); err != nil {
+		return SimulationResult{}, fmt.Errorf("commit simulate: %w", err)
+	}
+	return result, nil
+}
+
+// simulateJourney draws the gaps between steps first and then anchors the whole journey at a
+// random point in the last 30 days, so the order never ends up after now.
+func (s *Store) simulateJourney(siteID string, now time.Time) SimulatedJourney {
+	touches := 1 + s.rnd.Intn(3)
+	gaps := make([]time.Duration, 0, touches+1)
+	gaps = append(gaps, randomDuration(s.rnd, 5*time.Minute, 6*time.Hour))
+	for i := 1; i < touches; i++ {
+		gaps = append(gaps, randomDuration(s.rnd, 10*time.Minute, 48*time.Hour))
+	}
+	gaps = append(gaps, randomDuration(s.rnd, 5*time.Minute, 3*time.Hour))
+	var span time.Duration
+	for _, g := range gaps {
+		span += g
+	}
+
+	user := s.randomUser(siteID)
+	user.SignupAt = randomTimeNear(s.rnd, now.Add(-span), 30*24*time.Hour)
+	journey := SimulatedJourney{User: user, Touches: make([]SimulatedTouch, 0, touches)}
+	at := user.SignupAt
+	for i := 0; i < touches; i++ {
+		at = at.Add(gaps[i])
+		journey.Touches = append(journey.Touches, SimulatedTouch{
+			SiteID:    siteID,
+			UserID:    user.ID,
+			EventName: simulatedTouchEvents[s.rnd.Intn(len(simulatedTouchEvents))],
+			UTMSource: simulatedUTMSources[s.rnd.Intn(len(simulatedUTMSources))],
+			Timestamp: at,
+			DedupeKey: fmt.Sprintf("sim:%s:%d", user.ID, i+1),
+		})
+	}
+	journey.Order = s.randomOrder(siteID, user.ID)
+	journey.Order.PlacedAt = at.Add(gaps[touches])
+	return journey
+}
+
+func randomDuration(r *rand.Rand, min, max time.Duration) time.Duration {
+	return min + time.Duration(r.Int63n(int64(max-min)))
+}
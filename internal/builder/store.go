@@ -3,31 +3,73 @@ package builder
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 const (
+	// maxPageSize is the default page size and, unless a Server raises it with WithMaxPageSize,
+	// also the largest one served.
 	maxPageSize = 10
+
+	// Seeded rows frequently share a timestamp, so every listing breaks ties on the implicit
+	// rowid (insertion order) rather than the random UUID primary key. This keeps offset
+	// pagination stable and makes ties resolve newest-inserted first, matching the DESC sort.
+	usersOrderBy  = "signup_at DESC, rowid DESC"
+	ordersOrderBy = "placed_at DESC, rowid DESC"
+	sitesOrderBy  = "created_at DESC, rowid DESC"
 )
 
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 // Store contains all builder-side persistence logic.
 type Store struct {
-	db  *sql.DB
-	rnd *rand.Rand
+	db     *sql.DB
+	rnd    *rand.Rand
+	seeder SeederConfig
+	ids    IDGenerator
+}
+
+// StoreOption customises optional Store behaviour.
+type StoreOption func(*Store)
+
+// WithSeederConfig changes the distributions used by CreateRandomUser and CreateRandomOrder.
+func WithSeederConfig(cfg SeederConfig) StoreOption {
+	return func(s *Store) {
+		cfg.Pools = cfg.Pools.withDefaults()
+		s.seeder = cfg
+		if cfg.Seed != 0 {
+			s.rnd = rand.New(rand.NewSource(cfg.Seed))
+		}
+	}
+}
+
+// WithIDGenerator replaces the UUIDs used for site IDs, access keys, user and order IDs, and
+// order numbers.
+func WithIDGenerator(gen IDGenerator) StoreOption {
+	return func(s *Store) {
+		s.ids = gen
+	}
 }
 
 // NewStore wires a builder data store backed by SQLite.
-func NewStore(db *sql.DB) *Store {
-	return &Store{
-		db:  db,
-		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+func NewStore(db *sql.DB, opts ...StoreOption) *Store {
+	s := &Store{
+		db:     db,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		seeder: DefaultSeederConfig(),
+		ids:    UUIDGenerator,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Init applies schema migrations for the builder database.
@@ -61,6 +103,24 @@ func (s *Store) Init(ctx context.Context) error {
 			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 		);`,
 		`CREATE INDEX IF NOT EXISTS idx_orders_site_placed ON orders(site_id, placed_at DESC);`,
+		`CREATE TABLE IF NOT EXISTS changes (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id TEXT NOT NULL,
+			entity TEXT NOT NULL,
+			entity_id TEXT NOT NULL,
+			changed_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_changes_site_seq ON changes(site_id, seq);`,
+		// Backfill the feed for rows created before the changes table existed.
+		`INSERT INTO changes(site_id, entity, entity_id, changed_at)
+			SELECT site_id, 'user', id, signup_at FROM users
+			WHERE id NOT IN (SELECT entity_id FROM changes WHERE entity = 'user')
+			ORDER BY signup_at, rowid;`,
+		`INSERT INTO changes(site_id, entity, entity_id, changed_at)
+			SELECT site_id, 'order', id, placed_at FROM orders
+			WHERE id NOT IN (SELECT entity_id FROM changes WHERE entity = 'order')
+			ORDER BY placed_at, rowid;`,
 	}
 
 	for _, stmt := range stmts {
@@ -73,16 +133,32 @@ func (s *Store) Init(ctx context.Context) error {
 
 // CreateSite registers a new site and generates its access key.
 func (s *Store) CreateSite(ctx context.Context, name string) (Site, error) {
+	return s.CreateSiteAt(ctx, name, time.Time{})
+}
+
+// CreateSiteAt is CreateSite with an explicit created_at, so tests can set up sites onboarded in
+// the past. A zero createdAt means now; a future one is rejected.
+func (s *Store) CreateSiteAt(ctx context.Context, name string, createdAt time.Time) (Site, error) {
 	if strings.TrimSpace(name) == "" {
 		return Site{}, errors.New("site name required")
 	}
-	siteID := uuid.NewString()
-	accessKey := uuid.NewString()
-	now := time.Now().UTC()
-	if _, err := s.db.ExecContext(
+	if createdAt.After(time.Now()) {
+		return Site{}, errors.New("created_at must not be in the future")
+	}
+	return s.createSite(ctx, s.db, name, createdAt)
+}
+
+func (s *Store) createSite(ctx context.Context, e execer, name string, createdAt time.Time) (Site, error) {
+	siteID := s.ids.NewID()
+	accessKey := s.ids.NewID()
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	createdAt = createdAt.UTC()
+	if _, err := e.ExecContext(
 		ctx,
 		`INSERT INTO sites(id, name, access_key, created_at) VALUES (?, ?, ?, ?)`,
-		siteID, name, accessKey, now,
+		siteID, name, accessKey, createdAt,
 	); err != nil {
 		return Site{}, fmt.Errorf("insert site: %w", err)
 	}
@@ -90,10 +166,248 @@ func (s *Store) CreateSite(ctx context.Context, name string) (Site, error) {
 		ID:        siteID,
 		Name:      name,
 		AccessKey: accessKey,
-		CreatedAt: now,
+		CreatedAt: createdAt,
 	}, nil
 }
 
+// MaxSiteBatch caps how many sites CreateSites creates in one call.
+const MaxSiteBatch = 100
+
+// SiteBatchError lists the invalid entries of a CreateSites batch, keyed by their index.
+type SiteBatchError struct {
+	Invalid map[int]string
+}
+
+func (e *SiteBatchError) Error() string {
+	return fmt.Sprintf("%d invalid site(s) in batch", len(e.Invalid))
+}
+
+// CreateSites creates one site per name in a single transaction, so either every site is
+// created or none are. All names are validated up front and reported together as a
+// *SiteBatchError.
+func (s *Store) CreateSites(ctx context.Context, names []string) ([]Site, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one site required")
+	}
+	if len(names) > MaxSiteBatch {
+		return nil, fmt.Errorf("at most %d sites per batch", MaxSiteBatch)
+	}
+	invalid := map[int]string{}
+	for i, name := range names {
+		if strings.TrimSpace(name) == "" {
+			invalid[i] = "site name required"
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, &SiteBatchError{Invalid: invalid}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin site batch tx: %w", err)
+	}
+	defer tx.Rollback()
+	sites := make([]Site, 0, len(names))
+	for _, name := range names {
+		site, err := s.createSite(ctx, tx, name, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, site)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit site batch: %w", err)
+	}
+	return sites, nil
+}
+
+// maxCloneRows caps how many users plus orders CloneSite copies in one transaction.
+const maxCloneRows = 10000
+
+// CloneResult describes a site created by CloneSite.
+type CloneResult struct {
+	Site   Site `json:"site"`
+	Users  int  `json:"users_copied"`
+	Orders int  `json:"orders_copied"`
+}
+
+// CloneSite copies a site's users and orders into a brand new site with fresh IDs and access
+// key, all in one transaction. An empty name defaults to "<source name> (copy)".
+func (s *Store) CloneSite(ctx context.Context, sourceID, name string) (CloneResult, error) {
+	source, err := s.GetSite(ctx, sourceID)
+	if err != nil {
+		return CloneResult{}, err
+	}
+	if strings.TrimSpace(name) == "" {
+		name = source.Name + " (copy)"
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CloneResult{}, fmt.Errorf("begin clone tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rowCount int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM users WHERE site_id = ?) + (SELECT COUNT(*) FROM orders WHERE site_id = ?)`,
+		sourceID, sourceID,
+	).Scan(&rowCount); err != nil {
+		return CloneResult{}, fmt.Errorf("count clone rows: %w", err)
+	}
+	if rowCount > maxCloneRows {
+		return CloneResult{}, fmt.Errorf("site has %d users and orders, clone limit is %d", rowCount, maxCloneRows)
+	}
+
+	users, err := queryUsers(ctx, tx, `SELECT id, site_id, email, first_name, last_name, signup_at
+		FROM users WHERE site_id = ? ORDER BY signup_at, rowid`, sourceID)
+	if err != nil {
+		return CloneResult{}, err
+	}
+	orders, err := queryOrders(ctx, tx, `SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at
+		FROM orders WHERE site_id = ? ORDER BY placed_at, rowid`, sourceID)
+	if err != nil {
+		return CloneResult{}, err
+	}
+
+	clone := Site{
+		ID:        s.ids.NewID(),
+		Name:      name,
+		AccessKey: s.ids.NewID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO sites(id, name, access_key, created_at) VALUES (?, ?, ?, ?)`,
+		clone.ID, clone.Name, clone.AccessKey, clone.CreatedAt,
+	); err != nil {
+		return CloneResult{}, fmt.Errorf("insert cloned site: %w", err)
+	}
+
+	userIDs := make(map[string]string, len(users))
+	for _, u := range users {
+		newID := s.ids.NewID()
+		userIDs[u.ID] = newID
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO users(id, site_id, email, first_name, last_name, signup_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			newID, clone.ID, u.Email, u.FirstName, u.LastName, u.SignupAt,
+		); err != nil {
+			return CloneResult{}, fmt.Errorf("clone user: %w", err)
+		}
+		if err := recordChange(ctx, tx, clone.ID, ChangeTypeUser, newID, u.SignupAt); err != nil {
+			return CloneResult{}, err
+		}
+	}
+	for _, o := range orders {
+		newID := s.ids.NewID()
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO orders(id, site_id, user_id, order_number, total_amount, currency, placed_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			newID, clone.ID, userIDs[o.UserID], o.OrderNumber, o.TotalAmount, o.Currency, o.PlacedAt,
+		); err != nil {
+			return CloneResult{}, fmt.Errorf("clone order: %w", err)
+		}
+		if err := recordChange(ctx, tx, clone.ID, ChangeTypeOrder, newID, o.PlacedAt); err != nil {
+			return CloneResult{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return CloneResult{}, fmt.Errorf("commit clone: %w", err)
+	}
+	return CloneResult{Site: clone, Users: len(users), Orders: len(orders)}, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func queryUsers(ctx context.Context, q queryer, query string, args ...any) ([]User, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query users: %w", err)
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.SiteID, &u.Email, &u.FirstName, &u.LastName, &u.SignupAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter users: %w", err)
+	}
+	return users, nil
+}
+
+func queryOrders(ctx context.Context, q queryer, query string, args ...any) ([]Order, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query orders: %w", err)
+	}
+	defer rows.Close()
+	var orders []Order
+	for rows.Next() {
+		var o Order
+		if err := rows.Scan(&o.ID, &o.SiteID, &o.UserID, &o.OrderNumber, &o.TotalAmount, &o.Currency, &o.PlacedAt); err != nil {
+			return nil, fmt.Errorf("scan order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter orders: %w", err)
+	}
+	return orders, nil
+}
+
+// maxTopOrders caps how many orders TopOrders returns.
+const maxTopOrders = 50
+
+// TopOrders returns the highest-value orders for a single currency, largest total_amount first.
+// Amounts in different currencies are not comparable, so currency is required.
+func (s *Store) TopOrders(ctx context.Context, siteID, currency string, limit int) ([]Order, error) {
+	if limit <= 0 {
+		limit = maxPageSize
+	}
+	if limit > maxTopOrders {
+		limit = maxTopOrders
+	}
+	return queryOrders(ctx, s.db, `SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at
+		FROM orders WHERE site_id = ? AND currency = ?
+		ORDER BY total_amount DESC, placed_at DESC, rowid DESC LIMIT ?`, siteID, currency, limit)
+}
+
+// FindDuplicateEmails maps every email shared by more than one user in a site to those users'
+// IDs, oldest signup first.
+func (s *Store) FindDuplicateEmails(ctx context.Context, siteID string) (map[string][]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT email, id FROM users
+		WHERE site_id = ? AND email IN (
+			SELECT email FROM users WHERE site_id = ? GROUP BY email HAVING COUNT(*) > 1
+		)
+		ORDER BY email, signup_at, rowid`, siteID, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("find duplicate emails: %w", err)
+	}
+	defer rows.Close()
+	dupes := map[string][]string{}
+	for rows.Next() {
+		var email, id string
+		if err := rows.Scan(&email, &id); err != nil {
+			return nil, fmt.Errorf("scan duplicate email: %w", err)
+		}
+		dupes[email] = append(dupes[email], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter duplicate emails: %w", err)
+	}
+	return dupes, nil
+}
+
 // DeleteSite removes a site and cascades related data.
 func (s *Store) DeleteSite(ctx context.Context, siteID string) error {
 	res, err := s.db.ExecContext(ctx, `DELETE FROM sites WHERE id = ?`, siteID)
@@ -107,9 +421,48 @@ func (s *Store) DeleteSite(ctx context.Context, siteID string) error {
 	return nil
 }
 
+// ResetResult reports what ResetSite removed.
+type ResetResult struct {
+	Users  int64 `json:"users_removed"`
+	Orders int64 `json:"orders_removed"`
+}
+
+// ResetSite deletes every user, order, and change-feed entry of a site in one transaction while
+// keeping the site and its access key. Change sequence numbers are never reused, so a worker's
+// stored watermark stays valid across a reset.
+func (s *Store) ResetSite(ctx context.Context, siteID string) (ResetResult, error) {
+	if _, err := s.GetSite(ctx, siteID); err != nil {
+		return ResetResult{}, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ResetResult{}, fmt.Errorf("begin reset tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var result ResetResult
+	res, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE site_id = ?`, siteID)
+	if err != nil {
+		return ResetResult{}, fmt.Errorf("reset orders: %w", err)
+	}
+	result.Orders, _ = res.RowsAffected()
+	res, err = tx.ExecContext(ctx, `DELETE FROM users WHERE site_id = ?`, siteID)
+	if err != nil {
+		return ResetResult{}, fmt.Errorf("reset users: %w", err)
+	}
+	result.Users, _ = res.RowsAffected()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM changes WHERE site_id = ?`, siteID); err != nil {
+		return ResetResult{}, fmt.Errorf("reset changes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return ResetResult{}, fmt.Errorf("commit reset: %w", err)
+	}
+	return result, nil
+}
+
 // ListSites returns all registered builder sites.
 func (s *Store) ListSites(ctx context.Context) ([]Site, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, access_key, created_at FROM sites ORDER BY created_at DESC`)
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, access_key, created_at FROM sites ORDER BY `+sitesOrderBy)
 	if err != nil {
 		return nil, fmt.Errorf("list sites: %w", err)
 	}
@@ -154,7 +507,17 @@ func (s *Store) ValidateAccessKey(ctx context.Context, siteID, accessKey string)
 	return site, nil
 }
 
-// EnsurePageSize enforces the maximum page size contract.
+// MaxPageSizeCeiling is the largest page size any configuration may serve.
+const MaxPageSizeCeiling = 500
+
+// ClampMaxPageSize bounds a configured maximum page size to [1, MaxPageSizeCeiling].
+func ClampMaxPageSize(n int) int {
+	return min(max(n, 1), MaxPageSizeCeiling)
+}
+
+// EnsurePageSize enforces the page size contract: a missing size means the default of 10 and no
+// page exceeds MaxPageSizeCeiling. Servers apply their configured maximum before calling the
+// store.
 func EnsurePageSize(page, pageSize int) (int, int) {
 	if page < 1 {
 		page = 1
@@ -162,15 +525,14 @@ func EnsurePageSize(page, pageSize int) (int, int) {
 	if pageSize < 1 {
 		pageSize = maxPageSize
 	}
-	if pageSize > maxPageSize {
-		pageSize = maxPageSize
+	if pageSize > MaxPageSizeCeiling {
+		pageSize = MaxPageSizeCeiling
 	}
 	return page, pageSize
 }
 
-// ListUsers returns paginated user rows filtered by date constraints.
-func (s *Store) ListUsers(ctx context.Context, siteID string, page, pageSize int, start, end *time.Time) (UserPage, error) {
-	page, pageSize = EnsurePageSize(page, pageSize)
+// usersFilter builds the WHERE clause shared by user listings and counts.
+func usersFilter(siteID string, start, end *time.Time) (string, []any) {
 	args := []any{siteID}
 	clauses := []string{"site_id = ?"}
 	if start != nil {
@@ -181,22 +543,174 @@ func (s *Store) ListUsers(ctx context.Context, siteID string, page, pageSize int
 		clauses = append(clauses, "signup_at <= ?")
 		args = append(args, end.UTC())
 	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// ordersFilter builds the WHERE clause shared by order listings and counts.
+func ordersFilter(siteID string, start, end *time.Time) (string, []any) {
+	args := []any{siteID}
+	clauses := []string{"site_id = ?"}
+	if start != nil {
+		clauses = append(clauses, "placed_at >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "placed_at <= ?")
+		args = append(args, end.UTC())
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func (s *Store) countUsers(ctx context.Context, where string, args []any) (int, error) {
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM users WHERE %s`, where), args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+	return total, nil
+}
+
+func (s *Store) countOrders(ctx context.Context, where string, args []any) (int, error) {
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM orders WHERE %s`, where), args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count orders: %w", err)
+	}
+	return total, nil
+}
+
+// CountUsers returns how many users match the signup_at range without loading any rows.
+func (s *Store) CountUsers(ctx context.Context, siteID string, start, end *time.Time) (int, error) {
+	where, args := usersFilter(siteID, start, end)
+	return s.countUsers(ctx, where, args)
+}
+
+// CountOrders returns how many orders match the placed_at range without loading any rows.
+func (s *Store) CountOrders(ctx context.Context, siteID string, start, end *time.Time) (int, error) {
+	where, args := ordersFilter(siteID, start, end)
+	return s.countOrders(ctx, where, args)
+}
+
+// ListUsers returns paginated user rows filtered by date constraints. NextCursor is set alongside
+// NextPage so a caller can switch to ListUsersAfter from any page.
+func (s *Store) ListUsers(ctx context.Context, siteID string, page, pageSize int, start, end *time.Time) (UserPage, error) {
+	page, pageSize = EnsurePageSize(page, pageSize)
+	where, args := usersFilter(siteID, start, end)
+	total, err := s.countUsers(ctx, where, args)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	offset := (page - 1) * pageSize
+	users, cursors, err := s.queryUserPage(ctx, where, args, pageSize, offset)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	hasMore := offset+len(users) < total
+	pageResp := UserPage{
+		Users:    users,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		HasMore:  hasMore,
+	}
+	if hasMore {
+		n := page + 1
+		pageResp.NextPage = &n
+		pageResp.NextCursor = cursors[len(cursors)-1]
+	}
+	pageResp.setRange(start, end)
+	return pageResp, nil
+}
+
+// ListUsersAfter returns the page of users that follows cursor in the ListUsers order. Unlike
+// offset pages, rows inserted while a caller iterates cannot shift later pages, so nothing is
+// returned twice or skipped. Page is 0 because the position is the cursor.
+func (s *Store) ListUsersAfter(ctx context.Context, siteID, cursor string, pageSize int, start, end *time.Time) (UserPage, error) {
+	_, pageSize = EnsurePageSize(1, pageSize)
+	where, args := usersFilter(siteID, start, end)
+	total, err := s.countUsers(ctx, where, args)
+	if err != nil {
+		return UserPage{}, err
+	}
+	where, args, err = afterCursor(where, args, "signup_at", cursor)
+	if err != nil {
+		return UserPage{}, err
+	}
+	// One extra row tells whether another page follows.
+	users, cursors, err := s.queryUserPage(ctx, where, args, pageSize+1, 0)
+	if err != nil {
+		return UserPage{}, err
+	}
+	pageResp := UserPage{PageSize: pageSize, Total: total}
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		pageResp.HasMore = true
+		pageResp.NextCursor = cursors[pageSize-1]
+	}
+	pageResp.Users = users
+	pageResp.setRange(start, end)
+	return pageResp, nil
+}
+
+// queryUserPage loads one page of users in usersOrderBy order along with the cursor that resumes
+// after each of them.
+func (s *Store) queryUserPage(ctx context.Context, where string, args []any, limit, offset int) ([]User, []string, error) {
+	dataQuery := fmt.Sprintf(`SELECT id, site_id, email, first_name, last_name, signup_at, rowid
+		FROM users WHERE %s ORDER BY %s LIMIT ? OFFSET ?`, where, usersOrderBy)
+	argsWithPaging := append(append([]any{}, args...), limit, offset)
+	rows, err := s.db.QueryContext(ctx, dataQuery, argsWithPaging...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]User, 0, limit)
+	cursors := make([]string, 0, limit)
+	for rows.Next() {
+		var u User
+		var rowID int64
+		if err := rows.Scan(&u.ID, &u.SiteID, &u.Email, &u.FirstName, &u.LastName, &u.SignupAt, &rowID); err != nil {
+			return nil, nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+		cursors = append(cursors, encodeCursor(u.SignupAt, rowID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iter users: %w", err)
+	}
+	return users, cursors, nil
+}
 
+// ListUsersWithoutOrders returns paginated users that have never placed an order,
+// filtered by signup_at range.
+func (s *Store) ListUsersWithoutOrders(ctx context.Context, siteID string, page, pageSize int, start, end *time.Time) (UserPage, error) {
+	page, pageSize = EnsurePageSize(page, pageSize)
+	args := []any{siteID}
+	clauses := []string{"u.site_id = ?", "o.id IS NULL"}
+	if start != nil {
+		clauses = append(clauses, "u.signup_at >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "u.signup_at <= ?")
+		args = append(args, end.UTC())
+	}
 	where := strings.Join(clauses, " AND ")
+	from := `users u LEFT JOIN orders o ON o.user_id = u.id`
 
-	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM users WHERE %s`, where)
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, from, where)
 	var total int
 	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
-		return UserPage{}, fmt.Errorf("count users: %w", err)
+		return UserPage{}, fmt.Errorf("count users without orders: %w", err)
 	}
 
 	offset := (page - 1) * pageSize
-	dataQuery := fmt.Sprintf(`SELECT id, site_id, email, first_name, last_name, signup_at 
-		FROM users WHERE %s ORDER BY signup_at DESC, id LIMIT ? OFFSET ?`, where)
+	dataQuery := fmt.Sprintf(`SELECT u.id, u.site_id, u.email, u.first_name, u.last_name, u.signup_at
+		FROM %s WHERE %s ORDER BY u.signup_at DESC, u.rowid DESC LIMIT ? OFFSET ?`, from, where)
 	argsWithPaging := append(append([]any{}, args...), pageSize, offset)
 	rows, err := s.db.QueryContext(ctx, dataQuery, argsWithPaging...)
 	if err != nil {
-		return UserPage{}, fmt.Errorf("list users: %w", err)
+		return UserPage{}, fmt.Errorf("list users without orders: %w", err)
 	}
 	defer rows.Close()
 
@@ -213,12 +727,6 @@ func (s *Store) ListUsers(ctx context.Context, siteID string, page, pageSize int
 	}
 
 	hasMore := offset+len(users) < total
-	var nextPage *int
-	if hasMore {
-		n := page + 1
-		nextPage = &n
-	}
-
 	pageResp := UserPage{
 		Users:    users,
 		Page:     page,
@@ -227,7 +735,8 @@ func (s *Store) ListUsers(ctx context.Context, siteID string, page, pageSize int
 		HasMore:  hasMore,
 	}
 	if hasMore {
-		pageResp.NextPage = nextPage
+		n := page + 1
+		pageResp.NextPage = &n
 	}
 	if start != nil {
 		pageResp.StartDate = start.Format(time.RFC3339)
@@ -238,34 +747,27 @@ func (s *Store) ListUsers(ctx context.Context, siteID string, page, pageSize int
 	return pageResp, nil
 }
 
-// ListOrders returns paginated orders filtered by placed_at range.
-func (s *Store) ListOrders(ctx context.Context, siteID string, page, pageSize int, start, end *time.Time) (OrderPage, error) {
+// ListLatestOrderPerUser returns each user's most recent order (by placed_at), newest first.
+func (s *Store) ListLatestOrderPerUser(ctx context.Context, siteID string, page, pageSize int) (OrderPage, error) {
 	page, pageSize = EnsurePageSize(page, pageSize)
-	args := []any{siteID}
-	clauses := []string{"site_id = ?"}
-	if start != nil {
-		clauses = append(clauses, "placed_at >= ?")
-		args = append(args, start.UTC())
-	}
-	if end != nil {
-		clauses = append(clauses, "placed_at <= ?")
-		args = append(args, end.UTC())
-	}
-	where := strings.Join(clauses, " AND ")
-
-	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM orders WHERE %s`, where)
 	var total int
-	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
-		return OrderPage{}, fmt.Errorf("count orders: %w", err)
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT user_id) FROM orders WHERE site_id = ?`, siteID,
+	).Scan(&total); err != nil {
+		return OrderPage{}, fmt.Errorf("count users with orders: %w", err)
 	}
 
 	offset := (page - 1) * pageSize
-	dataQuery := fmt.Sprintf(`SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at 
-		FROM orders WHERE %s ORDER BY placed_at DESC, id LIMIT ? OFFSET ?`, where)
-	argsWithPaging := append(append([]any{}, args...), pageSize, offset)
-	rows, err := s.db.QueryContext(ctx, dataQuery, argsWithPaging...)
+	rows, err := s.db.QueryContext(ctx, `WITH ranked AS (
+			SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at, rowid AS rid,
+				ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY placed_at DESC, rowid DESC) AS rn
+			FROM orders WHERE site_id = ?
+		)
+		SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at
+		FROM ranked WHERE rn = 1
+		ORDER BY placed_at DESC, rid DESC LIMIT ? OFFSET ?`, siteID, pageSize, offset)
 	if err != nil {
-		return OrderPage{}, fmt.Errorf("list orders: %w", err)
+		return OrderPage{}, fmt.Errorf("list latest orders per user: %w", err)
 	}
 	defer rows.Close()
 
@@ -282,12 +784,37 @@ func (s *Store) ListOrders(ctx context.Context, siteID string, page, pageSize in
 	}
 
 	hasMore := offset+len(orders) < total
-	var nextPage *int
+	pageResp := OrderPage{
+		Orders:   orders,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		HasMore:  hasMore,
+	}
 	if hasMore {
 		n := page + 1
-		nextPage = &n
+		pageResp.NextPage = &n
+	}
+	return pageResp, nil
+}
+
+// ListOrders returns paginated orders filtered by placed_at range. NextCursor is set alongside
+// NextPage so a caller can switch to ListOrdersAfter from any page.
+func (s *Store) ListOrders(ctx context.Context, siteID string, page, pageSize int, start, end *time.Time) (OrderPage, error) {
+	page, pageSize = EnsurePageSize(page, pageSize)
+	where, args := ordersFilter(siteID, start, end)
+	total, err := s.countOrders(ctx, where, args)
+	if err != nil {
+		return OrderPage{}, err
+	}
+
+	offset := (page - 1) * pageSize
+	orders, cursors, err := s.queryOrderPage(ctx, where, args, pageSize, offset)
+	if err != nil {
+		return OrderPage{}, err
 	}
 
+	hasMore := offset+len(orders) < total
 	resp := OrderPage{
 		Orders:   orders,
 		Page:     page,
@@ -296,7 +823,198 @@ func (s *Store) ListOrders(ctx context.Context, siteID string, page, pageSize in
 		HasMore:  hasMore,
 	}
 	if hasMore {
-		resp.NextPage = nextPage
+		n := page + 1
+		resp.NextPage = &n
+		resp.NextCursor = cursors[len(cursors)-1]
+	}
+	resp.setRange(start, end)
+	return resp, nil
+}
+
+// ListOrdersAfter returns the page of orders that follows cursor in the ListOrders order, with
+// the same guarantees as ListUsersAfter.
+func (s *Store) ListOrdersAfter(ctx context.Context, siteID, cursor string, pageSize int, start, end *time.Time) (OrderPage, error) {
+	_, pageSize = EnsurePageSize(1, pageSize)
+	where, args := ordersFilter(siteID, start, end)
+	total, err := s.countOrders(ctx, where, args)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	where, args, err = afterCursor(where, args, "placed_at", cursor)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	orders, cursors, err := s.queryOrderPage(ctx, where, args, pageSize+1, 0)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	resp := OrderPage{PageSize: pageSize, Total: total}
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		resp.HasMore = true
+		resp.NextCursor = cursors[pageSize-1]
+	}
+	resp.Orders = orders
+	resp.setRange(start, end)
+	return resp, nil
+}
+
+// queryOrderPage loads one page of orders in ordersOrderBy order along with the cursor that
+// resumes after each of them.
+func (s *Store) queryOrderPage(ctx context.Context, where string, args []any, limit, offset int) ([]Order, []string, error) {
+	dataQuery := fmt.Sprintf(`SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at, rowid
+		FROM orders WHERE %s ORDER BY %s LIMIT ? OFFSET ?`, where, ordersOrderBy)
+	argsWithPaging := append(append([]any{}, args...), limit, offset)
+	rows, err := s.db.QueryContext(ctx, dataQuery, argsWithPaging...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := make([]Order, 0, limit)
+	cursors := make([]string, 0, limit)
+	for rows.Next() {
+		var o Order
+		var rowID int64
+		if err := rows.Scan(&o.ID, &o.SiteID, &o.UserID, &o.OrderNumber, &o.TotalAmount, &o.Currency, &o.PlacedAt, &rowID); err != nil {
+			return nil, nil, fmt.Errorf("scan order: %w", err)
+		}
+		orders = append(orders, o)
+		cursors = append(cursors, encodeCursor(o.PlacedAt, rowID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iter orders: %w", err)
+	}
+	return orders, cursors, nil
+}
+
+// afterCursor narrows a listing filter to the rows after cursor in "column DESC, rowid DESC"
+// order. The cursor carries rowid rather than id because rowid is the listings' tie-breaker.
+func afterCursor(where string, args []any, column, cursor string) (string, []any, error) {
+	at, rowID, err := decodeCursor(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	where += fmt.Sprintf(" AND (%[1]s < ? OR (%[1]s = ? AND rowid < ?))", column)
+	return where, append(append([]any{}, args...), at, at, rowID), nil
+}
+
+// setRange echoes the listing's date filters in the page.
+func (p *UserPage) setRange(start, end *time.Time) {
+	if start != nil {
+		p.StartDate = start.Format(time.RFC3339)
+	}
+	if end != nil {
+		p.EndDate = end.Format(time.RFC3339)
+	}
+}
+
+func (p *OrderPage) setRange(start, end *time.Time) {
+	if start != nil {
+		p.StartDate = start.Format(time.RFC3339)
+	}
+	if end != nil {
+		p.EndDate = end.Format(time.RFC3339)
+	}
+}
+
+func encodeCursor(at time.Time, rowID int64) string {
+	raw := fmt.Sprintf("%d:%d", at.UTC().UnixNano(), rowID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	rowID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, n).UTC(), rowID, nil
+}
+
+// ListActivity returns one page of the site's signups and orders merged into a single stream,
+// newest first. The date range applies to signup_at and placed_at respectively. Orders sort ahead
+// of signups at the same instant, since newest-first puts the signup that led to them after.
+func (s *Store) ListActivity(ctx context.Context, siteID string, page, pageSize int, start, end *time.Time) (ActivityPage, error) {
+	page, pageSize = EnsurePageSize(page, pageSize)
+	userWhere, userArgs := usersFilter(siteID, start, end)
+	orderWhere, orderArgs := ordersFilter(siteID, start, end)
+	users, err := s.countUsers(ctx, userWhere, userArgs)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	orders, err := s.countOrders(ctx, orderWhere, orderArgs)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	total := users + orders
+
+	offset := (page - 1) * pageSize
+	dataQuery := fmt.Sprintf(`SELECT type, id, site_id, user_id, email, first_name, last_name,
+			order_number, total_amount, currency, at
+		FROM (
+			SELECT '%s' AS type, id, site_id, id AS user_id, email, first_name, last_name,
+				NULL AS order_number, NULL AS total_amount, NULL AS currency, signup_at AS at, rowid AS rid
+			FROM users WHERE %s
+			UNION ALL
+			SELECT '%s', id, site_id, user_id, NULL, NULL, NULL,
+				order_number, total_amount, currency, placed_at, rowid
+			FROM orders WHERE %s
+		)
+		ORDER BY at DESC, type = '%s' DESC, rid DESC LIMIT ? OFFSET ?`,
+		ActivityTypeSignup, userWhere, ActivityTypeOrder, orderWhere, ActivityTypeOrder)
+	args := append(append(append([]any{}, userArgs...), orderArgs...), pageSize, offset)
+	rows, err := s.db.QueryContext(ctx, dataQuery, args...)
+	if err != nil {
+		return ActivityPage{}, fmt.Errorf("list activity: %w", err)
+	}
+	defer rows.Close()
+
+	activities := make([]Activity, 0, pageSize)
+	for rows.Next() {
+		var (
+			a                          Activity
+			id, rowSiteID, userID      string
+			email, firstName, lastName sql.NullString
+			orderNumber, currency      sql.NullString
+			totalAmount                sql.NullInt64
+		)
+		if err := rows.Scan(&a.Type, &id, &rowSiteID, &userID, &email, &firstName, &lastName,
+			&orderNumber, &totalAmount, &currency, &a.At); err != nil {
+			return ActivityPage{}, fmt.Errorf("scan activity: %w", err)
+		}
+		if a.Type == ActivityTypeSignup {
+			a.User = &User{ID: id, SiteID: rowSiteID, Email: email.String, FirstName: firstName.String, LastName: lastName.String, SignupAt: a.At}
+		} else {
+			a.Order = &Order{ID: id, SiteID: rowSiteID, UserID: userID, OrderNumber: orderNumber.String, TotalAmount: totalAmount.Int64, Currency: currency.String, PlacedAt: a.At}
+		}
+		activities = append(activities, a)
+	}
+	if err := rows.Err(); err != nil {
+		return ActivityPage{}, fmt.Errorf("iter activity: %w", err)
+	}
+
+	resp := ActivityPage{
+		Activities: activities,
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		HasMore:    offset+len(activities) < total,
+	}
+	if resp.HasMore {
+		n := page + 1
+		resp.NextPage = &n
 	}
 	if start != nil {
 		resp.StartDate = start.Format(time.RFC3339)
@@ -307,6 +1025,83 @@ func (s *Store) ListOrders(ctx context.Context, siteID string, page, pageSize in
 	return resp, nil
 }
 
+// IterateUsers walks every user matching the signup_at range with a live cursor, invoking fn
+// per row instead of accumulating pages in memory. Iteration stops at the first callback error
+// or when ctx is cancelled.
+func (s *Store) IterateUsers(ctx context.Context, siteID string, start, end *time.Time, fn func(User) error) error {
+	args := []any{siteID}
+	clauses := []string{"site_id = ?"}
+	if start != nil {
+		clauses = append(clauses, "signup_at >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "signup_at <= ?")
+		args = append(args, end.UTC())
+	}
+	query := fmt.Sprintf(`SELECT id, site_id, email, first_name, last_name, signup_at
+		FROM users WHERE %s ORDER BY %s`, strings.Join(clauses, " AND "), usersOrderBy)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("iterate users: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var u User
+		if err := rows.Scan(&u.ID, &u.SiteID, &u.Email, &u.FirstName, &u.LastName, &u.SignupAt); err != nil {
+			return fmt.Errorf("scan user: %w", err)
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iter users: %w", err)
+	}
+	return nil
+}
+
+// IterateOrders walks every order matching the placed_at range with a live cursor, invoking fn
+// per row. Iteration stops at the first callback error or when ctx is cancelled.
+func (s *Store) IterateOrders(ctx context.Context, siteID string, start, end *time.Time, fn func(Order) error) error {
+	args := []any{siteID}
+	clauses := []string{"site_id = ?"}
+	if start != nil {
+		clauses = append(clauses, "placed_at >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "placed_at <= ?")
+		args = append(args, end.UTC())
+	}
+	query := fmt.Sprintf(`SELECT id, site_id, user_id, order_number, total_amount, currency, placed_at
+		FROM orders WHERE %s ORDER BY %s`, strings.Join(clauses, " AND "), ordersOrderBy)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("iterate orders: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var o Order
+		if err := rows.Scan(&o.ID, &o.SiteID, &o.UserID, &o.OrderNumber, &o.TotalAmount, &o.Currency, &o.PlacedAt); err != nil {
+			return fmt.Errorf("scan order: %w", err)
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iter orders: %w", err)
+	}
+	return nil
+}
+
 var (
 	firstNames = []string{"Alex", "Jordan", "Taylor", "Morgan", "Jamie", "Avery", "Casey", "Dylan", "Riley", "Skyler"}
 	lastNames  = []string{"Kim", "Lee", "Park", "Choi", "Smith", "Garcia", "Williams", "Chen", "Nguyen", "Johnson"}
@@ -319,28 +1114,21 @@ func (s *Store) CreateRandomUser(ctx context.Context, siteID string) (User, erro
 	if _, err := s.GetSite(ctx, siteID); err != nil {
 		return User{}, err
 	}
-	userID := uuid.NewString()
-	first := firstNames[s.rnd.Intn(len(firstNames))]
-	last := lastNames[s.rnd.Intn(len(lastNames))]
-	emailLocal := fmt.Sprintf("%s.%s+%04d", strings.ToLower(first), strings.ToLower(last), s.rnd.Intn(10000))
-	email := fmt.Sprintf("%s@%s", emailLocal, domains[s.rnd.Intn(len(domains))])
-	signupAt := randomTimeInPast(s.rnd, 120*24*time.Hour)
+	user := s.randomUser(siteID)
+	user.SignupAt = s.seeder.signupTime(s.rnd)
 
-	if _, err := s.db.ExecContext(ctx,
-		`INSERT INTO users(id, site_id, email, first_name, last_name, signup_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		userID, siteID, strings.ToLower(email), first, last, signupAt,
-	); err != nil {
-		return User{}, fmt.Errorf("insert user: %w", err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, fmt.Errorf("begin user tx: %w", err)
 	}
-
-	return User{
-		ID:        userID,
-		SiteID:    siteID,
-		Email:     strings.ToLower(email),
-		FirstName: first,
-		LastName:  last,
-		SignupAt:  signupAt,
-	}, nil
+	defer tx.Rollback()
+	if err := insertUser(ctx, tx, user); err != nil {
+		return User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return User{}, fmt.Errorf("commit user: %w", err)
+	}
+	return user, nil
 }
 
 // CreateRandomOrder creates a random order for an existing user in the site.
@@ -352,28 +1140,162 @@ func (s *Store) CreateRandomOrder(ctx context.Context, siteID string) (Order, er
 	if err != nil {
 		return Order{}, fmt.Errorf("pick user: %w", err)
 	}
-	orderID := uuid.NewString()
-	orderNumber := fmt.Sprintf("ORD-%s", strings.ToUpper(uuid.NewString())[:8])
-	total := int64(1000 + s.rnd.Intn(150000))
-	currency := currencies[s.rnd.Intn(len(currencies))]
-	placedAt := randomTimeNear(s.rnd, time.Now().UTC(), 45*24*time.Hour)
+	order := s.randomOrder(siteID, user.ID)
+	order.PlacedAt = randomTimeNear(s.rnd, time.Now().UTC(), 45*24*time.Hour)
 
-	if _, err := s.db.ExecContext(ctx,
-		`INSERT INTO orders(id, site_id, user_id, order_number, total_amount, currency, placed_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		orderID, siteID, user.ID, orderNumber, total, currency, placedAt,
-	); err != nil {
-		return Order{}, fmt.Errorf("insert order: %w", err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Order{}, fmt.Errorf("begin order tx: %w", err)
+	}
+	defer tx.Rollback()
+	if err := insertOrder(ctx, tx, order); err != nil {
+		return Order{}, err
 	}
+	if err := tx.Commit(); err != nil {
+		return Order{}, fmt.Errorf("commit order: %w", err)
+	}
+	return order, nil
+}
+
+// randomUser draws a user's name and email from the seeder pools; the caller sets SignupAt.
+func (s *Store) randomUser(siteID string) User {
+	pools := s.seeder.Pools
+	first := pools.FirstNames[s.rnd.Intn(len(pools.FirstNames))]
+	last := pools.LastNames[s.rnd.Intn(len(pools.LastNames))]
+	emailLocal := fmt.Sprintf("%s.%s+%04d", strings.ToLower(first), strings.ToLower(last), s.rnd.Intn(10000))
+	email := fmt.Sprintf("%s@%s", emailLocal, pools.Domains[s.rnd.Intn(len(pools.Domains))])
+	return User{
+		ID:        s.ids.NewID(),
+		SiteID:    siteID,
+		Email:     strings.ToLower(email),
+		FirstName: first,
+		LastName:  last,
+	}
+}
 
+// randomOrder draws an order amount and currency using the seeder distributions; the caller
+// sets PlacedAt.
+func (s *Store) randomOrder(siteID, userID string) Order {
+	orderID := s.ids.NewID()
+	orderNumber := "ORD-" + strings.ToUpper(s.ids.NewID())
+	if len(orderNumber) > 12 {
+		orderNumber = orderNumber[:12]
+	}
 	return Order{
 		ID:          orderID,
 		SiteID:      siteID,
-		UserID:      user.ID,
+		UserID:      userID,
 		OrderNumber: orderNumber,
-		TotalAmount: total,
-		Currency:    currency,
-		PlacedAt:    placedAt,
-	}, nil
+		TotalAmount: s.seeder.orderAmount(s.rnd),
+		Currency:    currencies[s.rnd.Intn(len(currencies))],
+	}
+}
+
+// insertUser writes u and its changes feed entry within tx.
+func insertUser(ctx context.Context, tx *sql.Tx, u User) error {
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO users(id, site_id, email, first_name, last_name, signup_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		u.ID, u.SiteID, u.Email, u.FirstName, u.LastName, u.SignupAt,
+	); err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
+	return recordChange(ctx, tx, u.SiteID, ChangeTypeUser, u.ID, u.SignupAt)
+}
+
+// insertOrder writes o and its changes feed entry within tx.
+func insertOrder(ctx context.Context, tx *sql.Tx, o Order) error {
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO orders(id, site_id, user_id, order_number, total_amount, currency, placed_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		o.ID, o.SiteID, o.UserID, o.OrderNumber, o.TotalAmount, o.Currency, o.PlacedAt,
+	); err != nil {
+		return fmt.Errorf("insert order: %w", err)
+	}
+	return recordChange(ctx, tx, o.SiteID, ChangeTypeOrder, o.ID, o.PlacedAt)
+}
+
+// recordChange appends a row to the changes feed so consumers can resume from a sequence number.
+func recordChange(ctx context.Context, tx *sql.Tx, siteID, entity, entityID string, changedAt time.Time) error {
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO changes(site_id, entity, entity_id, changed_at) VALUES (?, ?, ?, ?)`,
+		siteID, entity, entityID, changedAt.UTC(),
+	); err != nil {
+		return fmt.Errorf("record change: %w", err)
+	}
+	return nil
+}
+
+// ListChanges returns up to limit changes with seq greater than since, in ascending seq order.
+// Changes whose underlying row has since been deleted are skipped but still advance NextSince.
+func (s *Store) ListChanges(ctx context.Context, siteID string, since int64, limit int) (ChangePage, error) {
+	_, limit = EnsurePageSize(1, limit)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT c.seq, c.entity, c.changed_at,
+			u.id, u.email, u.first_name, u.last_name, u.signup_at,
+			o.id, o.user_id, o.order_number, o.total_amount, o.currency, o.placed_at
+		 FROM changes c
+		 LEFT JOIN users u ON c.entity = 'user' AND u.id = c.entity_id
+		 LEFT JOIN orders o ON c.entity = 'order' AND o.id = c.entity_id
+		 WHERE c.site_id = ? AND c.seq > ?
+		 ORDER BY c.seq LIMIT ?`,
+		siteID, since, limit+1,
+	)
+	if err != nil {
+		return ChangePage{}, fmt.Errorf("list changes: %w", err)
+	}
+	defer rows.Close()
+
+	page := ChangePage{Since: since, NextSince: since, Changes: make([]Change, 0, limit)}
+	seen := 0
+	for rows.Next() {
+		seen++
+		if seen > limit {
+			page.HasMore = true
+			break
+		}
+		var (
+			c                                 Change
+			userID, email, first, last        sql.NullString
+			signupAt, placedAt                sql.NullTime
+			orderID, orderUserID, orderNumber sql.NullString
+			currency                          sql.NullString
+			total                             sql.NullInt64
+		)
+		if err := rows.Scan(&c.Seq, &c.Type, &c.ChangedAt,
+			&userID, &email, &first, &last, &signupAt,
+			&orderID, &orderUserID, &orderNumber, &total, &currency, &placedAt,
+		); err != nil {
+			return ChangePage{}, fmt.Errorf("scan change: %w", err)
+		}
+		page.NextSince = c.Seq
+		switch {
+		case c.Type == ChangeTypeUser && userID.Valid:
+			c.User = &User{
+				ID:        userID.String,
+				SiteID:    siteID,
+				Email:     email.String,
+				FirstName: first.String,
+				LastName:  last.String,
+				SignupAt:  signupAt.Time,
+			}
+		case c.Type == ChangeTypeOrder && orderID.Valid:
+			c.Order = &Order{
+				ID:          orderID.String,
+				SiteID:      siteID,
+				UserID:      orderUserID.String,
+				OrderNumber: orderNumber.String,
+				TotalAmount: total.Int64,
+				Currency:    currency.String,
+				PlacedAt:    placedAt.Time,
+			}
+		default:
+			continue
+		}
+		page.Changes = append(page.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return ChangePage{}, fmt.Errorf("iter changes: %w", err)
+	}
+	return page, nil
 }
 
 func (s *Store) pickRandomUser(ctx context.Context, siteID string) (User, error) {
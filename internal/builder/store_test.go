@@ -0,0 +1,151 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// insertUsers writes users in order through the same path as the seeder.
+func insertUsers(t *testing.T, store *Store, users ...User) {
+	t.Helper()
+	tx, err := store.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	for _, u := range users {
+		if err := insertUser(context.Background(), tx, u); err != nil {
+			t.Fatalf("insert user %s: %v", u.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+func TestListChangesResumesFromSeq(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	site, err := store.CreateSite(ctx, "shop")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	for range 2 {
+		if _, err := store.CreateRandomUser(ctx, site.ID); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	if _, err := store.CreateRandomOrder(ctx, site.ID); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	first, err := store.ListChanges(ctx, site.ID, 0, 2)
+	if err != nil {
+		t.Fatalf("list changes: %v", err)
+	}
+	if len(first.Changes) != 2 || !first.HasMore || first.NextSince != first.Changes[1].Seq {
+		t.Fatalf("first page = %+v, want 2 changes with more to come", first)
+	}
+	rest, err := store.ListChanges(ctx, site.ID, first.NextSince, 2)
+	if err != nil {
+		t.Fatalf("list changes since %d: %v", first.NextSince, err)
+	}
+	if len(rest.Changes) != 1 || rest.HasMore || rest.Changes[0].Type != ChangeTypeOrder || rest.Changes[0].Order == nil {
+		t.Fatalf("second page = %+v, want the order change only", rest)
+	}
+	if rest.Changes[0].Seq <= first.NextSince {
+		t.Fatalf("second page repeats seq %d", rest.Changes[0].Seq)
+	}
+}
+
+func TestListUsersBreaksTiesOnInsertionOrder(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	site, err := store.CreateSite(ctx, "shop")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	at := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	// IDs sort differently from insertion order, so an ID tie-break would reorder them.
+	var users []User
+	for _, id := range []string{"c", "a", "b"} {
+		users = append(users, User{ID: id, SiteID: site.ID, Email: id + "@example.com", SignupAt: at})
+	}
+	insertUsers(t, store, users...)
+
+	for _, pageSize := range []int{1, 3} {
+		var got []string
+		for page := 1; len(got) < 3; page++ {
+			result, err := store.ListUsers(ctx, site.ID, page, pageSize, nil, nil)
+			if err != nil {
+				t.Fatalf("list users page %d: %v", page, err)
+			}
+			if len(result.Users) == 0 {
+				break
+			}
+			for _, u := range result.Users {
+				got = append(got, u.ID)
+			}
+		}
+		if want := []string{"b", "a", "c"}; !slices.Equal(got, want) {
+			t.Fatalf("page size %d: order %v, want newest inserted first %v", pageSize, got, want)
+		}
+	}
+}
+
+func TestListUsersAfterCursorIgnoresNewerInserts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	site, err := store.CreateSite(ctx, "shop")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	at := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	var users []User
+	for i, id := range []string{"a", "b", "c", "d"} {
+		// b and c share a timestamp so the cursor has to break the tie on rowid.
+		signup := at.Add(time.Duration(min(i, 2)) * time.Hour)
+		if id == "d" {
+			signup = at.Add(3 * time.Hour)
+		}
+		users = append(users, User{ID: id, SiteID: site.ID, Email: id + "@example.com", SignupAt: signup})
+	}
+	insertUsers(t, store, users...)
+
+	first, err := store.ListUsers(ctx, site.ID, 1, 1, nil, nil)
+	if err != nil {
+		t.Fatalf("list users: %v", err)
+	}
+	if len(first.Users) != 1 || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, want one user and a cursor", first)
+	}
+	got := []string{first.Users[0].ID}
+
+	// A user signing up mid-walk would shift every offset page by one.
+	insertUsers(t, store, User{ID: "e", SiteID: site.ID, Email: "e@example.com", SignupAt: at.Add(4 * time.Hour)})
+
+	cursor := first.NextCursor
+	for cursor != "" {
+		result, err := store.ListUsersAfter(ctx, site.ID, cursor, 1, nil, nil)
+		if err != nil {
+			t.Fatalf("list users after %q: %v", cursor, err)
+		}
+		for _, u := range result.Users {
+			got = append(got, u.ID)
+		}
+		if result.HasMore != (result.NextCursor != "") {
+			t.Fatalf("page %+v: has_more disagrees with next_cursor", result)
+		}
+		cursor = result.NextCursor
+	}
+	if want := []string{"d", "c", "b", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("walk = %v, want %v", got, want)
+	}
+
+	if _, err := store.ListUsersAfter(ctx, site.ID, "not-a-cursor", 1, nil, nil); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("malformed cursor error = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Package config resolves the worker and builder startup configuration from command-line flags,
+// environment variables, and defaults, in that order of precedence.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"go.temporal.io/sdk/client"
+
+	"example.com/temporal-go/internal/builder"
+	"example.com/temporal-go/internal/worker"
+)
+
+// LoadWorker parses args (typically os.Args[1:]) into a worker.Config. A flag given in args wins;
+// otherwise the setting's environment variable is used when non-empty; otherwise the default.
+// getenv is usually os.Getenv. flag.ErrHelp is returned for -h.
+func LoadWorker(args []string, getenv func(string) string) (worker.Config, error) {
+	cfg := worker.Config{AutoSyncInterval: 10 * time.Minute, TaskQueue: worker.SyncTaskQueue()}
+	l := newLoader("worker")
+	l.stringVar(&cfg.DBPath, "db", "WORKER_DB", "events.db", "path to the worker sqlite database file")
+	l.stringVar(&cfg.Addr, "addr", "WORKER_ADDR", ":8082", "HTTP listen address for the worker API")
+	l.stringVar(&cfg.TemporalAddress, "temporal", "TEMPORAL_ADDRESS", client.DefaultHostPort, "Temporal service address")
+	l.stringVar(&cfg.TemporalNamespace, "temporal-namespace", "TEMPORAL_NAMESPACE", client.DefaultNamespace, "Temporal namespace the sync workflows run in")
+	l.durationVar(&cfg.EventRetention, "event-retention", "WORKER_EVENT_RETENTION", 0, "delete events older than this duration (0 keeps them unless a site sets event_retention)")
+	l.durationVar(&cfg.RetentionInterval, "retention-interval", "WORKER_RETENTION_INTERVAL", time.Hour, "how often the event retention purge runs")
+	l.durationVar(&cfg.CompactWindow, "compact-window", "WORKER_COMPACT_WINDOW", 0, fmt.Sprintf("collapse a user's repeats of the same event within this window to the earliest (0 disables, max %s)", worker.MaxCompactionWindow))
+	l.durationVar(&cfg.CompactInterval, "compact-interval", "WORKER_COMPACT_INTERVAL", time.Hour, "how often event compaction runs")
+	l.boolVar(&cfg.CompactDryRun, "compact-dry-run", "WORKER_COMPACT_DRY_RUN", false, "log what event compaction would collapse without deleting anything")
+	l.stringVar(&cfg.AdminToken, "admin-token", "WORKER_ADMIN_TOKEN", "", "token required in X-Admin-Token on cross-site admin endpoints (unset disables them)")
+	l.stringVar(&cfg.EventSinkURL, "event-sink-url", "EVENT_SINK_URL", "", "optional HTTP endpoint that receives every inserted event as JSON")
+	l.intVar(&cfg.EventSinkRetries, "event-sink-retries", "WORKER_EVENT_SINK_RETRIES", 2, "retries per event when the HTTP event sink fails")
+	l.intVar(&cfg.MaxPropertiesBytes, "max-properties-bytes", "WORKER_MAX_PROPERTIES_BYTES", worker.DefaultMaxPropertiesBytes, "maximum serialized size of event properties (0 disables the cap)")
+	l.stringVar(&cfg.DedupeScope, "dedupe-scope", "WORKER_DEDUPE_SCOPE", worker.DedupeScopeKey, "event idempotency scope: key (dedupe_key is unique) or source (unique per dedupe_key and utm_source)")
+	l.durationVar(&cfg.AutoSyncDelay, "autosync-delay", "WORKER_AUTOSYNC_DELAY", 0, "wait this long before the first autosync sweep (0 starts immediately)")
+	l.durationVar(&cfg.AutoSyncJitter, "autosync-jitter", "WORKER_AUTOSYNC_JITTER", 0, "add a random delay up to this duration before the first autosync sweep")
+	l.stringVar(&cfg.AutoSyncMode, "autosync-mode", "WORKER_AUTOSYNC_MODE", worker.AutoSyncModeTicker, "how autosync is scheduled: ticker (in-process timer) or cron (per-site Temporal cron workflows that survive restarts)")
+	l.stringVar(&cfg.AutoSyncCron, "autosync-cron", "WORKER_AUTOSYNC_CRON", worker.DefaultAutoSyncCron, "cron expression of the per-site autosync workflows in cron mode")
+	l.intVar(&cfg.BreakerFailures, "builder-breaker-failures", "WORKER_BUILDER_BREAKER_FAILURES", 5, "consecutive builder failures that open the circuit breaker (0 disables it)")
+	l.durationVar(&cfg.BreakerCooldown, "builder-breaker-cooldown", "WORKER_BUILDER_BREAKER_COOLDOWN", 30*time.Second, "how long an open builder circuit fails fast before probing again")
+	l.stringVar(&cfg.BuilderRedirectPolicy, "builder-redirect-policy", "WORKER_BUILDER_REDIRECT_POLICY", worker.RedirectPolicyStrip, "builder redirects to another host: strip (follow without X-Access-Key) or deny (fail the request)")
+	l.stringVar(&cfg.ExchangeRates, "exchange-rates", "EXCHANGE_RATES", "", "static currency rates for revenue normalization, e.g. USD=1,KRW=0.00073,JPY=0.0067")
+	l.durationVar(&cfg.WatermarkStaleAfter, "watermark-stale-after", "WORKER_WATERMARK_STALE_AFTER", 0, "warn when a site's sync watermark has not advanced for this long (0 disables the check)")
+	l.durationVar(&cfg.WatermarkCheckInterval, "watermark-check-interval", "WORKER_WATERMARK_CHECK_INTERVAL", 15*time.Minute, "how often sync watermarks are checked for staleness")
+	l.intVar(&cfg.SyncPageConcurrency, "sync-page-concurrency", "WORKER_SYNC_PAGE_CONCURRENCY", 1, fmt.Sprintf("user/order pages a sync fetches in parallel (1 is serial, max %d)", worker.MaxSyncPageConcurrency))
+	l.intVar(&cfg.BuilderPageSize, "builder-page-size", "WORKER_BUILDER_PAGE_SIZE", 10, fmt.Sprintf("users/orders per page requested from the builder (max %d; the builder must allow it with --max-page-size)", worker.MaxBuilderPageSize))
+	l.boolVar(&cfg.CaseInsensitiveSiteIDs, "case-insensitive-site-ids", "WORKER_CASE_INSENSITIVE_SITE_IDS", false, "match registered site_id values ignoring case")
+	l.boolVar(&cfg.TemporalMetrics, "temporal-metrics", "WORKER_TEMPORAL_METRICS", false, "record Temporal activity and workflow execution metrics at /worker/debug/metrics")
+	l.intVar(&cfg.SkipLogSample, "skip-log-sample", "WORKER_SKIP_LOG_SAMPLE", 0, "log 1 in N sync events skipped as duplicates (0 logs only per-page totals)")
+	l.stringVar(&cfg.SuppressAttribution, "suppress-attribution", "WORKER_SUPPRESS_ATTRIBUTION", "", "comma-separated event names synced without utm_source attribution on every site, e.g. signup")
+	l.stringVar(&cfg.AttributionModel, "attribution-model", "WORKER_ATTRIBUTION_MODEL", worker.AttributionModelLast, "touch synced events are attributed to on sites without an attribution_model flag: last or first")
+	l.durationVar(&cfg.ShutdownTimeout, "shutdown-timeout", "WORKER_SHUTDOWN_TIMEOUT", 5*time.Second, "how long to drain HTTP requests, the Temporal worker, and background loops on shutdown")
+	if err := l.parse(args, getenv); err != nil {
+		return worker.Config{}, err
+	}
+	return cfg, validateWorker(cfg)
+}
+
+func validateWorker(cfg worker.Config) error {
+	var errs []error
+	errs = append(errs, required("db", cfg.DBPath), required("addr", cfg.Addr), required("temporal", cfg.TemporalAddress), required("temporal-namespace", cfg.TemporalNamespace))
+	if cfg.DedupeScope != worker.DedupeScopeKey && cfg.DedupeScope != worker.DedupeScopeSource {
+		errs = append(errs, fmt.Errorf("dedupe-scope: must be %q or %q", worker.DedupeScopeKey, worker.DedupeScopeSource))
+	}
+	if cfg.AttributionModel != worker.AttributionModelLast && cfg.AttributionModel != worker.AttributionModelFirst {
+		errs = append(errs, fmt.Errorf("attribution-model: must be %q or %q", worker.AttributionModelLast, worker.AttributionModelFirst))
+	}
+	switch cfg.AutoSyncMode {
+	case worker.AutoSyncModeTicker:
+	case worker.AutoSyncModeCron:
+		errs = append(errs, required("autosync-cron", cfg.AutoSyncCron))
+	default:
+		errs = append(errs, fmt.Errorf("autosync-mode: must be %q or %q", worker.AutoSyncModeTicker, worker.AutoSyncModeCron))
+	}
+	errs = append(errs,
+		nonNegative("event-retention", cfg.EventRetention),
+		positive("retention-interval", cfg.RetentionInterval),
+		nonNegative("compact-window", cfg.CompactWindow),
+		positive("compact-interval", cfg.CompactInterval),
+		nonNegative("autosync-delay", cfg.AutoSyncDelay),
+		nonNegative("autosync-jitter", cfg.AutoSyncJitter),
+		positive("builder-breaker-cooldown", cfg.BreakerCooldown),
+		nonNegative("watermark-stale-after", cfg.WatermarkStaleAfter),
+		positive("watermark-check-interval", cfg.WatermarkCheckInterval),
+		positive("shutdown-timeout", cfg.ShutdownTimeout),
+	)
+	if cfg.CompactWindow > worker.MaxCompactionWindow {
+		errs = append(errs, fmt.Errorf("compact-window: must be at most %s", worker.MaxCompactionWindow))
+	}
+	if err := worker.ValidateRedirectPolicy(cfg.BuilderRedirectPolicy); err != nil {
+		errs = append(errs, fmt.Errorf("builder-redirect-policy: %w", err))
+	}
+	if cfg.EventSinkRetries < 0 {
+		errs = append(errs, errors.New("event-sink-retries: must not be negative"))
+	}
+	if cfg.BreakerFailures < 0 {
+		errs = append(errs, errors.New("builder-breaker-failures: must not be negative"))
+	}
+	if cfg.ExchangeRates != "" {
+		if _, err := worker.ParseExchangeRates(cfg.ExchangeRates); err != nil {
+			errs = append(errs, fmt.Errorf("exchange-rates: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadBuilder is LoadWorker for the builder binary.
+func LoadBuilder(args []string, getenv func(string) string) (builder.Config, error) {
+	var cfg builder.Config
+	l := newLoader("builder")
+	l.stringVar(&cfg.DBPath, "db", "BUILDER_DB", "builder.db", "path to the builder sqlite database file")
+	l.stringVar(&cfg.Addr, "addr", "BUILDER_ADDR", ":8081", "HTTP listen address for the builder API")
+	l.stringVar(&cfg.AdminToken, "admin-token", "BUILDER_ADMIN_TOKEN", "", "token required in X-Admin-Token to reveal site access keys (unset disables the reveal endpoint)")
+	l.stringVar(&cfg.SeedAmounts, "seed-amounts", "BUILDER_SEED_AMOUNTS", builder.AmountsUniform, "order amount distribution for seeded orders: uniform or lognormal")
+	l.stringVar(&cfg.SeedSignups, "seed-signups", "BUILDER_SEED_SIGNUPS", builder.SignupsUniform, "signup time distribution for seeded users: uniform or recent")
+	l.stringVar(&cfg.SeedPools, "seed-pools", "BUILDER_SEED_POOLS", "", "optional JSON file with first_names, last_names, and domains pools for seeded users")
+	l.int64Var(&cfg.Seed, "seed", "BUILDER_SEED", 0, "fixed random seed for reproducible seeded data (0 seeds from the clock)")
+	l.boolVar(&cfg.DevMode, "dev", "BUILDER_DEV", false, "enable test-only hooks such as ?delay_ms= on the user/order list endpoints; never use in production")
+	l.intVar(&cfg.MaxPageSize, "max-page-size", "BUILDER_MAX_PAGE_SIZE", 10, fmt.Sprintf("largest page_size the list endpoints serve (default page size stays 10, max %d)", builder.MaxPageSizeCeiling))
+	l.durationVar(&cfg.ShutdownTimeout, "shutdown-timeout", "BUILDER_SHUTDOWN_TIMEOUT", 5*time.Second, "how long to drain in-flight requests on shutdown")
+	if err := l.parse(args, getenv); err != nil {
+		return builder.Config{}, err
+	}
+	return cfg, validateBuilder(cfg)
+}
+
+func validateBuilder(cfg builder.Config) error {
+	errs := []error{required("db", cfg.DBPath), required("addr", cfg.Addr), positive("shutdown-timeout", cfg.ShutdownTimeout)}
+	// Pools are loaded from seed-pools later, so only the distributions are checked here.
+	seeder := builder.SeederConfig{Amounts: cfg.SeedAmounts, Signups: cfg.SeedSignups}
+	if err := seeder.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func required(name, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s: required", name)
+	}
+	return nil
+}
+
+func nonNegative(name string, d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s: must not be negative", name)
+	}
+	return nil
+}
+
+func positive(name string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s: must be positive", name)
+	}
+	return nil
+}
+
+// loader registers flags together with the environment variable that backs each one.
+type loader struct {
+	fs   *flag.FlagSet
+	envs []binding
+}
+
+type binding struct {
+	flag string
+	env  string
+}
+
+func newLoader(name string) *loader {
+	return &loader{fs: flag.NewFlagSet(name, flag.ContinueOnError)}
+}
+
+func (l *loader) bind(name, env, usage string) string {
+	l.envs = append(l.envs, binding{flag: name, env: env})
+	return fmt.Sprintf("%s (env %s)", usage, env)
+}
+
+func (l *loader) stringVar(p *string, name, env, def, usage string) {
+	l.fs.StringVar(p, name, def, l.bind(name, env, usage))
+}
+
+func (l *loader) intVar(p *int, name, env string, def int, usage string) {
+	l.fs.IntVar(p, name, def, l.bind(name, env, usage))
+}
+
+func (l *loader) int64Var(p *int64, name, env string, def int64, usage string) {
+	l.fs.Int64Var(p, name, def, l.bind(name, env, usage))
+}
+
+func (l *loader) boolVar(p *bool, name, env string, def bool, usage string) {
+	l.fs.BoolVar(p, name, def, l.bind(name, env, usage))
+}
+
+func (l *loader) durationVar(p *time.Duration, name, env string, def time.Duration, usage string) {
+	l.fs.DurationVar(p, name, def, l.bind(name, env, usage))
+}
+
+// parse applies args, then fills every flag that was not given explicitly from its environment
+// variable. Env values go through the same flag parsing, so "30s" or "true" work as on the
+// command line.
+func (l *loader) parse(args []string, getenv func(string) string) error {
+	if err := l.fs.Parse(args); err != nil {
+		return err
+	}
+	explicit := map[string]bool{}
+	l.fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, b := range l.envs {
+		if explicit[b.flag] {
+			continue
+		}
+		v := getenv(b.env)
+		if v == "" {
+			continue
+		}
+		if err := l.fs.Set(b.flag, v); err != nil {
+			return fmt.Errorf("%s=%q: invalid value for -%s: %w", b.env, v, b.flag, err)
+		}
+	}
+	return nil
+}
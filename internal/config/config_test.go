@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv over vars.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadWorkerPrecedence(t *testing.T) {
+	cfg, err := LoadWorker(nil, env(nil))
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	if cfg.Addr != ":8082" || cfg.DBPath != "events.db" || cfg.AutoSyncInterval != 10*time.Minute {
+		t.Fatalf("defaults = addr %q db %q autosync %s", cfg.Addr, cfg.DBPath, cfg.AutoSyncInterval)
+	}
+
+	vars := env(map[string]string{"WORKER_ADDR": ":9000", "WORKER_RETENTION_INTERVAL": "5m"})
+	cfg, err = LoadWorker(nil, vars)
+	if err != nil {
+		t.Fatalf("load from env: %v", err)
+	}
+	if cfg.Addr != ":9000" || cfg.RetentionInterval != 5*time.Minute {
+		t.Fatalf("env values = addr %q retention interval %s", cfg.Addr, cfg.RetentionInterval)
+	}
+
+	cfg, err = LoadWorker([]string{"-addr", ":7000"}, vars)
+	if err != nil {
+		t.Fatalf("load with flag: %v", err)
+	}
+	if cfg.Addr != ":7000" || cfg.RetentionInterval != 5*time.Minute {
+		t.Fatalf("flag over env = addr %q retention interval %s", cfg.Addr, cfg.RetentionInterval)
+	}
+}
+
+func TestLoadWorkerRejectsInvalidValues(t *testing.T) {
+	_, err := LoadWorker(nil, env(map[string]string{"WORKER_RETENTION_INTERVAL": "soon"}))
+	if err == nil || !strings.Contains(err.Error(), "WORKER_RETENTION_INTERVAL") {
+		t.Fatalf("unparsable env value: err %v, want it to name the variable", err)
+	}
+	_, err = LoadWorker([]string{"-dedupe-scope", "global", "-retention-interval", "0s", "-attribution-model", "middle"}, env(nil))
+	if err == nil || !strings.Contains(err.Error(), "dedupe-scope") || !strings.Contains(err.Error(), "retention-interval") || !strings.Contains(err.Error(), "attribution-model") {
+		t.Fatalf("invalid flags: err %v, want every problem reported", err)
+	}
+}
+
+func TestLoadBuilder(t *testing.T) {
+	cfg, err := LoadBuilder([]string{"-addr", ":7001"}, env(map[string]string{"BUILDER_ADMIN_TOKEN": "secret", "BUILDER_ADDR": ":9001"}))
+	if err != nil {
+		t.Fatalf("load builder: %v", err)
+	}
+	if cfg.Addr != ":7001" || cfg.AdminToken != "secret" || cfg.DBPath != "builder.db" {
+		t.Fatalf("builder config = addr %q admin token %q db %q", cfg.Addr, cfg.AdminToken, cfg.DBPath)
+	}
+	if _, err := LoadBuilder([]string{"-seed-amounts", "bimodal"}, env(nil)); err == nil {
+		t.Fatal("unknown seed distribution: want error")
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry aggregates duration observations in-process, keyed by metric name and labels.
+// It is intentionally tiny: enough to answer "which upstream is slow" from a debug endpoint
+// without pulling in a full metrics stack.
+type Registry struct {
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	name   string
+	labels map[string]string
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// Sample is a point-in-time view of one series.
+type Sample struct {
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Count   int64             `json:"count"`
+	TotalMS float64           `json:"total_ms"`
+	AvgMS   float64           `json:"avg_ms"`
+	MaxMS   float64           `json:"max_ms"`
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{series: map[string]*series{}}
+}
+
+// Observe records one duration for the series identified by name and labels.
+// Calling Observe on a nil registry is a no-op so callers need not guard optional metrics.
+func (r *Registry) Observe(name string, labels map[string]string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	key := seriesKey(name, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.series[key]
+	if !ok {
+		copied := make(map[string]string, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &series{name: name, labels: copied}
+		r.series[key] = s
+	}
+	s.count++
+	s.sum += d
+	if d > s.max {
+		s.max = d
+	}
+}
+
+// Snapshot returns every series sorted by name and labels.
+func (r *Registry) Snapshot() []Sample {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.series))
+	for k := range r.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	samples := make([]Sample, 0, len(keys))
+	for _, k := range keys {
+		s := r.series[k]
+		sample := Sample{
+			Name:    s.name,
+			Labels:  s.labels,
+			Count:   s.count,
+			TotalMS: toMillis(s.sum),
+			MaxMS:   toMillis(s.max),
+		}
+		if s.count > 0 {
+			sample.AvgMS = sample.TotalMS / float64(s.count)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// StatusClass buckets an HTTP status code as "2xx", "4xx", etc.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return string(rune('0'+code/100)) + "xx"
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,203 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+)
+
+// Autosync modes. The ticker mode dispatches a one-off workflow per site on an in-process
+// timer; the cron mode hands each site's schedule to the Temporal server, so it survives worker
+// restarts.
+const (
+	AutoSyncModeTicker = "ticker"
+	AutoSyncModeCron   = "cron"
+)
+
+// DefaultAutoSyncCron matches the ticker's default 10-minute interval.
+const DefaultAutoSyncCron = "*/10 * * * *"
+
+// ErrSyncAlreadyScheduled is returned by ScheduleSync when the site already has a cron workflow
+// on the requested expression.
+var ErrSyncAlreadyScheduled = errors.New("sync already scheduled")
+
+// autoSyncWorkflowID is the ID of a site's cron autosync workflow. It is fixed per site, so
+// scheduling a site twice cannot start a second schedule.
+func autoSyncWorkflowID(siteID string) string {
+	return "autosync-" + siteID
+}
+
+// cronSyncOptions are the start options of a site's cron autosync workflow. Temporal starts a run
+// on every tick of cron once the previous run has finished; the run timeout applies per run.
+func cronSyncOptions(siteID, cron string) client.StartWorkflowOptions {
+	return client.StartWorkflowOptions{
+		ID:                                       autoSyncWorkflowID(siteID),
+		TaskQueue:                                syncTaskQueue,
+		CronSchedule:                             cron,
+		WorkflowRunTimeout:                       30 * time.Minute,
+		WorkflowExecutionErrorWhenAlreadyStarted: true,
+		TypedSearchAttributes:                    syncSearchAttributes(siteID),
+	}
+}
+
+// ScheduleSync starts input as a cron workflow for its site. A site that already has one on the
+// same expression keeps it and gets ErrSyncAlreadyScheduled along with the existing workflow ID.
+// One on a different expression is terminated and started again on cron.
+func (o *TemporalOrchestrator) ScheduleSync(ctx context.Context, input SyncWorkflowInput, cron string) (string, error) {
+	id, err := o.startCronSync(ctx, input, cron)
+	if !errors.Is(err, ErrSyncAlreadyScheduled) {
+		return id, err
+	}
+	current, err := o.scheduledCron(ctx, id)
+	if err != nil {
+		o.logger.Error("read workflow schedule failed", "workflow_id", id, "site_id", input.SiteID, "error", err)
+		return "", err
+	}
+	if current == cron {
+		return id, ErrSyncAlreadyScheduled
+	}
+	if err := o.client.TerminateWorkflow(ctx, id, "", "autosync rescheduled"); err != nil {
+		var notFound *serviceerror.NotFound
+		if !errors.As(err, &notFound) {
+			return "", err
+		}
+	}
+	o.logger.Info("workflow rescheduling", "workflow_id", id, "site_id", input.SiteID, "from_cron", current, "cron", cron)
+	return o.startCronSync(ctx, input, cron)
+}
+
+// startCronSync starts the cron workflow of input's site, returning ErrSyncAlreadyScheduled when
+// one is already running.
+func (o *TemporalOrchestrator) startCronSync(ctx context.Context, input SyncWorkflowInput, cron string) (string, error) {
+	we, err := o.client.ExecuteWorkflow(ctx, cronSyncOptions(input.SiteID, cron), SyncSiteWorkflow, input)
+	if err != nil {
+		var started *serviceerror.WorkflowExecutionAlreadyStarted
+		if errors.As(err, &started) {
+			return autoSyncWorkflowID(input.SiteID), ErrSyncAlreadyScheduled
+		}
+		o.logger.Error("schedule workflow failed", "site_id", input.SiteID, "cron", cron, "error", err)
+		return "", err
+	}
+	o.logger.Info("workflow scheduled", "workflow_id", we.GetID(), "run_id", we.GetRunID(), "site_id", input.SiteID, "cron", cron)
+	return we.GetID(), nil
+}
+
+// scheduledCron returns the cron expression the running workflowID was started with. Every cron
+// run records it in its first history event.
+func (o *TemporalOrchestrator) scheduledCron(ctx context.Context, workflowID string) (string, error) {
+	iter := o.client.GetWorkflowHistory(ctx, workflowID, "", false, enums.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	if !iter.HasNext() {
+		return "", fmt.Errorf("workflow %s has no history", workflowID)
+	}
+	event, err := iter.Next()
+	if err != nil {
+		return "", err
+	}
+	return event.GetWorkflowExecutionStartedEventAttributes().GetCronSchedule(), nil
+}
+
+// UnscheduleSync terminates a site's cron workflow, ending its schedule along with any run in
+// flight. A site without one is not an error.
+func (o *TemporalOrchestrator) UnscheduleSync(ctx context.Context, siteID string) error {
+	err := o.client.TerminateWorkflow(ctx, autoSyncWorkflowID(siteID), "", "autosync unscheduled")
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+	o.logger.Info("workflow unscheduled", "workflow_id", autoSyncWorkflowID(siteID), "site_id", siteID)
+	return nil
+}
+
+// StartAutoSyncCron is the cron-mode alternative to StartAutoSync: it schedules a Temporal cron
+// workflow for every site with autosync enabled and unschedules the ones with it disabled. From
+// then on registering or unregistering a site, or changing its autosync flag, updates its
+// schedule too.
+func (s *Server) StartAutoSyncCron(ctx context.Context, cron string) {
+	s.autoSyncCron = cron
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.logger.Info("autosync cron scheduling", "cron", cron)
+		s.dispatchAllSites(ctx, "autosync-cron")
+	}()
+}
+
+// unscheduleCronSyncs terminates the cron workflows of every registered site. Ticker mode runs
+// it at startup, so schedules left behind by an earlier cron-mode worker do not keep syncing
+// alongside the ticker.
+func (s *Server) unscheduleCronSyncs(ctx context.Context) {
+	if s.orchestrator == nil {
+		return
+	}
+	sites, err := s.store.ListSites(ctx)
+	if err != nil {
+		s.logger.Error("autosync cron cleanup list sites failed", "error", err)
+		return
+	}
+	for _, site := range sites {
+		if err := s.orchestrator.UnscheduleSync(ctx, site.SiteID); err != nil {
+			s.logger.Error("autosync unschedule failed", "site_id", site.SiteID, "error", err)
+		}
+	}
+}
+
+// autoSyncInput is the workflow input of an autosync run for siteID.
+func autoSyncInput(siteID, reason string) SyncWorkflowInput {
+	return SyncWorkflowInput{
+		SiteID:        siteID,
+		IncludeUsers:  true,
+		IncludeOrders: true,
+		Page:          1,
+		Reason:        reason,
+	}
+}
+
+// startAutoSync dispatches one autosync for a site: a one-off workflow in ticker mode, or the
+// site's cron workflow in cron mode, where an existing schedule counts as dispatched.
+func (s *Server) startAutoSync(ctx context.Context, input SyncWorkflowInput) (string, error) {
+	if s.autoSyncCron == "" {
+		return s.orchestrator.RunSyncAsync(ctx, input)
+	}
+	id, err := s.orchestrator.ScheduleSync(ctx, input, s.autoSyncCron)
+	if errors.Is(err, ErrSyncAlreadyScheduled) {
+		return id, nil
+	}
+	return id, err
+}
+
+// reconcileAutoSyncSchedule brings a site's cron workflow in line with its autosync flag. It does
+// nothing outside cron mode, and failures are logged rather than returned so the request that
+// triggered it still succeeds.
+func (s *Server) reconcileAutoSyncSchedule(ctx context.Context, siteID string) {
+	if s.autoSyncCron == "" || s.orchestrator == nil {
+		return
+	}
+	if enabled, _ := strconv.ParseBool(s.flagValue(ctx, siteID, FlagAutoSync)); !enabled {
+		s.unscheduleAutoSync(ctx, siteID)
+		return
+	}
+	if _, err := s.startAutoSync(ctx, autoSyncInput(siteID, "autosync-cron")); err != nil {
+		s.logger.Error("autosync schedule failed", "site_id", siteID, "error", err)
+	}
+}
+
+// unscheduleAutoSync removes the cron workflows of siteIDs in cron mode.
+func (s *Server) unscheduleAutoSync(ctx context.Context, siteIDs ...string) {
+	if s.autoSyncCron == "" || s.orchestrator == nil {
+		return
+	}
+	for _, siteID := range siteIDs {
+		if err := s.orchestrator.UnscheduleSync(ctx, siteID); err != nil {
+			s.logger.Error("autosync unschedule failed", "site_id", siteID, "error", err)
+		}
+	}
+}
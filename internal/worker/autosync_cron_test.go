@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+)
+
+func TestCronSyncOptions(t *testing.T) {
+	opts := cronSyncOptions("s1", "*/5 * * * *")
+	require.Equal(t, "autosync-s1", opts.ID)
+	require.Equal(t, "*/5 * * * *", opts.CronSchedule)
+	require.Equal(t, syncTaskQueue, opts.TaskQueue)
+	require.True(t, opts.WorkflowExecutionErrorWhenAlreadyStarted)
+}
+
+// startedWithCron returns a history iterator whose first event is a run started on cron.
+func startedWithCron(t *testing.T, cron string) *mocks.HistoryEventIterator {
+	iter := mocks.NewHistoryEventIterator(t)
+	iter.On("HasNext").Return(true)
+	iter.On("Next").Return(&historypb.HistoryEvent{
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+			WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{CronSchedule: cron},
+		},
+	}, nil)
+	return iter
+}
+
+func TestScheduleSyncKeepsMatchingCron(t *testing.T) {
+	c := mocks.NewClient(t)
+	c.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, serviceerror.NewWorkflowExecutionAlreadyStarted("running", "", "r1")).Once()
+	c.On("GetWorkflowHistory", mock.Anything, "autosync-s1", "", false, mock.Anything).
+		Return(startedWithCron(t, "*/10 * * * *"))
+	o := NewTemporalOrchestrator(c, discardLogger())
+
+	id, err := o.ScheduleSync(context.Background(), autoSyncInput("s1", "autosync-cron"), "*/10 * * * *")
+	require.ErrorIs(t, err, ErrSyncAlreadyScheduled)
+	require.Equal(t, "autosync-s1", id)
+	c.AssertNotCalled(t, "TerminateWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestScheduleSyncReschedulesChangedCron(t *testing.T) {
+	c := mocks.NewClient(t)
+	c.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, serviceerror.NewWorkflowExecutionAlreadyStarted("running", "", "r1")).Once()
+	c.On("GetWorkflowHistory", mock.Anything, "autosync-s1", "", false, mock.Anything).
+		Return(startedWithCron(t, "*/10 * * * *"))
+	c.On("TerminateWorkflow", mock.Anything, "autosync-s1", "", "autosync rescheduled").Return(nil).Once()
+	run := mocks.NewWorkflowRun(t)
+	run.On("GetID").Return("autosync-s1")
+	run.On("GetRunID").Return("r2")
+	c.On("ExecuteWorkflow", mock.Anything, mock.MatchedBy(func(opts client.StartWorkflowOptions) bool {
+		return opts.CronSchedule == "0 * * * *"
+	}), mock.Anything, mock.Anything).Return(run, nil).Once()
+	o := NewTemporalOrchestrator(c, discardLogger())
+
+	id, err := o.ScheduleSync(context.Background(), autoSyncInput("s1", "autosync-cron"), "0 * * * *")
+	require.NoError(t, err)
+	require.Equal(t, "autosync-s1", id)
+}
+
+func TestScheduleSyncReportsStartErrors(t *testing.T) {
+	c := mocks.NewClient(t)
+	c.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, errors.New("namespace not found")).Once()
+	o := NewTemporalOrchestrator(c, discardLogger())
+
+	_, err := o.ScheduleSync(context.Background(), autoSyncInput("s1", "autosync-cron"), "0 * * * *")
+	require.EqualError(t, err, "namespace not found")
+}
+
+func TestUnscheduleCronSyncsCoversEverySite(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	for _, siteID := range []string{"s1", "s2"} {
+		require.NoError(t, store.RegisterSite(ctx, RegisteredSite{SiteID: siteID, AccessKey: "key-" + siteID, BuilderBaseURL: "http://builder"}))
+	}
+	orch := &fakeOrchestrator{}
+	NewServer(store, NewBuilderClient(), orch, discardLogger()).unscheduleCronSyncs(ctx)
+
+	slices.Sort(orch.unscheduled)
+	require.Equal(t, []string{"s1", "s2"}, orch.unscheduled)
+}
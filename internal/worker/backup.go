@@ -0,0 +1,209 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Backup record types. An export is every site, then every event in id order, then one end
+// record carrying the counts, so a truncated stream is recognisable.
+const (
+	BackupRecordSite  = "site"
+	BackupRecordEvent = "event"
+	BackupRecordEnd   = "end"
+)
+
+// BackupRecord is one NDJSON line of a worker export.
+type BackupRecord struct {
+	Type  string          `json:"type"`
+	Site  *RegisteredSite `json:"site,omitempty"`
+	Event *Event          `json:"event,omitempty"`
+	// SourceDedupeKey and SourceUTMSource identify the event Event's attribution metadata points
+	// at. Event ids are not portable, so import re-links the reference through them.
+	SourceDedupeKey string `json:"source_dedupe_key,omitempty"`
+	SourceUTMSource string `json:"source_utm_source,omitempty"`
+	// Sites and Events are only set on the end record.
+	Sites  int64 `json:"sites,omitempty"`
+	Events int64 `json:"events,omitempty"`
+}
+
+// ImportResult reports what an import did. Events already present under the same dedupe key
+// count as skipped, so re-running an import is harmless.
+type ImportResult struct {
+	Sites          int  `json:"sites"`
+	EventsInserted int  `json:"events_inserted"`
+	EventsSkipped  int  `json:"events_skipped"`
+	Complete       bool `json:"complete"`
+}
+
+// ErrInvalidBackupRecord is returned when an import line cannot be applied as a backup record.
+var ErrInvalidBackupRecord = errors.New("invalid backup record")
+
+// ExportAll calls fn for every registered site and then every event, straight from the database
+// cursors, and finishes with the end record. Nothing is buffered beyond the current row.
+func (s *Store) ExportAll(ctx context.Context, fn func(BackupRecord) error) error {
+	end := BackupRecord{Type: BackupRecordEnd}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+registeredSiteColumns+` FROM registered_sites ORDER BY site_id`)
+	if err != nil {
+		return fmt.Errorf("export sites: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		site, err := scanRegisteredSite(rows)
+		if err != nil {
+			return fmt.Errorf("scan site: %w", err)
+		}
+		if err := fn(BackupRecord{Type: BackupRecordSite, Site: &site}); err != nil {
+			return err
+		}
+		end.Sites++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iter sites: %w", err)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s, source_key, source_utm FROM (
+			SELECT e.*, src.dedupe_key AS source_key, src.utm_source AS source_utm
+			FROM events e
+			LEFT JOIN events src ON src.id = CASE WHEN json_valid(e.metadata)
+				THEN CAST(json_extract(e.metadata, '$.attribution.source_event_id') AS INTEGER) END
+		) ORDER BY id`, eventColumns))
+	if err != nil {
+		return fmt.Errorf("export events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sourceKey, sourceUTM sql.NullString
+		event, err := scanEvent(rows, &sourceKey, &sourceUTM)
+		if err != nil {
+			return err
+		}
+		record := BackupRecord{Type: BackupRecordEvent, Event: &event, SourceDedupeKey: sourceKey.String, SourceUTMSource: sourceUTM.String}
+		if err := fn(record); err != nil {
+			return err
+		}
+		end.Events++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iter events: %w", err)
+	}
+	return fn(end)
+}
+
+// ImportAll applies an export stream record by record. Sites are upserted and events go through
+// InsertEvent, so dedupe keys make the import idempotent; a failed import can be re-run from the
+// start. Attribution references are re-pointed at the local id of their source event, or dropped
+// when the source is not present.
+func (s *Store) ImportAll(ctx context.Context, r io.Reader) (ImportResult, error) {
+	var result ImportResult
+	dec := newPropertiesDecoder(r)
+	for line := 1; ; line++ {
+		var record BackupRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return result, fmt.Errorf("%w: record %d: %v", ErrInvalidBackupRecord, line, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		switch record.Type {
+		case BackupRecordSite:
+			if record.Site == nil || record.Site.SiteID == "" {
+				return result, fmt.Errorf("%w: record %d: site record without site_id", ErrInvalidBackupRecord, line)
+			}
+			if err := s.RegisterSite(ctx, *record.Site); err != nil {
+				return result, fmt.Errorf("record %d: %w", line, err)
+			}
+			result.Sites++
+		case BackupRecordEvent:
+			if record.Event == nil || record.Event.DedupeKey == "" {
+				return result, fmt.Errorf("%w: record %d: event record without dedupe_key", ErrInvalidBackupRecord, line)
+			}
+			event := *record.Event
+			event.ID = 0
+			if err := s.relinkAttribution(ctx, &event, record.SourceDedupeKey, record.SourceUTMSource); err != nil {
+				return result, fmt.Errorf("record %d: %w", line, err)
+			}
+			inserted, err := s.InsertEvent(ctx, event)
+			if err != nil {
+				return result, fmt.Errorf("record %d: %w", line, err)
+			}
+			if inserted {
+				result.EventsInserted++
+			} else {
+				result.EventsSkipped++
+			}
+		case BackupRecordEnd:
+			result.Complete = true
+		default:
+			return result, fmt.Errorf("%w: record %d: unknown type %q", ErrInvalidBackupRecord, line, record.Type)
+		}
+	}
+}
+
+// relinkAttribution rewrites event's attribution source_event_id to the local id of the event
+// stored under sourceKey on the same site, removing it when there is no such event.
+func (s *Store) relinkAttribution(ctx context.Context, event *Event, sourceKey, sourceUTM string) error {
+	attribution, ok := event.Metadata["attribution"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	if _, ok := attribution["source_event_id"]; !ok {
+		return nil
+	}
+	if sourceKey != "" {
+		source, found, err := s.GetEventByDedupeKey(ctx, event.SiteID, sourceKey, sourceUTM)
+		if err != nil {
+			return err
+		}
+		if found {
+			attribution["source_event_id"] = source.ID
+			return nil
+		}
+	}
+	delete(attribution, "source_event_id")
+	return nil
+}
+
+// handleExport streams the whole worker database as NDJSON. Once the first line is written the
+// status cannot change, so a failure shows up as a stream without the end record.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	var end BackupRecord
+	err := s.store.ExportAll(r.Context(), func(record BackupRecord) error {
+		end = record
+		return enc.Encode(record)
+	})
+	if err != nil {
+		s.logger.Error("export stream failed", "error", err)
+		return
+	}
+	s.logger.Info("worker exported", "sites", end.Sites, "events", end.Events)
+}
+
+// handleImport ingests an export stream from the request body.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	result, err := s.store.ImportAll(r.Context(), r.Body)
+	if err != nil {
+		s.logger.Error("import failed", "sites", result.Sites, "events_inserted", result.EventsInserted, "events_skipped", result.EventsSkipped, "error", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidBackupRecord) || errors.Is(err, ErrPropertiesTooLarge) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, "import stopped after %d sites and %d events: %v", result.Sites, result.EventsInserted+result.EventsSkipped, err)
+		return
+	}
+	s.logger.Info("worker imported", "sites", result.Sites, "events_inserted", result.EventsInserted, "events_skipped", result.EventsSkipped, "complete", result.Complete)
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBuilderCircuitOpen is returned without contacting the builder while its circuit is open.
+var ErrBuilderCircuitOpen = errors.New("builder circuit open")
+
+// Circuit states reported by CircuitState.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// CircuitState is a point-in-time view of the breaker for one builder base URL.
+type CircuitState struct {
+	BaseURL             string     `json:"base_url"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker tracks consecutive failures per builder base URL. After threshold failures in a
+// row the circuit opens and requests fail fast for cooldown; then a single probe is let through
+// (half-open) and its outcome either closes the circuit or re-opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		circuits:  map[string]*circuit{},
+	}
+}
+
+// allow reports whether a request to baseURL may proceed. When the cooldown of an open circuit
+// has passed, exactly one caller is admitted as the half-open probe.
+func (b *circuitBreaker) allow(baseURL string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[baseURL]
+	if !ok || c.openedAt.IsZero() {
+		return nil
+	}
+	if c.probing || b.now().Sub(c.openedAt) < b.cooldown {
+		return ErrBuilderCircuitOpen
+	}
+	c.probing = true
+	return nil
+}
+
+// record feeds the outcome of a request admitted by allow back into the breaker.
+func (b *circuitBreaker) record(baseURL string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[baseURL]
+	if !ok {
+		if success {
+			return
+		}
+		c = &circuit{}
+		b.circuits[baseURL] = c
+	}
+	wasProbe := c.probing
+	c.probing = false
+	if success {
+		c.failures = 0
+		c.openedAt = time.Time{}
+		return
+	}
+	c.failures++
+	if wasProbe || c.failures >= b.threshold {
+		c.openedAt = b.now()
+	}
+}
+
+// release returns an admitted request to the breaker without an outcome, for requests the caller
+// abandoned. A half-open probe is freed so the next caller can probe instead.
+func (b *circuitBreaker) release(baseURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[baseURL]; ok {
+		c.probing = false
+	}
+}
+
+// states returns every tracked circuit sorted by base URL.
+func (b *circuitBreaker) states() []CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	states := make([]CircuitState, 0, len(b.circuits))
+	for baseURL, c := range b.circuits {
+		state := CircuitState{BaseURL: baseURL, State: CircuitClosed, ConsecutiveFailures: c.failures}
+		if !c.openedAt.IsZero() {
+			openedAt := c.openedAt.UTC()
+			state.OpenedAt = &openedAt
+			state.State = CircuitOpen
+			if c.probing || b.now().Sub(c.openedAt) >= b.cooldown {
+				state.State = CircuitHalfOpen
+			}
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].BaseURL < states[j].BaseURL })
+	return states
+}
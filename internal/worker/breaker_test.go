@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerIgnoresCallerCancellation(t *testing.T) {
+	builder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer builder.Close()
+	c := NewBuilderClient(WithCircuitBreaker(1, time.Minute))
+	send := func(ctx context.Context, path string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, builder.URL+path, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		resp, err := c.do(req, builder.URL, "test")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := send(cancelled, "/"); err == nil {
+		t.Fatal("cancelled request: want error")
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := send(expired, "/"); err == nil {
+		t.Fatal("request past its deadline: want error")
+	}
+	if states := c.CircuitStates(); len(states) != 0 {
+		t.Fatalf("circuits after caller cancellations = %+v, want none", states)
+	}
+
+	if err := send(context.Background(), "/fail"); err != nil {
+		t.Fatalf("5xx request: %v", err)
+	}
+	if states := c.CircuitStates(); len(states) != 1 || states[0].State != CircuitOpen {
+		t.Fatalf("circuits after a 5xx = %+v, want one open", states)
+	}
+}
+
+func TestCircuitBreakerReleaseFreesProbe(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.record("http://builder", false)
+	now = now.Add(2 * time.Minute)
+	if err := b.allow("http://builder"); err != nil {
+		t.Fatalf("probe after cooldown: %v", err)
+	}
+	b.release("http://builder")
+	if err := b.allow("http://builder"); err != nil {
+		t.Fatalf("probe after the first was abandoned: %v", err)
+	}
+}
@@ -3,25 +3,148 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
+
+	"example.com/temporal-go/internal/metrics"
+)
+
+// Errors returned by FetchSiteProfile so callers can tell credential problems from outages. The
+// page fetches also wrap ErrBuilderUnauthorized when the access key is rejected.
+var (
+	ErrBuilderUnauthorized = errors.New("builder rejected the access key")
+	ErrBuilderSiteNotFound = errors.New("builder site not found")
+	ErrBuilderUnreachable  = errors.New("builder unreachable")
+	ErrBuilderTimeout      = errors.New("builder request timed out")
 )
 
+// decodeErrorBodyPrefix bounds how much of a malformed builder body BuilderDecodeError keeps.
+const decodeErrorBodyPrefix = 256
+
+// BuilderDecodeError reports a builder response whose body could not be decoded. Unlike a
+// transport failure, retrying will not fix a 200 with a malformed body, so sync activities
+// surface it as non-retryable.
+type BuilderDecodeError struct {
+	Endpoint   string
+	BodyPrefix string
+	Err        error
+}
+
+func (e *BuilderDecodeError) Error() string {
+	return fmt.Sprintf("decode %s: %v (body prefix %q)", e.Endpoint, e.Err, e.BodyPrefix)
+}
+
+func (e *BuilderDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeBuilderJSON decodes a builder response body into v. A body that cannot be read is
+// returned as a plain error; one that is not valid JSON for v becomes a *BuilderDecodeError.
+func decodeBuilderJSON(body io.Reader, endpoint string, v any) error {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", endpoint, err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		prefix := raw
+		if len(prefix) > decodeErrorBodyPrefix {
+			prefix = prefix[:decodeErrorBodyPrefix]
+		}
+		return &BuilderDecodeError{Endpoint: endpoint, BodyPrefix: string(prefix), Err: err}
+	}
+	return nil
+}
+
 // BuilderClient captures the HTTP calls the worker issues toward the builder API.
 type BuilderClient struct {
-	httpClient *http.Client
+	httpClient     *http.Client
+	metrics        *metrics.Registry
+	breaker        *circuitBreaker
+	redirectPolicy string
+}
+
+// BuilderClientOption customises optional BuilderClient behaviour.
+type BuilderClientOption func(*BuilderClient)
+
+// WithClientMetrics records per-endpoint request latency and status class into reg.
+func WithClientMetrics(reg *metrics.Registry) BuilderClientOption {
+	return func(c *BuilderClient) {
+		c.metrics = reg
+	}
+}
+
+// WithCircuitBreaker stops calling a builder base URL for cooldown after threshold consecutive
+// failures (transport errors or 5xx responses), then lets a single probe through to detect
+// recovery. Requests abandoned because the caller's context was cancelled or ran out are not
+// counted. A non-positive threshold leaves the breaker disabled.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) BuilderClientOption {
+	return func(c *BuilderClient) {
+		if threshold > 0 {
+			c.breaker = newCircuitBreaker(threshold, cooldown)
+		}
+	}
+}
+
+// CircuitStates reports the breaker state of every builder base URL contacted so far. It
+// returns nil when the breaker is disabled.
+func (c *BuilderClient) CircuitStates() []CircuitState {
+	if c == nil || c.breaker == nil {
+		return nil
+	}
+	return c.breaker.states()
 }
 
 // NewBuilderClient configures a client with sane defaults.
-func NewBuilderClient() *BuilderClient {
-	return &BuilderClient{
+func NewBuilderClient(opts ...BuilderClientOption) *BuilderClient {
+	c := &BuilderClient{
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		redirectPolicy: RedirectPolicyStrip,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.httpClient.CheckRedirect = c.checkRedirect
+	return c
+}
+
+// builderRequestMetric is the metric name recorded for every builder API call.
+const builderRequestMetric = "builder_client_request"
+
+// do executes req against the builder at baseURL and records its latency labelled by endpoint
+// kind and status class. While the circuit for baseURL is open it fails fast with
+// ErrBuilderCircuitOpen instead of sending the request.
+func (c *BuilderClient) do(req *http.Request, baseURL, endpoint string) (*http.Response, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if c.breaker != nil {
+		if err := c.breaker.allow(baseURL); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, baseURL)
+		}
+	}
+	started := time.Now()
+	resp, err := c.httpClient.Do(req)
+	status := "error"
+	if err == nil {
+		status = metrics.StatusClass(resp.StatusCode)
+	}
+	c.metrics.Observe(builderRequestMetric, map[string]string{"endpoint": endpoint, "status": status}, time.Since(started))
+	if c.breaker != nil {
+		// A request cut short by the caller's own cancellation or deadline says nothing about
+		// the builder's health, so it is not counted as a failure.
+		if err != nil && req.Context().Err() != nil {
+			c.breaker.release(baseURL)
+		} else {
+			c.breaker.record(baseURL, err == nil && resp.StatusCode < http.StatusInternalServerError)
+		}
+	}
+	return resp, err
 }
 
 // BuilderSite describes the metadata returned while validating a site registration.
@@ -73,33 +196,90 @@ type PagedOrdersResponse struct {
 	Orders   []BuilderOrder `json:"orders"`
 }
 
+// BuilderChange is a single entry of the builder's ordered changes feed.
+type BuilderChange struct {
+	Seq       int64         `json:"seq"`
+	Type      string        `json:"type"`
+	ChangedAt time.Time     `json:"changed_at"`
+	User      *BuilderUser  `json:"user,omitempty"`
+	Order     *BuilderOrder `json:"order,omitempty"`
+}
+
+// ChangesResponse wraps a batch of changes after a sequence number.
+type ChangesResponse struct {
+	Changes   []BuilderChange `json:"changes"`
+	Since     int64           `json:"since"`
+	NextSince int64           `json:"next_since"`
+	HasMore   bool            `json:"has_more"`
+}
+
+// statusError describes a non-200 builder response to a sync fetch. A rejected access key wraps
+// ErrBuilderUnauthorized so sync activities can stop retrying it.
+func statusError(op string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%s: %w: builder returned %s", op, ErrBuilderUnauthorized, resp.Status)
+	default:
+		return fmt.Errorf("%s: builder returned %s", op, resp.Status)
+	}
+}
+
+// DefaultBuilderAPIPrefix is the path the playground builder mounts its site API under.
+const DefaultBuilderAPIPrefix = "/builder/api"
+
+// siteEndpoint is the URL of a site API resource: baseURL, then apiPrefix (DefaultBuilderAPIPrefix
+// when empty), then /sites/{siteID} and suffix.
+func siteEndpoint(baseURL, apiPrefix, siteID, suffix string) string {
+	if apiPrefix == "" {
+		apiPrefix = DefaultBuilderAPIPrefix
+	}
+	return fmt.Sprintf("%s%s/sites/%s%s", strings.TrimRight(baseURL, "/"), apiPrefix, url.PathEscape(siteID), suffix)
+}
+
 // FetchSiteProfile validates a site ID/access key pairing.
-func (c *BuilderClient) FetchSiteProfile(ctx context.Context, baseURL, siteID, accessKey string) (BuilderSite, error) {
-	endpoint := fmt.Sprintf("%s/builder/api/sites/%s", strings.TrimRight(baseURL, "/"), url.PathEscape(siteID))
+func (c *BuilderClient) FetchSiteProfile(ctx context.Context, baseURL, apiPrefix, siteID, accessKey string) (BuilderSite, error) {
+	endpoint := siteEndpoint(baseURL, apiPrefix, siteID, "")
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return BuilderSite{}, err
 	}
 	req.Header.Set("X-Access-Key", accessKey)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, baseURL, "profile")
 	if err != nil {
-		return BuilderSite{}, err
+		if isTimeout(err) {
+			return BuilderSite{}, fmt.Errorf("%w: %v", ErrBuilderTimeout, err)
+		}
+		return BuilderSite{}, fmt.Errorf("%w: %v", ErrBuilderUnreachable, err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return BuilderSite{}, fmt.Errorf("%w: builder responded with %s", ErrBuilderUnauthorized, resp.Status)
+	case http.StatusNotFound:
+		return BuilderSite{}, fmt.Errorf("%w: builder responded with %s", ErrBuilderSiteNotFound, resp.Status)
+	default:
 		return BuilderSite{}, fmt.Errorf("builder responded with %s", resp.Status)
 	}
 	var site BuilderSite
-	if err := json.NewDecoder(resp.Body).Decode(&site); err != nil {
-		return BuilderSite{}, fmt.Errorf("decode site profile: %w", err)
+	if err := decodeBuilderJSON(resp.Body, "site profile", &site); err != nil {
+		return BuilderSite{}, err
 	}
 	return site, nil
 }
 
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 // FetchUsers retrieves users with optional date filters.
-func (c *BuilderClient) FetchUsers(ctx context.Context, baseURL, siteID, accessKey string, page, pageSize int, start, end *time.Time) (PagedUsersResponse, error) {
-	endpoint := fmt.Sprintf("%s/builder/api/sites/%s/users", strings.TrimRight(baseURL, "/"), url.PathEscape(siteID))
+func (c *BuilderClient) FetchUsers(ctx context.Context, baseURL, apiPrefix, siteID, accessKey string, page, pageSize int, start, end *time.Time) (PagedUsersResponse, error) {
+	endpoint := siteEndpoint(baseURL, apiPrefix, siteID, "/users")
 	query := make(url.Values)
 	query.Set("page", fmt.Sprintf("%d", page))
 	query.Set("page_size", fmt.Sprintf("%d", pageSize))
@@ -115,24 +295,24 @@ func (c *BuilderClient) FetchUsers(ctx context.Context, baseURL, siteID, accessK
 	}
 	req.Header.Set("X-Access-Key", accessKey)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, baseURL, "users")
 	if err != nil {
 		return PagedUsersResponse{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return PagedUsersResponse{}, fmt.Errorf("fetch users: builder returned %s", resp.Status)
+		return PagedUsersResponse{}, statusError("fetch users", resp)
 	}
 	var payload PagedUsersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return PagedUsersResponse{}, fmt.Errorf("decode users: %w", err)
+	if err := decodeBuilderJSON(resp.Body, "users", &payload); err != nil {
+		return PagedUsersResponse{}, err
 	}
 	return payload, nil
 }
 
 // FetchOrders retrieves orders with optional date filters.
-func (c *BuilderClient) FetchOrders(ctx context.Context, baseURL, siteID, accessKey string, page, pageSize int, start, end *time.Time) (PagedOrdersResponse, error) {
-	endpoint := fmt.Sprintf("%s/builder/api/sites/%s/orders", strings.TrimRight(baseURL, "/"), url.PathEscape(siteID))
+func (c *BuilderClient) FetchOrders(ctx context.Context, baseURL, apiPrefix, siteID, accessKey string, page, pageSize int, start, end *time.Time) (PagedOrdersResponse, error) {
+	endpoint := siteEndpoint(baseURL, apiPrefix, siteID, "/orders")
 	query := make(url.Values)
 	query.Set("page", fmt.Sprintf("%d", page))
 	query.Set("page_size", fmt.Sprintf("%d", pageSize))
@@ -148,17 +328,44 @@ func (c *BuilderClient) FetchOrders(ctx context.Context, baseURL, siteID, access
 	}
 	req.Header.Set("X-Access-Key", accessKey)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, baseURL, "orders")
 	if err != nil {
 		return PagedOrdersResponse{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return PagedOrdersResponse{}, fmt.Errorf("fetch orders: builder returned %s", resp.Status)
+		return PagedOrdersResponse{}, statusError("fetch orders", resp)
 	}
 	var payload PagedOrdersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return PagedOrdersResponse{}, fmt.Errorf("decode orders: %w", err)
+	if err := decodeBuilderJSON(resp.Body, "orders", &payload); err != nil {
+		return PagedOrdersResponse{}, err
+	}
+	return payload, nil
+}
+
+// FetchChanges retrieves the next batch of changes with seq greater than since.
+func (c *BuilderClient) FetchChanges(ctx context.Context, baseURL, apiPrefix, siteID, accessKey string, since int64, limit int) (ChangesResponse, error) {
+	endpoint := siteEndpoint(baseURL, apiPrefix, siteID, "/changes")
+	query := make(url.Values)
+	query.Set("since", fmt.Sprintf("%d", since))
+	query.Set("limit", fmt.Sprintf("%d", limit))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return ChangesResponse{}, err
+	}
+	req.Header.Set("X-Access-Key", accessKey)
+
+	resp, err := c.do(req, baseURL, "changes")
+	if err != nil {
+		return ChangesResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ChangesResponse{}, statusError("fetch changes", resp)
+	}
+	var payload ChangesResponse
+	if err := decodeBuilderJSON(resp.Body, "changes", &payload); err != nil {
+		return ChangesResponse{}, err
 	}
 	return payload, nil
 }
@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+func TestMalformedBuilderJSONIsNonRetryable(t *testing.T) {
+	body := "<html>" + strings.Repeat("x", 2*decodeErrorBodyPrefix)
+	builder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer builder.Close()
+
+	_, err := NewBuilderClient().FetchSiteProfile(context.Background(), builder.URL, "", "s1", "key")
+	var decodeErr *BuilderDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("fetch malformed profile: err %v, want *BuilderDecodeError", err)
+	}
+	if decodeErr.BodyPrefix != body[:decodeErrorBodyPrefix] {
+		t.Fatalf("body prefix has %d bytes, want the first %d", len(decodeErr.BodyPrefix), decodeErrorBodyPrefix)
+	}
+
+	var appErr *temporal.ApplicationError
+	if !errors.As(classifyActivityError(err), &appErr) || !appErr.NonRetryable() || appErr.Type() != "BuilderDecodeError" {
+		t.Fatalf("classified error = %v, want a non-retryable BuilderDecodeError", appErr)
+	}
+	if plain := errors.New("connection reset"); classifyActivityError(plain) != plain {
+		t.Fatal("transport errors must keep the retry policy")
+	}
+}
+
+func TestNormalizeAPIPrefix(t *testing.T) {
+	for raw, want := range map[string]string{
+		"":                "",
+		"/builder/api/":   "",
+		" /api/v2/ ":      "/api/v2",
+		"/shop/builder":   "/shop/builder",
+		"api/v2":          "error",
+		"/api?v=2":        "error",
+		"http://b/api/v2": "error",
+	} {
+		got, err := normalizeAPIPrefix(raw)
+		if want == "error" {
+			if err == nil {
+				t.Errorf("normalizeAPIPrefix(%q) = %q, want an error", raw, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("normalizeAPIPrefix(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+}
+
+func TestCustomAPIPrefixReachesEveryEndpoint(t *testing.T) {
+	var paths []string
+	builder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v2/sites/s1":
+			w.Write([]byte(`{"id":"s1","name":"Shop"}`))
+		case "/api/v2/sites/s1/users":
+			w.Write([]byte(`{"page":1,"page_size":10,"total":0,"users":[]}`))
+		case "/api/v2/sites/s1/orders":
+			w.Write([]byte(`{"page":1,"page_size":10,"total":0,"orders":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer builder.Close()
+	ctx := context.Background()
+	store := newTestStore(t)
+	s := newTestServer(t, store)
+
+	body := `{"site_id":"s1","access_key":"key","builder_base_url":"` + builder.URL + `","api_prefix":"/api/v2/"}`
+	if rec := serve(t, s.Router(), http.MethodPost, "/worker/sites", body, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d, body %s", rec.Code, rec.Body)
+	}
+	site, err := store.GetSite(ctx, "s1")
+	if err != nil {
+		t.Fatalf("get site: %v", err)
+	}
+	if site.APIPrefix != "/api/v2" {
+		t.Fatalf("stored api prefix %q, want /api/v2", site.APIPrefix)
+	}
+	if _, err := s.SyncUserPages(ctx, site, 1, 1, nil, nil); err != nil {
+		t.Fatalf("sync users: %v", err)
+	}
+	if _, err := s.SyncOrderPages(ctx, site, 1, 1, nil, nil); err != nil {
+		t.Fatalf("sync orders: %v", err)
+	}
+	want := []string{"/api/v2/sites/s1", "/api/v2/sites/s1/users", "/api/v2/sites/s1/orders"}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("builder saw %v, want %v", paths, want)
+	}
+}
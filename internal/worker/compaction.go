@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxCompactionWindow bounds the compaction window. Compaction is meant for bursts of the same
+// event seconds apart, not for thinning out a user's history.
+const MaxCompactionWindow = 10 * time.Minute
+
+// compactionDeleteBatch caps the ids bound into one compaction DELETE.
+const compactionDeleteBatch = 500
+
+// CompactionResult reports how many events a compaction pass collapsed per site.
+type CompactionResult struct {
+	Window time.Duration    `json:"window_ns"`
+	DryRun bool             `json:"dry_run"`
+	Sites  map[string]int64 `json:"sites"`
+	Total  int64            `json:"total"`
+}
+
+// CompactEvents collapses near-duplicate events: for one user, an event with the same site,
+// event_name, and utm_source as a kept event less than window earlier is deleted, so each burst
+// keeps only its earliest row. Attribution is preserved by never deleting
+//   - signup and order_created events, which are synced entities rather than noise;
+//   - an event another event's metadata names as its attribution source_event_id;
+//   - a utm touch unless the user's previous touch carried the same utm_source, so first-touch,
+//     last-touch, and as-of lookups resolve to the same source before and after.
+//
+// With dryRun set nothing is deleted and the counts say what would have been.
+func (s *Store) CompactEvents(ctx context.Context, window time.Duration, dryRun bool) (map[string]int64, error) {
+	if window <= 0 || window > MaxCompactionWindow {
+		return nil, fmt.Errorf("compaction window must be between 0 and %s", MaxCompactionWindow)
+	}
+	referenced, err := s.attributionSourceIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, site_id, user_id, event_name, COALESCE(utm_source, ''), timestamp
+		 FROM events ORDER BY user_id, timestamp, id`)
+	if err != nil {
+		return nil, fmt.Errorf("scan events for compaction: %w", err)
+	}
+	defer rows.Close()
+
+	type groupKey struct{ siteID, eventName, utmSource string }
+	var (
+		collapse    = map[string][]int64{}
+		currentUser string
+		kept        map[groupKey]time.Time
+		lastTouch   string
+	)
+	for rows.Next() {
+		var (
+			id                                   int64
+			siteID, userID, eventName, utmSource string
+			ts                                   time.Time
+		)
+		if err := rows.Scan(&id, &siteID, &userID, &eventName, &utmSource, &ts); err != nil {
+			return nil, fmt.Errorf("scan event for compaction: %w", err)
+		}
+		if kept == nil || userID != currentUser {
+			currentUser, kept, lastTouch = userID, map[groupKey]time.Time{}, ""
+		}
+		key := groupKey{siteID, eventName, utmSource}
+		keptAt, ok := kept[key]
+		if ok && ts.Sub(keptAt) < window && eventName != "signup" && eventName != "order_created" &&
+			!referenced[id] && (utmSource == "" || utmSource == lastTouch) {
+			collapse[siteID] = append(collapse[siteID], id)
+			continue
+		}
+		kept[key] = ts
+		if utmSource != "" {
+			lastTouch = utmSource
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter events for compaction: %w", err)
+	}
+	rows.Close()
+	perSite := make(map[string]int64, len(collapse))
+	for siteID, ids := range collapse {
+		if dryRun {
+			perSite[siteID] = int64(len(ids))
+			continue
+		}
+		n, err := s.deleteCompactedEvents(ctx, ids)
+		if err != nil {
+			return perSite, err
+		}
+		if n > 0 {
+			perSite[siteID] = n
+		}
+	}
+	return perSite, nil
+}
+
+// attributionSourceIDs returns every event id referenced as an attribution source in metadata.
+func (s *Store) attributionSourceIDs(ctx context.Context) (map[int64]bool, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT CAST(json_extract(metadata, '$.attribution.source_event_id') AS INTEGER)
+		 FROM events
+		 WHERE metadata IS NOT NULL AND json_valid(metadata)
+		   AND json_extract(metadata, '$.attribution.source_event_id') IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("load attribution sources: %w", err)
+	}
+	defer rows.Close()
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan attribution source: %w", err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter attribution sources: %w", err)
+	}
+	return ids, nil
+}
+
+// deleteCompactedEvents removes one site's ids in one transaction and returns how many rows went.
+// Each DELETE re-checks the attribution references, so an event that became a source after the
+// scan is kept.
+func (s *Store) deleteCompactedEvents(ctx context.Context, ids []int64) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin compaction tx: %w", err)
+	}
+	defer tx.Rollback()
+	var deleted int64
+	for len(ids) > 0 {
+		n := min(len(ids), compactionDeleteBatch)
+		args := make([]any, n)
+		for i, id := range ids[:n] {
+			args[i] = id
+		}
+		query := fmt.Sprintf(`DELETE FROM events WHERE id IN (%s)
+			AND id NOT IN (
+				SELECT CAST(json_extract(metadata, '$.attribution.source_event_id') AS INTEGER)
+				FROM events
+				WHERE metadata IS NOT NULL AND json_valid(metadata)
+				  AND json_extract(metadata, '$.attribution.source_event_id') IS NOT NULL
+			)`, strings.TrimSuffix(strings.Repeat("?,", n), ","))
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, fmt.Errorf("delete compacted events: %w", err)
+		}
+		affected, _ := res.RowsAffected()
+		deleted += affected
+		ids = ids[n:]
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit compaction: %w", err)
+	}
+	return deleted, nil
+}
+
+// CompactEvents runs one compaction pass over every site.
+func (s *Server) CompactEvents(ctx context.Context, window time.Duration, dryRun bool) (CompactionResult, error) {
+	sites, err := s.store.CompactEvents(ctx, window, dryRun)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	result := CompactionResult{Window: window, DryRun: dryRun, Sites: sites}
+	for _, n := range sites {
+		result.Total += n
+	}
+	return result, nil
+}
+
+// StartEventCompaction begins a ticker-driven loop that compacts near-duplicate events every
+// interval. It is opt-in: a non-positive window disables the loop entirely. With dryRun the loop
+// only logs what it would collapse.
+func (s *Server) StartEventCompaction(ctx context.Context, window, interval time.Duration, dryRun bool) {
+	if window <= 0 {
+		s.logger.Info("event compaction disabled")
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.logger.Info("compaction loop started", "window", window, "interval", interval, "dry_run", dryRun)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.logger.Info("compaction loop stopped", "reason", ctx.Err())
+				return
+			case <-ticker.C:
+				s.compactOnce(ctx, window, dryRun)
+			}
+		}
+	}()
+}
+
+func (s *Server) compactOnce(ctx context.Context, window time.Duration, dryRun bool) {
+	result, err := s.CompactEvents(ctx, window, dryRun)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error("event compaction failed", "error", err)
+		}
+		return
+	}
+	for siteID, n := range result.Sites {
+		s.logger.Info("compaction collapsed site events", "site_id", siteID, "collapsed", n, "dry_run", dryRun)
+	}
+	s.logger.Info("event compaction completed", "window", window, "collapsed", result.Total, "dry_run", dryRun)
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// eventKeys returns the dedupe keys stored for site in id order.
+func eventKeys(t *testing.T, store *Store, siteID string) []string {
+	t.Helper()
+	rows, err := store.db.QueryContext(context.Background(), `SELECT dedupe_key FROM events WHERE site_id = ? ORDER BY id`, siteID)
+	if err != nil {
+		t.Fatalf("list keys: %v", err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatalf("scan key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestCompactEventsKeepsAttribution(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+	view := func(key string, ts time.Time, utm string) Event {
+		return Event{SiteID: "s1", Timestamp: ts, UserID: "u1", EventName: "page_view", UTMSource: utm, DedupeKey: key}
+	}
+	for _, e := range []Event{
+		view("view-0s", at(0), ""),
+		view("view-5s-source", at(5*time.Second), ""),
+		view("view-10s", at(10*time.Second), ""),
+		{SiteID: "s1", Timestamp: at(20 * time.Second), UserID: "u1", EventName: "signup", DedupeKey: "signup-a"},
+		{SiteID: "s1", Timestamp: at(25 * time.Second), UserID: "u1", EventName: "signup", DedupeKey: "signup-b"},
+		view("google-30s", at(30*time.Second), "google"),
+		view("google-40s", at(40*time.Second), "google"),
+		view("facebook-50s", at(50*time.Second), "facebook"),
+		view("google-55s", at(55*time.Second), "google"),
+		view("view-2m", at(2*time.Minute), ""),
+	} {
+		mustInsert(t, store, e)
+	}
+	source, ok, err := store.GetEventByDedupeKey(ctx, "s1", "view-5s-source", "")
+	if err != nil || !ok {
+		t.Fatalf("load source event: %v (found %v)", err, ok)
+	}
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: at(3 * time.Minute), UserID: "u1", EventName: "order_created", DedupeKey: "order-1",
+		Metadata: map[string]any{"attribution": map[string]any{"model": "last", "source_event_id": source.ID}}})
+	before := eventKeys(t, store, "s1")
+
+	counts, err := store.CompactEvents(ctx, time.Minute, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if counts["s1"] != 2 {
+		t.Fatalf("dry run counts = %v, want 2 for s1", counts)
+	}
+	if got := eventKeys(t, store, "s1"); len(got) != len(before) {
+		t.Fatalf("dry run deleted events: %v", got)
+	}
+
+	counts, err = store.CompactEvents(ctx, time.Minute, false)
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if counts["s1"] != 2 {
+		t.Fatalf("compact counts = %v, want 2 for s1", counts)
+	}
+	want := []string{"view-0s", "view-5s-source", "signup-a", "signup-b", "google-30s", "facebook-50s", "google-55s", "view-2m", "order-1"}
+	if got := eventKeys(t, store, "s1"); !slices.Equal(got, want) {
+		t.Fatalf("after compaction = %v, want %v", got, want)
+	}
+
+	if _, err := store.CompactEvents(ctx, MaxCompactionWindow+time.Second, true); err == nil {
+		t.Fatal("window above the maximum: want error")
+	}
+}
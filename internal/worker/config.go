@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redacted replaces secret values in Config.Redacted. The builder's /builder/config uses the
+// same marker.
+const redacted = "[redacted]"
+
+// Config is the resolved startup configuration of the worker binary. config.LoadWorker builds it
+// from flags and environment, and WithConfig exposes it at /worker/config. Durations are reported in
+// nanoseconds like the other *_ns fields of the API.
+type Config struct {
+	DBPath                 string        `json:"db_path"`
+	Addr                   string        `json:"addr"`
+	TemporalAddress        string        `json:"temporal_address"`
+	TemporalNamespace      string        `json:"temporal_namespace"`
+	TaskQueue              string        `json:"task_queue"`
+	AutoSyncInterval       time.Duration `json:"autosync_interval_ns"`
+	AutoSyncMode           string        `json:"autosync_mode"`
+	AutoSyncCron           string        `json:"autosync_cron"`
+	AutoSyncDelay          time.Duration `json:"autosync_delay_ns"`
+	AutoSyncJitter         time.Duration `json:"autosync_jitter_ns"`
+	EventRetention         time.Duration `json:"event_retention_ns"`
+	RetentionInterval      time.Duration `json:"retention_interval_ns"`
+	CompactWindow          time.Duration `json:"compact_window_ns"`
+	CompactInterval        time.Duration `json:"compact_interval_ns"`
+	CompactDryRun          bool          `json:"compact_dry_run"`
+	AdminToken             string        `json:"admin_token"`
+	EventSinkURL           string        `json:"event_sink_url"`
+	EventSinkRetries       int           `json:"event_sink_retries"`
+	MaxPropertiesBytes     int           `json:"max_properties_bytes"`
+	DedupeScope            string        `json:"dedupe_scope"`
+	BreakerFailures        int           `json:"builder_breaker_failures"`
+	BreakerCooldown        time.Duration `json:"builder_breaker_cooldown_ns"`
+	BuilderRedirectPolicy  string        `json:"builder_redirect_policy"`
+	ExchangeRates          string        `json:"exchange_rates"`
+	WatermarkStaleAfter    time.Duration `json:"watermark_stale_after_ns"`
+	WatermarkCheckInterval time.Duration `json:"watermark_check_interval_ns"`
+	SyncPageConcurrency    int           `json:"sync_page_concurrency"`
+	BuilderPageSize        int           `json:"builder_page_size"`
+	CaseInsensitiveSiteIDs bool          `json:"case_insensitive_site_ids"`
+	TemporalMetrics        bool          `json:"temporal_metrics"`
+	SkipLogSample          int           `json:"skip_log_sample"`
+	SuppressAttribution    string        `json:"suppress_attribution"`
+	AttributionModel       string        `json:"attribution_model"`
+	ShutdownTimeout        time.Duration `json:"shutdown_timeout_ns"`
+}
+
+// Redacted returns a copy safe to serve: a configured admin token is masked, as are credentials
+// and the query string of the event sink URL, since collectors commonly take tokens there.
+func (c Config) Redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = redacted
+	}
+	c.EventSinkURL = redactURL(c.EventSinkURL)
+	return c
+}
+
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	// url.URL.String would percent-encode the marker in userinfo, so both parts are cleared
+	// and the marker is spliced back into the string.
+	hasUser, hasQuery := u.User != nil, u.RawQuery != ""
+	u.User, u.RawQuery, u.ForceQuery = nil, "", false
+	out := u.String()
+	if hasUser {
+		prefix := u.Scheme + "://"
+		if !strings.HasPrefix(out, prefix) {
+			return redacted
+		}
+		out = prefix + redacted + "@" + strings.TrimPrefix(out, prefix)
+	}
+	if hasQuery {
+		if i := strings.IndexByte(out, '#'); i >= 0 {
+			out = out[:i] + "?" + redacted + out[i:]
+		} else {
+			out += "?" + redacted
+		}
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the conversion latency histogram; the last bucket is
+// open ended.
+var latencyBuckets = []struct {
+	label string
+	upTo  time.Duration
+}{
+	{"0-1h", time.Hour},
+	{"1h-1d", 24 * time.Hour},
+	{"1d-7d", 7 * 24 * time.Hour},
+	{"7d-30d", 30 * 24 * time.Hour},
+}
+
+const latencyOverflowBucket = "30d+"
+
+// LatencyBucket counts converted users whose latency falls in one histogram bucket.
+type LatencyBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// ConversionLatencyReport summarises signup-to-first-order latency for a site.
+type ConversionLatencyReport struct {
+	SiteID         string          `json:"site_id"`
+	Converted      int             `json:"converted_users"`
+	AverageSeconds float64         `json:"average_seconds"`
+	MedianSeconds  float64         `json:"median_seconds"`
+	Histogram      []LatencyBucket `json:"histogram"`
+}
+
+// ConversionLatency builds the latency report for users who signed up within [start, end].
+func (s *Server) ConversionLatency(ctx context.Context, siteID string, start, end *time.Time) (ConversionLatencyReport, error) {
+	latencies, err := s.store.ConversionLatencies(ctx, siteID, start, end)
+	if err != nil {
+		return ConversionLatencyReport{}, err
+	}
+	return summarizeLatencies(siteID, latencies), nil
+}
+
+func summarizeLatencies(siteID string, latencies []time.Duration) ConversionLatencyReport {
+	report := ConversionLatencyReport{SiteID: siteID, Converted: len(latencies)}
+	report.Histogram = make([]LatencyBucket, 0, len(latencyBuckets)+1)
+	for _, b := range latencyBuckets {
+		report.Histogram = append(report.Histogram, LatencyBucket{Label: b.label})
+	}
+	report.Histogram = append(report.Histogram, LatencyBucket{Label: latencyOverflowBucket})
+	if len(latencies) == 0 {
+		return report
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, d := range latencies {
+		total += d
+		idx := len(latencyBuckets)
+		for i, b := range latencyBuckets {
+			if d < b.upTo {
+				idx = i
+				break
+			}
+		}
+		report.Histogram[idx].Count++
+	}
+	report.AverageSeconds = total.Seconds() / float64(len(latencies))
+	mid := len(latencies) / 2
+	if len(latencies)%2 == 0 {
+		report.MedianSeconds = (latencies[mid-1] + latencies[mid]).Seconds() / 2
+	} else {
+		report.MedianSeconds = latencies[mid].Seconds()
+	}
+	return report
+}
+
+// FunnelCounts is one signup-to-order funnel. Signups counts users with a signup event in the
+// window; Converted counts those with an order_created at or after their signup, and Orders
+// counts those orders. Users who never ordered stay in Signups.
+type FunnelCounts struct {
+	Signups        int     `json:"signups"`
+	Converted      int     `json:"converted_users"`
+	Orders         int     `json:"orders"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// FunnelGroup is the funnel of the users whose signup carried one utm_source ("" for none).
+type FunnelGroup struct {
+	UTMSource string `json:"utm_source"`
+	FunnelCounts
+}
+
+// FunnelReport is the site-wide funnel plus, when requested, one funnel per utm_source.
+type FunnelReport struct {
+	SiteID string     `json:"site_id"`
+	Start  *time.Time `json:"start,omitempty"`
+	End    *time.Time `json:"end,omitempty"`
+	FunnelCounts
+	Groups []FunnelGroup `json:"groups,omitempty"`
+}
+
+// Funnel aggregates the signup-to-order funnel of a site per signup utm_source, in SQL. start and
+// end filter on the signup timestamp; orders count whenever they happened after signup.
+func (s *Store) Funnel(ctx context.Context, siteID string, start, end *time.Time) ([]FunnelGroup, error) {
+	clauses := []string{"site_id = ?", "event_name = 'signup'"}
+	args := []any{siteID}
+	if start != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, end.UTC())
+	}
+	// The bare utm_source next to MIN(timestamp) is taken from the earliest signup row.
+	query := fmt.Sprintf(`SELECT utm, COUNT(*), SUM(orders > 0), SUM(orders) FROM (
+			SELECT su.utm, (
+				SELECT COUNT(*) FROM events o
+				WHERE o.site_id = su.site_id AND o.user_id = su.user_id
+				  AND o.event_name = 'order_created' AND o.timestamp >= su.signed_up_at
+			) AS orders
+			FROM (
+				SELECT site_id, user_id, MIN(timestamp) AS signed_up_at, COALESCE(utm_source, '') AS utm
+				FROM events WHERE %s
+				GROUP BY site_id, user_id
+			) su
+		)
+		GROUP BY utm ORDER BY utm`, strings.Join(clauses, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("funnel: %w", err)
+	}
+	defer rows.Close()
+	groups := []FunnelGroup{}
+	for rows.Next() {
+		var g FunnelGroup
+		if err := rows.Scan(&g.UTMSource, &g.Signups, &g.Converted, &g.Orders); err != nil {
+			return nil, fmt.Errorf("scan funnel: %w", err)
+		}
+		g.ConversionRate = coverageRatio(g.Converted, g.Signups)
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter funnel: %w", err)
+	}
+	return groups, nil
+}
+
+// Funnel builds the funnel report for users who signed up within [start, end]. The per-source
+// groups are only included when byUTM is set.
+func (s *Server) Funnel(ctx context.Context, siteID string, start, end *time.Time, byUTM bool) (FunnelReport, error) {
+	groups, err := s.store.Funnel(ctx, siteID, start, end)
+	if err != nil {
+		return FunnelReport{}, err
+	}
+	report := FunnelReport{SiteID: siteID, Start: start, End: end}
+	for _, g := range groups {
+		report.Signups += g.Signups
+		report.Converted += g.Converted
+		report.Orders += g.Orders
+	}
+	report.ConversionRate = coverageRatio(report.Converted, report.Signups)
+	if byUTM {
+		report.Groups = groups
+	}
+	return report, nil
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+)
+
+// Dedupe scopes decide which events count as duplicates of each other.
+const (
+	// DedupeScopeKey treats dedupe_key as unique within a site. It is the default.
+	DedupeScopeKey = "key"
+	// DedupeScopeSource makes idempotency per utm_source: the same dedupe_key may be stored once
+	// for each distinct source.
+	DedupeScopeSource = "source"
+)
+
+// WithDedupeScope selects the dedupe scope applied by InsertEvent. Init re-scopes existing events
+// to match; see migrateDedupeScope.
+func WithDedupeScope(scope string) StoreOption {
+	return func(s *Store) {
+		s.dedupeScope = scope
+	}
+}
+
+// eventsTableSQL returns the events schema under the given table name. Uniqueness lives in
+// idx_events_site_dedupe over (site_id, dedupe_key, dedupe_scope) rather than on the column
+// itself.
+func eventsTableSQL(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id TEXT NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			user_id TEXT NOT NULL,
+			event_name TEXT NOT NULL,
+			utm_source TEXT,
+			properties TEXT NOT NULL,
+			dedupe_key TEXT NOT NULL,
+			ingested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			metadata TEXT,
+			dedupe_scope TEXT NOT NULL DEFAULT ''
+		);`, table)
+}
+
+var eventIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_events_user ON events(user_id, timestamp DESC);`,
+	`CREATE INDEX IF NOT EXISTS idx_events_site ON events(site_id, timestamp DESC);`,
+	// idx_events_dedupe made keys unique across sites; dedupe keys are only unique per site.
+	`DROP INDEX IF EXISTS idx_events_dedupe;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_events_site_dedupe ON events(site_id, dedupe_key, dedupe_scope);`,
+}
+
+// dedupeScopeExpr is the SQL equivalent of dedupeScopeValue, used to re-scope existing rows.
+func (s *Store) dedupeScopeExpr() string {
+	if s.dedupeScope == DedupeScopeSource {
+		return "COALESCE(utm_source, '')"
+	}
+	return "''"
+}
+
+// dedupeScopeValue is the dedupe_scope stored with an event under the configured scope.
+func (s *Store) dedupeScopeValue(event Event) string {
+	if s.dedupeScope == DedupeScopeSource {
+		return event.UTMSource
+	}
+	return ""
+}
+
+func (s *Store) validateDedupeScope() error {
+	switch s.dedupeScope {
+	case DedupeScopeKey, DedupeScopeSource:
+		return nil
+	default:
+		return fmt.Errorf("unknown dedupe scope %q (use %s or %s)", s.dedupeScope, DedupeScopeKey, DedupeScopeSource)
+	}
+}
+
+// migrateDedupeScope prepares existing rows for the configured scope. Tables created before
+// dedupe scopes existed declare dedupe_key UNIQUE inline, which would keep keys unique across
+// sites and which SQLite cannot drop in place, so they are rebuilt once. Every row's
+// dedupe_scope is then recomputed; switching back to DedupeScopeKey fails while the same
+// dedupe_key is stored for several sources of one site.
+func (s *Store) migrateDedupeScope(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin dedupe migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	var stmts []string
+	var legacy int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pragma_index_list('events') WHERE origin = 'u'`,
+	).Scan(&legacy); err != nil {
+		return fmt.Errorf("inspect events indexes: %w", err)
+	}
+	if legacy > 0 {
+		stmts = append(stmts,
+			eventsTableSQL("events_rebuild"),
+			`INSERT INTO events_rebuild(id, site_id, timestamp, user_id, event_name, utm_source, properties, dedupe_key, ingested_at, metadata, dedupe_scope)
+			 SELECT id, site_id, timestamp, user_id, event_name, utm_source, properties, dedupe_key, ingested_at, metadata, dedupe_scope FROM events`,
+			`DROP TABLE events`,
+			`ALTER TABLE events_rebuild RENAME TO events`,
+		)
+		stmts = append(stmts, eventIndexes...)
+	}
+	scope := s.dedupeScopeExpr()
+	stmts = append(stmts, fmt.Sprintf(`UPDATE events SET dedupe_scope = %s WHERE dedupe_scope != %s`, scope, scope))
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate events to dedupe scope %q: %w", s.dedupeScope, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit dedupe migration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/temporal-go/internal/sqliteutil"
+)
+
+func TestDedupeKeysAreUniquePerSite(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	event := Event{SiteID: "s1", Timestamp: time.Now().UTC(), UserID: "u1", EventName: "signup", DedupeKey: "signup:u1"}
+	mustInsert(t, store, event)
+	if inserted, err := store.InsertEvent(ctx, event); err != nil || inserted {
+		t.Fatalf("repeat on the same site: inserted %v, err %v; want skipped", inserted, err)
+	}
+	event.SiteID = "s2"
+	mustInsert(t, store, event)
+}
+
+func TestInitRebuildsLegacyGlobalDedupeIndex(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqliteutil.Open(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// The schema from before dedupe keys were scoped to a site.
+	if _, err := db.ExecContext(ctx, `CREATE TABLE events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id TEXT NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			user_id TEXT NOT NULL,
+			event_name TEXT NOT NULL,
+			utm_source TEXT,
+			properties TEXT NOT NULL,
+			dedupe_key TEXT NOT NULL UNIQUE,
+			ingested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			metadata TEXT
+		)`); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO events(site_id, timestamp, user_id, event_name, properties, dedupe_key) VALUES ('s1', ?, 'u1', 'signup', '{}', 'signup:u1')`,
+		time.Now().UTC()); err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+
+	store := NewStore(db)
+	if err := store.Init(ctx); err != nil {
+		t.Fatalf("init over legacy table: %v", err)
+	}
+	mustInsert(t, store, Event{SiteID: "s2", Timestamp: time.Now().UTC(), UserID: "u1", EventName: "signup", DedupeKey: "signup:u1"})
+	if _, ok, err := store.GetEventByDedupeKey(ctx, "s1", "signup:u1", ""); err != nil || !ok {
+		t.Fatalf("legacy row after rebuild: found %v, err %v", ok, err)
+	}
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestManualEventConflictReturnsStoredEvent(t *testing.T) {
+	h := newTestServer(t, newTestStore(t)).Router()
+	original := `{"site_id":"s1","user_id":"u1","event_name":"signup","timestamp":"2025-03-01T09:00:00Z","dedupe_key":"signup:s1:u1","properties":{"plan":"pro","seats":3}}`
+	rec := serve(t, h, http.MethodPost, "/worker/events", original, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first insert: status %d, body %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		Event Event `json:"event"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode created: %v", err)
+	}
+
+	// The retry disagrees with what was stored; the response must show the stored version.
+	retry := `{"site_id":"s1","user_id":"u1","event_name":"signup","timestamp":"2025-03-02T09:00:00Z","dedupe_key":"signup:s1:u1","properties":{"plan":"free"}}`
+	rec = serve(t, h, http.MethodPost, "/worker/events", retry, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("duplicate insert: status %d, body %s", rec.Code, rec.Body)
+	}
+	var dup struct {
+		Inserted      bool   `json:"inserted"`
+		ExistingEvent *Event `json:"existing_event"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &dup); err != nil {
+		t.Fatalf("decode duplicate: %v", err)
+	}
+	if dup.Inserted || dup.ExistingEvent == nil {
+		t.Fatalf("duplicate response = %s, want inserted false with existing_event", rec.Body)
+	}
+	got := dup.ExistingEvent
+	if got.ID == 0 || got.UserID != "u1" || got.EventName != "signup" || got.DedupeKey != "signup:s1:u1" {
+		t.Fatalf("existing event = %+v", got)
+	}
+	if !got.Timestamp.Equal(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)) || !got.Timestamp.Equal(created.Event.Timestamp) {
+		t.Fatalf("existing timestamp %s, want the original %s", got.Timestamp, created.Event.Timestamp)
+	}
+	if got.Properties["plan"] != "pro" || got.Properties["seats"] != float64(3) {
+		t.Fatalf("existing properties = %v, want the original", got.Properties)
+	}
+}
@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feature flag keys understood by the worker.
+const (
+	// FlagAttributionModel picks the touch synced events are attributed to: "last" or "first".
+	FlagAttributionModel = "attribution_model"
+	// FlagAutoSync set to "false" skips the site in the background autosync sweep. Manual and
+	// API-triggered syncs are unaffected.
+	FlagAutoSync = "autosync"
+	// FlagEventTimestamp picks which time synced signup/order events are stored under: the
+	// builder's signup_at/placed_at ("source") or the moment the worker ingested them
+	// ("ingestion"). The source time always stays in the event properties.
+	FlagEventTimestamp = "event_timestamp"
+	// FlagSuppressAttribution lists event names, comma-separated, that the site syncs without
+	// utm_source attribution, on top of any set with WithSuppressedAttribution. Empty attributes
+	// every event.
+	FlagSuppressAttribution = "suppress_attribution"
+	// FlagEventRetention overrides the worker's --event-retention for the site with a Go
+	// duration such as "2160h". "0s" keeps the site's events forever; empty uses the default.
+	FlagEventRetention = "event_retention"
+)
+
+// Values of FlagEventTimestamp.
+const (
+	EventTimestampSource    = "source"
+	EventTimestampIngestion = "ingestion"
+)
+
+// ErrUnknownFlag is returned when a flag key is not in featureFlagDefaults.
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// featureFlagDefaults holds the value each known flag has when a site has not set it, along with
+// the check applied before a new value is stored.
+var featureFlagDefaults = map[string]struct {
+	value    string
+	validate func(string) error
+}{
+	FlagAttributionModel: {AttributionModelLast, func(v string) error {
+		if v != AttributionModelLast && v != AttributionModelFirst {
+			return fmt.Errorf("must be %q or %q", AttributionModelLast, AttributionModelFirst)
+		}
+		return nil
+	}},
+	FlagAutoSync: {"true", func(v string) error {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return errors.New("must be a boolean")
+		}
+		return nil
+	}},
+	FlagEventTimestamp: {EventTimestampSource, func(v string) error {
+		if v != EventTimestampSource && v != EventTimestampIngestion {
+			return fmt.Errorf("must be %q or %q", EventTimestampSource, EventTimestampIngestion)
+		}
+		return nil
+	}},
+	FlagSuppressAttribution: {"", func(string) error { return nil }},
+	FlagEventRetention: {"", func(v string) error {
+		if v == "" {
+			return nil
+		}
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			return errors.New("must be a non-negative duration such as 720h")
+		}
+		return nil
+	}},
+}
+
+// validateFeatureFlag rejects unknown keys and values the flag's consumer could not act on.
+func validateFeatureFlag(key, value string) error {
+	def, ok := featureFlagDefaults[key]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownFlag, key)
+	}
+	if err := def.validate(value); err != nil {
+		return fmt.Errorf("flag %s: %w", key, err)
+	}
+	return nil
+}
+
+// flagDefault returns the value key has on sites that have not set it: the server-wide
+// attribution model for FlagAttributionModel when one is configured, else featureFlagDefaults.
+func (s *Server) flagDefault(key string) string {
+	if key == FlagAttributionModel && s.attributionModel != "" {
+		return s.attributionModel
+	}
+	return featureFlagDefaults[key].value
+}
+
+// flagValue returns a site's value for key, or the flag's default when it is unset. Lookup
+// failures are logged and also fall back to the default so a flag never breaks a sync.
+func (s *Server) flagValue(ctx context.Context, siteID, key string) string {
+	value, ok, err := s.store.GetFeatureFlag(ctx, siteID, key)
+	if err != nil {
+		s.logger.Warn("feature flag lookup failed; using default", "site_id", siteID, "key", key, "error", err)
+	}
+	if err != nil || !ok {
+		return s.flagDefault(key)
+	}
+	return value
+}
+
+// EffectiveFlags returns every known flag for a site, with defaults filled in for unset ones.
+func (s *Server) EffectiveFlags(ctx context.Context, siteID string) ([]FeatureFlag, error) {
+	stored, err := s.store.ListFeatureFlags(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]FeatureFlag, len(stored))
+	for _, f := range stored {
+		byKey[f.Key] = f
+	}
+	flags := make([]FeatureFlag, 0, len(featureFlagDefaults))
+	for key := range featureFlagDefaults {
+		f, ok := byKey[key]
+		if !ok {
+			f = FeatureFlag{SiteID: siteID, Key: key, Value: s.flagDefault(key)}
+		}
+		flags = append(flags, f)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags, nil
+}
+
+// ParseEventNames splits a comma-separated list of event names, dropping blanks.
+func ParseEventNames(spec string) []string {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// suppressedAttribution returns the event names synced on siteID without attribution: the
+// server-wide set plus the site's suppress_attribution flag.
+func (s *Server) suppressedAttribution(ctx context.Context, siteID string) []string {
+	names := append([]string(nil), s.suppressAttribution...)
+	return append(names, ParseEventNames(s.flagValue(ctx, siteID, FlagSuppressAttribution))...)
+}
+
+// attributionLookup returns the attribution function selected by the site's attribution_model
+// flag, bound to siteID so only that site's touches count. When eventName is suppressed for the
+// site the function never finds an attribution.
+func (s *Server) attributionLookup(ctx context.Context, siteID, eventName string) func(context.Context, string) (Attribution, bool, error) {
+	if slices.Contains(s.suppressedAttribution(ctx, siteID), eventName) {
+		return func(context.Context, string) (Attribution, bool, error) {
+			return Attribution{}, false, nil
+		}
+	}
+	lookup := s.store.LatestAttribution
+	if s.flagValue(ctx, siteID, FlagAttributionModel) == AttributionModelFirst {
+		lookup = s.store.FirstAttribution
+	}
+	return func(ctx context.Context, userID string) (Attribution, bool, error) {
+		return lookup(ctx, siteID, userID)
+	}
+}
+
+// eventTimes returns the Timestamp and IngestedAt to store for a synced event whose builder-side
+// time is source, following the site's event_timestamp policy. A zero IngestedAt lets the store
+// default it to the insert time.
+func eventTimes(policy string, source time.Time) (time.Time, time.Time) {
+	if policy == EventTimestampIngestion {
+		now := time.Now().UTC()
+		return now, now
+	}
+	return source, time.Time{}
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAttributionModelDefaultsAndSiteOverride(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, source := range []string{"google", "facebook", "newsletter"} {
+		mustInsert(t, store, Event{SiteID: "s1", Timestamp: t0.Add(time.Duration(i) * 24 * time.Hour), UserID: "u1",
+			EventName: "page_view", UTMSource: source, DedupeKey: "view:" + source})
+	}
+	attributed := func(s *Server) string {
+		t.Helper()
+		got, ok, err := s.attributionLookup(ctx, "s1", "order_created")(ctx, "u1")
+		if err != nil || !ok {
+			t.Fatalf("attribution lookup: ok %v, err %v", ok, err)
+		}
+		return got.Source
+	}
+
+	if got := attributed(newTestServer(t, store)); got != "newsletter" {
+		t.Fatalf("default model attributed %q, want the last touch", got)
+	}
+	firstByDefault := newTestServer(t, store, WithAttributionModel(AttributionModelFirst))
+	if got := attributed(firstByDefault); got != "google" {
+		t.Fatalf("worker-wide first model attributed %q, want the first touch", got)
+	}
+	flags, err := firstByDefault.EffectiveFlags(ctx, "s1")
+	if err != nil {
+		t.Fatalf("effective flags: %v", err)
+	}
+	for _, f := range flags {
+		if f.Key == FlagAttributionModel && f.Value != AttributionModelFirst {
+			t.Fatalf("effective %s = %q, want the worker default %q", f.Key, f.Value, AttributionModelFirst)
+		}
+	}
+
+	// A site's own flag wins over the worker-wide default.
+	if err := store.SetFeatureFlag(ctx, FeatureFlag{SiteID: "s1", Key: FlagAttributionModel, Value: AttributionModelLast}); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	if got := attributed(firstByDefault); got != "newsletter" {
+		t.Fatalf("site flag last attributed %q, want the last touch", got)
+	}
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/serviceerror"
+)
+
+// ErrWorkflowNotFound is returned when Temporal has no workflow with the requested ID.
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// DefaultWorkflowHistoryLimit and MaxWorkflowHistoryLimit bound WorkflowHistory pages.
+const (
+	DefaultWorkflowHistoryLimit = 100
+	MaxWorkflowHistoryLimit     = 1000
+)
+
+// WorkflowHistoryEvent summarizes one Temporal history event. Activity events carry the
+// activity type, resolved from the scheduling event for started/completed/failed events, and
+// failures carry only their message.
+type WorkflowHistoryEvent struct {
+	EventID          int64     `json:"event_id"`
+	Type             string    `json:"type"`
+	Timestamp        time.Time `json:"timestamp"`
+	ActivityType     string    `json:"activity_type,omitempty"`
+	ActivityID       string    `json:"activity_id,omitempty"`
+	ScheduledEventID int64     `json:"scheduled_event_id,omitempty"`
+	Attempt          int32     `json:"attempt,omitempty"`
+	Failure          string    `json:"failure,omitempty"`
+}
+
+// WorkflowHistory returns up to limit summarized events of the workflow's latest run with an
+// event ID greater than afterEventID, plus the next_after cursor (0 once the history is
+// exhausted). Unknown workflow IDs return ErrWorkflowNotFound.
+func (o *TemporalOrchestrator) WorkflowHistory(ctx context.Context, workflowID string, afterEventID int64, limit int) ([]WorkflowHistoryEvent, int64, error) {
+	if limit <= 0 {
+		limit = DefaultWorkflowHistoryLimit
+	}
+	if limit > MaxWorkflowHistoryLimit {
+		limit = MaxWorkflowHistoryLimit
+	}
+	iter := o.client.GetWorkflowHistory(ctx, workflowID, "", false, enums.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	activityTypes := map[int64]string{}
+	events := []WorkflowHistoryEvent{}
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			var notFound *serviceerror.NotFound
+			if errors.As(err, &notFound) {
+				return nil, 0, fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
+			}
+			return nil, 0, fmt.Errorf("workflow history: %w", err)
+		}
+		summary := summarizeHistoryEvent(event, activityTypes)
+		if summary.EventID <= afterEventID {
+			continue
+		}
+		if len(events) == limit {
+			return events, events[len(events)-1].EventID, nil
+		}
+		events = append(events, summary)
+	}
+	return events, 0, nil
+}
+
+// summarizeHistoryEvent flattens the fields worth showing for event. activityTypes maps
+// scheduled event IDs to activity types and is filled as scheduling events go by.
+func summarizeHistoryEvent(event *historypb.HistoryEvent, activityTypes map[int64]string) WorkflowHistoryEvent {
+	summary := WorkflowHistoryEvent{
+		EventID:   event.GetEventId(),
+		Type:      event.GetEventType().String(),
+		Timestamp: event.GetEventTime().AsTime().UTC(),
+	}
+	fromScheduled := func(scheduledID int64) {
+		summary.ScheduledEventID = scheduledID
+		summary.ActivityType = activityTypes[scheduledID]
+	}
+	switch event.GetEventType() {
+	case enums.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED:
+		attrs := event.GetActivityTaskScheduledEventAttributes()
+		summary.ActivityType = attrs.GetActivityType().GetName()
+		summary.ActivityID = attrs.GetActivityId()
+		activityTypes[summary.EventID] = summary.ActivityType
+	case enums.EVENT_TYPE_ACTIVITY_TASK_STARTED:
+		attrs := event.GetActivityTaskStartedEventAttributes()
+		fromScheduled(attrs.GetScheduledEventId())
+		summary.Attempt = attrs.GetAttempt()
+		summary.Failure = attrs.GetLastFailure().GetMessage()
+	case enums.EVENT_TYPE_ACTIVITY_TASK_COMPLETED:
+		fromScheduled(event.GetActivityTaskCompletedEventAttributes().GetScheduledEventId())
+	case enums.EVENT_TYPE_ACTIVITY_TASK_FAILED:
+		attrs := event.GetActivityTaskFailedEventAttributes()
+		fromScheduled(attrs.GetScheduledEventId())
+		summary.Failure = attrs.GetFailure().GetMessage()
+	case enums.EVENT_TYPE_ACTIVITY_TASK_TIMED_OUT:
+		attrs := event.GetActivityTaskTimedOutEventAttributes()
+		fromScheduled(attrs.GetScheduledEventId())
+		summary.Failure = attrs.GetFailure().GetMessage()
+	case enums.EVENT_TYPE_ACTIVITY_TASK_CANCELED:
+		fromScheduled(event.GetActivityTaskCanceledEventAttributes().GetScheduledEventId())
+	case enums.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED:
+		summary.Failure = event.GetWorkflowExecutionFailedEventAttributes().GetFailure().GetMessage()
+	case enums.EVENT_TYPE_WORKFLOW_TASK_FAILED:
+		summary.Failure = event.GetWorkflowTaskFailedEventAttributes().GetFailure().GetMessage()
+	}
+	return summary
+}
@@ -0,0 +1,20 @@
+package worker
+
+import "github.com/google/uuid"
+
+// IDGenerator produces the unique identifiers the store embeds in rows it creates. Tests can
+// supply a sequential generator to make those rows predictable.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a plain function to IDGenerator.
+type IDGeneratorFunc func() string
+
+// NewID calls f.
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// UUIDGenerator is the default IDGenerator, producing random v4 UUIDs.
+var UUIDGenerator IDGenerator = IDGeneratorFunc(uuid.NewString)
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/log"
+)
+
+type siteIDContextKey struct{}
+
+// SiteLoggingInterceptor tags every activity with the site it works on. It reads the SiteID field
+// from the activity input, stores it on the activity context, and adds it to the Temporal
+// activity logger so log lines inside an activity carry site_id without repeating it.
+type SiteLoggingInterceptor struct {
+	interceptor.WorkerInterceptorBase
+}
+
+// NewSiteLoggingInterceptor returns the worker interceptor wired in RegisterSyncWorker.
+func NewSiteLoggingInterceptor() *SiteLoggingInterceptor {
+	return &SiteLoggingInterceptor{}
+}
+
+// InterceptActivity implements interceptor.WorkerInterceptor.
+func (*SiteLoggingInterceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	i := &siteActivityInbound{}
+	i.Next = next
+	return i
+}
+
+type siteActivityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+}
+
+func (i *siteActivityInbound) Init(outbound interceptor.ActivityOutboundInterceptor) error {
+	o := &siteActivityOutbound{}
+	o.Next = outbound
+	return i.Next.Init(o)
+}
+
+func (i *siteActivityInbound) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	if siteID := siteIDFromArgs(in.Args); siteID != "" {
+		ctx = context.WithValue(ctx, siteIDContextKey{}, siteID)
+	}
+	return i.Next.ExecuteActivity(ctx, in)
+}
+
+type siteActivityOutbound struct {
+	interceptor.ActivityOutboundInterceptorBase
+}
+
+func (o *siteActivityOutbound) GetLogger(ctx context.Context) log.Logger {
+	logger := o.Next.GetLogger(ctx)
+	if siteID, ok := siteIDFromContext(ctx); ok {
+		return log.With(logger, "site_id", siteID)
+	}
+	return logger
+}
+
+// siteIDFromArgs returns the SiteID field of the first struct argument that has one.
+func siteIDFromArgs(args []interface{}) string {
+	for _, arg := range args {
+		v := reflect.ValueOf(arg)
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		f := v.FieldByName("SiteID")
+		if f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+	return ""
+}
+
+func siteIDFromContext(ctx context.Context) (string, bool) {
+	siteID, ok := ctx.Value(siteIDContextKey{}).(string)
+	return siteID, ok
+}
+
+// activityLogger returns base tagged with the site_id set by SiteLoggingInterceptor, if any.
+func activityLogger(ctx context.Context, base *slog.Logger) *slog.Logger {
+	if siteID, ok := siteIDFromContext(ctx); ok {
+		return base.With("site_id", siteID)
+	}
+	return base
+}
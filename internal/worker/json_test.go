@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wrappedWriter stands in for middleware that wraps the response writer after negotiation.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestWriteJSONCompactThroughWrappedWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(wrappedWriter{compactJSONWriter{rec}}, http.StatusOK, map[string]any{"ok": true, "n": 1})
+	if got := rec.Body.String(); got != "{\"n\":1,\"ok\":true}\n" {
+		t.Fatalf("compact body = %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	writeJSON(wrappedWriter{rec}, http.StatusOK, map[string]any{"ok": true})
+	if !strings.Contains(rec.Body.String(), "\n  \"ok\"") {
+		t.Fatalf("default body is not indented: %q", rec.Body)
+	}
+}
+
+func TestRouterNegotiatesCompactJSON(t *testing.T) {
+	h := newTestServer(t, newTestStore(t)).Router()
+	for name, tc := range map[string]struct {
+		target string
+		header http.Header
+		want   string
+	}{
+		"query":   {"/healthz?pretty=false", nil, "{\"ok\":true}\n"},
+		"accept":  {"/healthz", http.Header{"Accept": {"application/json; pretty=false"}}, "{\"ok\":true}\n"},
+		"default": {"/healthz", nil, "{\n  \"ok\": true\n}\n"},
+	} {
+		if got := serve(t, h, http.MethodGet, tc.target, "", tc.header).Body.String(); got != tc.want {
+			t.Errorf("%s: body %q, want %q", name, got, tc.want)
+		}
+	}
+}
@@ -2,12 +2,51 @@ package worker
 
 import "time"
 
-// RegisteredSite stores credentials that let the worker talk to the builder API.
+// RegisteredSite stores credentials that let the worker talk to the builder API. APIPrefix is
+// only set for builders that mount their site API somewhere other than DefaultBuilderAPIPrefix.
 type RegisteredSite struct {
-	SiteID         string    `json:"site_id"`
-	AccessKey      string    `json:"access_key"`
-	BuilderBaseURL string    `json:"builder_base_url"`
-	RegisteredAt   time.Time `json:"registered_at"`
+	SiteID          string    `json:"site_id"`
+	AccessKey       string    `json:"access_key"`
+	BuilderBaseURL  string    `json:"builder_base_url"`
+	BuilderBaseURLs []string  `json:"builder_base_urls,omitempty"`
+	BuilderSiteName string    `json:"builder_site_name,omitempty"`
+	APIPrefix       string    `json:"api_prefix,omitempty"`
+	RegisteredAt    time.Time `json:"registered_at"`
+}
+
+// BaseURLs returns the builder base URLs a sync tries, in order. BuilderBaseURLs is only set for
+// sites registered with more than one URL; otherwise the list is just BuilderBaseURL.
+func (s RegisteredSite) BaseURLs() []string {
+	if len(s.BuilderBaseURLs) > 0 {
+		return s.BuilderBaseURLs
+	}
+	return []string{s.BuilderBaseURL}
+}
+
+// Attribution models.
+const (
+	// AttributionModelLast attributes an event to the user's most recent utm_source touch.
+	AttributionModelLast = "last"
+	// AttributionModelFirst attributes an event to the user's earliest utm_source touch.
+	AttributionModelFirst = "first"
+)
+
+// Attribution is the utm_source chosen for an event together with how it was derived.
+type Attribution struct {
+	Source        string
+	SourceEventID int64
+	Model         string
+}
+
+// Metadata returns the event metadata recording which model and source event produced the
+// attribution.
+func (a Attribution) Metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"attribution": map[string]interface{}{
+			"model":           a.Model,
+			"source_event_id": a.SourceEventID,
+		},
+	}
 }
 
 // Event models a single append-only row in the event database.
@@ -22,20 +61,124 @@ type Event struct {
 	DedupeKey  string                 `json:"dedupe_key"`
 	IngestedAt time.Time              `json:"ingested_at"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	// RawProperties holds the stored properties text when it is not valid JSON. Properties is
+	// then empty, so one corrupt row does not break listings.
+	RawProperties string `json:"raw_properties,omitempty"`
 }
 
-// SyncSummary aggregates the effects of a sync pass.
+// SyncSummary aggregates the effects of a sync pass. FetchDuration and PersistDuration split
+// the pass's wall time between builder requests and local event inserts.
 type SyncSummary struct {
-	Inserted int `json:"inserted"`
-	Skipped  int `json:"skipped"`
-	Pages    int `json:"pages_processed"`
-	Total    int `json:"total_remote"`
+	Inserted        int           `json:"inserted"`
+	Skipped         int           `json:"skipped"`
+	Pages           int           `json:"pages_processed"`
+	Total           int           `json:"total_remote"`
+	FetchDuration   time.Duration `json:"fetch_duration_ns,omitempty"`
+	PersistDuration time.Duration `json:"persist_duration_ns,omitempty"`
+	// RetriesObserved counts activity attempts that failed before the one that produced this
+	// summary, so flaky upstreams show up even when the sync succeeds.
+	RetriesObserved int `json:"retries_observed,omitempty"`
+}
+
+// SyncWatermark records the last builder change sequence a site has fully ingested.
+type SyncWatermark struct {
+	SiteID    string    `json:"site_id"`
+	Entity    string    `json:"entity"`
+	Seq       int64     `json:"seq"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FeatureFlag is a per-site runtime toggle stored in feature_flags.
+type FeatureFlag struct {
+	SiteID    string    `json:"site_id"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Sync run statuses stored in sync_runs.
+const (
+	SyncRunStatusSuccess   = "success"
+	SyncRunStatusFailed    = "failed"
+	SyncRunStatusCancelled = "cancelled"
+)
+
+// SyncRun is one completed sync workflow recorded in the worker's history.
+type SyncRun struct {
+	ID          int64             `json:"id"`
+	WorkflowID  string            `json:"workflow_id"`
+	RunID       string            `json:"run_id"`
+	SiteID      string            `json:"site_id"`
+	Reason      string            `json:"reason"`
+	Input       SyncWorkflowInput `json:"input"`
+	Status      string            `json:"status"`
+	Inserted    int               `json:"inserted"`
+	Skipped     int               `json:"skipped"`
+	Pages       int               `json:"pages"`
+	StartedAt   time.Time         `json:"started_at"`
+	CompletedAt time.Time         `json:"completed_at"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// EventTimeRange bounds ListEvents by event timestamp. A nil bound is open. The inclusive flags
+// choose >= over > for Start and <= over < for End, so adjacent windows can share a boundary
+// without overlapping.
+type EventTimeRange struct {
+	Start          *time.Time
+	End            *time.Time
+	StartInclusive bool
+	EndInclusive   bool
+}
+
+// SyncRunFilter narrows ListSyncRuns. Before is an opaque cursor returned as NextCursor.
+type SyncRunFilter struct {
+	SiteID string
+	Status string
+	Before string
+	Limit  int
+}
+
+// SyncRunPage is one page of sync history, newest first.
+type SyncRunPage struct {
+	Runs       []SyncRun `json:"runs"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
-// RandomEventRequest describes the payload used to seed ad-hoc events.
+// RandomEventRequest describes the payload used to seed ad-hoc events. Page and Referrer
+// replace the default properties of the same name; Properties are merged over the defaults.
 type RandomEventRequest struct {
-	SiteID    string `json:"site_id"`
-	UserID    string `json:"user_id,omitempty"`
-	EventName string `json:"event_name,omitempty"`
-	UTMSource string `json:"utm_source,omitempty"`
+	SiteID     string         `json:"site_id"`
+	UserID     string         `json:"user_id,omitempty"`
+	EventName  string         `json:"event_name,omitempty"`
+	UTMSource  string         `json:"utm_source,omitempty"`
+	Page       string         `json:"page,omitempty"`
+	Referrer   string         `json:"referrer,omitempty"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// EventCoverage counts how many events of one name carry a non-empty utm_source.
+type EventCoverage struct {
+	EventName  string  `json:"event_name"`
+	Total      int     `json:"total"`
+	Attributed int     `json:"attributed"`
+	Coverage   float64 `json:"coverage"`
+}
+
+// AttributionCoverage summarises utm_source coverage of a site's signup and order events.
+type AttributionCoverage struct {
+	SiteID     string          `json:"site_id"`
+	Total      int             `json:"total"`
+	Attributed int             `json:"attributed"`
+	Coverage   float64         `json:"coverage"`
+	ByEvent    []EventCoverage `json:"by_event"`
+}
+
+// OrderAttribution is one order_created event joined with its user's attribution.
+type OrderAttribution struct {
+	EventID     int64  `json:"event_id"`
+	UserID      string `json:"user_id"`
+	OrderID     string `json:"order_id"`
+	TotalAmount int64  `json:"total_amount"`
+	Currency    string `json:"currency"`
+	UTMSource   string `json:"utm_source"`
 }
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Redirect policies for builder requests. Go's client keeps custom headers such as X-Access-Key
+// when it follows a redirect to another host, so cross-origin redirects are never followed with
+// the key attached.
+const (
+	// RedirectPolicyStrip follows cross-origin redirects without the X-Access-Key header. It is
+	// the default.
+	RedirectPolicyStrip = "strip"
+	// RedirectPolicyDeny fails the request on a cross-origin redirect.
+	RedirectPolicyDeny = "deny"
+)
+
+// ErrBuilderRedirect is returned when RedirectPolicyDeny refuses a cross-origin redirect.
+var ErrBuilderRedirect = errors.New("builder redirected to another origin")
+
+// maxBuilderRedirects matches the net/http default redirect limit.
+const maxBuilderRedirects = 10
+
+// ValidateRedirectPolicy reports whether policy is a known redirect policy.
+func ValidateRedirectPolicy(policy string) error {
+	switch policy {
+	case RedirectPolicyStrip, RedirectPolicyDeny:
+		return nil
+	default:
+		return fmt.Errorf("unknown builder redirect policy %q (want %q or %q)", policy, RedirectPolicyStrip, RedirectPolicyDeny)
+	}
+}
+
+// WithRedirectPolicy sets how the client treats redirects that leave the origin (scheme and
+// host:port) of the original request. Same-origin redirects are always followed.
+func WithRedirectPolicy(policy string) BuilderClientOption {
+	return func(c *BuilderClient) {
+		c.redirectPolicy = policy
+	}
+}
+
+// checkRedirect is the http.Client CheckRedirect hook for the configured policy. Once the key is
+// stripped it stays stripped, since later hops copy headers from the stripped request.
+func (c *BuilderClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxBuilderRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxBuilderRedirects)
+	}
+	origin := via[0].URL
+	if req.URL.Scheme == origin.Scheme && req.URL.Host == origin.Host {
+		return nil
+	}
+	if c.redirectPolicy == RedirectPolicyDeny {
+		return fmt.Errorf("%w: %s -> %s", ErrBuilderRedirect, origin.Host, req.URL.Host)
+	}
+	req.Header.Del("X-Access-Key")
+	return nil
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// PurgeResult reports how many events a retention sweep removed per site.
+type PurgeResult struct {
+	Cutoff time.Time        `json:"cutoff"`
+	Sites  map[string]int64 `json:"sites"`
+	Total  int64            `json:"total"`
+	// SiteCutoffs lists the sites whose event_retention flag replaced the default, with the
+	// cutoff each was purged at. Sites whose flag is 0s are left out and never purged.
+	SiteCutoffs map[string]time.Time `json:"site_cutoffs,omitempty"`
+}
+
+// PurgeExpiredEvents removes events older than the retention period for every site that has
+// events, keeping the first and latest attribution touch per user. A site's event_retention
+// flag takes precedence over retention; a non-positive retention purges only sites that set
+// the flag.
+func (s *Server) PurgeExpiredEvents(ctx context.Context, retention time.Duration) (PurgeResult, error) {
+	now := time.Now().UTC()
+	result := PurgeResult{
+		Cutoff:      now.Add(-retention),
+		Sites:       map[string]int64{},
+		SiteCutoffs: map[string]time.Time{},
+	}
+	siteIDs, err := s.store.EventSiteIDs(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, siteID := range siteIDs {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		cutoff := result.Cutoff
+		if raw := s.flagValue(ctx, siteID, FlagEventRetention); raw != "" {
+			siteRetention, err := time.ParseDuration(raw)
+			if err != nil {
+				s.logger.Warn("invalid event_retention flag; using default", "site_id", siteID, "value", raw, "error", err)
+			} else {
+				if siteRetention <= 0 {
+					continue
+				}
+				cutoff = now.Add(-siteRetention)
+				result.SiteCutoffs[siteID] = cutoff
+			}
+		} else if retention <= 0 {
+			continue
+		}
+		n, err := s.store.PurgeEventsBefore(ctx, siteID, cutoff)
+		if err != nil {
+			return result, err
+		}
+		if n > 0 {
+			result.Sites[siteID] = n
+			result.Total += n
+		}
+	}
+	return result, nil
+}
+
+// StartRetentionPurge begins a ticker-driven loop that purges expired events every interval.
+// A non-positive retention leaves events kept by default; the loop then only purges sites that
+// set their own event_retention flag.
+func (s *Server) StartRetentionPurge(ctx context.Context, retention, interval time.Duration) {
+	if retention <= 0 {
+		s.logger.Info("default event retention disabled; purging only sites with an event_retention flag")
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.logger.Info("retention loop started", "retention", retention, "interval", interval)
+		s.purgeOnce(ctx, retention)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.logger.Info("retention loop stopped", "reason", ctx.Err())
+				return
+			case <-ticker.C:
+				s.purgeOnce(ctx, retention)
+			}
+		}
+	}()
+}
+
+func (s *Server) purgeOnce(ctx context.Context, retention time.Duration) {
+	result, err := s.PurgeExpiredEvents(ctx, retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error("retention purge failed", "error", err)
+		}
+		return
+	}
+	for siteID, n := range result.Sites {
+		s.logger.Info("retention purged site events", "site_id", siteID, "purged", n)
+	}
+	s.logger.Info("retention purge completed", "cutoff", result.Cutoff.Format(time.RFC3339), "purged", result.Total)
+}
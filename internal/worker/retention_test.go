@@ -0,0 +1,113 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPurgeExpiredEventsSiteRetention(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	srv := newTestServer(t, store)
+	old := time.Now().UTC().Add(-100 * 24 * time.Hour)
+	for _, siteID := range []string{"default", "short", "forever"} {
+		mustInsert(t, store, Event{SiteID: siteID, Timestamp: old, UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: siteID + "-touch"})
+		mustInsert(t, store, Event{SiteID: siteID, Timestamp: old.Add(time.Minute), UserID: "u1", EventName: "page_view", DedupeKey: siteID + "-view"})
+	}
+	for siteID, value := range map[string]string{"short": "720h", "forever": "0s"} {
+		if err := store.SetFeatureFlag(ctx, FeatureFlag{SiteID: siteID, Key: FlagEventRetention, Value: value}); err != nil {
+			t.Fatalf("set flag: %v", err)
+		}
+	}
+
+	result, err := srv.PurgeExpiredEvents(ctx, 0)
+	if err != nil {
+		t.Fatalf("purge without default: %v", err)
+	}
+	if result.Total != 1 || result.Sites["short"] != 1 {
+		t.Fatalf("purge without default = %+v, want only the short site's view", result)
+	}
+	if _, ok := result.SiteCutoffs["short"]; !ok || len(result.SiteCutoffs) != 1 {
+		t.Fatalf("site cutoffs = %v, want only short", result.SiteCutoffs)
+	}
+
+	result, err = srv.PurgeExpiredEvents(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("purge with default: %v", err)
+	}
+	if result.Total != 1 || result.Sites["default"] != 1 {
+		t.Fatalf("purge with default = %+v, want only the default site's view", result)
+	}
+	if result.Sites["forever"] != 0 {
+		t.Fatalf("site with 0s retention was purged: %+v", result)
+	}
+}
+
+func TestValidateEventRetentionFlag(t *testing.T) {
+	for _, value := range []string{"", "0s", "2160h"} {
+		if err := validateFeatureFlag(FlagEventRetention, value); err != nil {
+			t.Errorf("validate %q: %v", value, err)
+		}
+	}
+	for _, value := range []string{"soon", "-1h"} {
+		if err := validateFeatureFlag(FlagEventRetention, value); err == nil {
+			t.Errorf("validate %q: want error", value)
+		}
+	}
+}
+
+func TestPurgeEndpointRequiresAdminToken(t *testing.T) {
+	store := newTestStore(t)
+	old := time.Now().UTC().Add(-100 * 24 * time.Hour)
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: old, UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: "touch"})
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: old.Add(time.Minute), UserID: "u1", EventName: "page_view", DedupeKey: "view"})
+	const target = "/worker/events/purge?retention=1ns"
+
+	if rec := serve(t, newTestServer(t, store).Router(), http.MethodPost, target, "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("purge without a configured token: status %d, want 403", rec.Code)
+	}
+	guarded := newTestServer(t, store, WithAdminToken("secret")).Router()
+	if rec := serve(t, guarded, http.MethodPost, target, "", http.Header{"X-Admin-Token": {"nope"}}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("purge with a wrong token: status %d, want 401", rec.Code)
+	}
+	if _, ok, err := store.GetEventByDedupeKey(context.Background(), "s1", "view", ""); err != nil || !ok {
+		t.Fatalf("rejected purge deleted events: ok %v, err %v", ok, err)
+	}
+	if rec := serve(t, guarded, http.MethodPost, target, "", http.Header{"X-Admin-Token": {"secret"}}); rec.Code != http.StatusOK {
+		t.Fatalf("purge with the token: status %d, body %s", rec.Code, rec.Body)
+	}
+	if _, ok, err := store.GetEventByDedupeKey(context.Background(), "s1", "view", ""); err != nil || ok {
+		t.Fatalf("authorized purge kept the expired view: ok %v, err %v", ok, err)
+	}
+}
+
+func TestPurgeKeepsFirstAndLastTouch(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	old := time.Now().UTC().Add(-100 * 24 * time.Hour)
+	for i, source := range []string{"google", "facebook", "newsletter", ""} {
+		mustInsert(t, store, Event{SiteID: "s1", Timestamp: old.Add(time.Duration(i) * time.Hour), UserID: "u1", EventName: "page_view",
+			UTMSource: source, DedupeKey: fmt.Sprintf("view-%d", i)})
+	}
+
+	n, err := store.PurgeEventsBefore(ctx, "s1", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("purged %d events, want the middle touch and the untagged view", n)
+	}
+
+	srv := newTestServer(t, store, WithAttributionModel(AttributionModelFirst))
+	first, ok, err := srv.attributionLookup(ctx, "s1", "order_created")(ctx, "u1")
+	if err != nil || !ok || first.Source != "google" {
+		t.Fatalf("first-touch after purge = %q (ok %v, err %v), want google", first.Source, ok, err)
+	}
+	last, ok, err := store.LatestAttribution(ctx, "s1", "u1")
+	if err != nil || !ok || last.Source != "newsletter" {
+		t.Fatalf("last-touch after purge = %q (ok %v, err %v), want newsletter", last.Source, ok, err)
+	}
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingExchangeRate is returned when normalizing revenue needs a currency with no configured rate.
+var ErrMissingExchangeRate = errors.New("no exchange rate configured")
+
+// ExchangeRates maps an upper-case currency code to the value of one unit of that currency in a
+// shared reference unit. Only ratios matter, so any currency can serve as the reference (e.g.
+// USD=1). Rates are static startup configuration, not live market data.
+type ExchangeRates map[string]float64
+
+// ParseExchangeRates parses a comma-separated list such as "USD=1,KRW=0.00073,JPY=0.0067".
+func ParseExchangeRates(spec string) (ExchangeRates, error) {
+	rates := ExchangeRates{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		code, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("exchange rate %q: want CODE=rate", pair)
+		}
+		code = strings.ToUpper(strings.TrimSpace(code))
+		rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("exchange rate %q: rate must be a positive number", pair)
+		}
+		rates[code] = rate
+	}
+	return rates, nil
+}
+
+// Convert expresses amount of currency from in currency to.
+func (r ExchangeRates) Convert(amount float64, from, to string) (float64, error) {
+	fromRate, ok := r[from]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrMissingExchangeRate, from)
+	}
+	toRate, ok := r[to]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrMissingExchangeRate, to)
+	}
+	return amount * fromRate / toRate, nil
+}
+
+// CurrencyRevenue sums a site's order_created events in one currency.
+type CurrencyRevenue struct {
+	Currency string `json:"currency"`
+	Orders   int    `json:"orders"`
+	Total    int64  `json:"total_amount"`
+}
+
+// SourceRevenue sums a site's order_created events attributed to one utm_source in one currency.
+// Source is empty for unattributed orders.
+type SourceRevenue struct {
+	Source      string `json:"utm_source"`
+	Currency    string `json:"currency"`
+	Orders      int    `json:"orders"`
+	TotalAmount int64  `json:"total_amount"`
+}
+
+// RevenueReport lists revenue per currency and, when requested, a total normalized into a
+// single currency using the configured exchange rates.
+type RevenueReport struct {
+	SiteID             string            `json:"site_id"`
+	Currencies         []CurrencyRevenue `json:"currencies"`
+	NormalizedCurrency string            `json:"normalized_currency,omitempty"`
+	NormalizedTotal    *float64          `json:"normalized_total,omitempty"`
+}
+
+// Revenue builds the revenue report for orders placed within [start, end]. When normalize is
+// set, every currency is converted into it and summed; a currency without a rate fails the
+// whole report rather than being silently dropped from the total.
+func (s *Server) Revenue(ctx context.Context, siteID string, start, end *time.Time, normalize string) (RevenueReport, error) {
+	currencies, err := s.store.RevenueByCurrency(ctx, siteID, start, end)
+	if err != nil {
+		return RevenueReport{}, err
+	}
+	report := RevenueReport{SiteID: siteID, Currencies: currencies}
+	normalize = strings.ToUpper(strings.TrimSpace(normalize))
+	if normalize == "" {
+		return report, nil
+	}
+	if _, ok := s.exchangeRates[normalize]; !ok {
+		return RevenueReport{}, fmt.Errorf("%w for %s", ErrMissingExchangeRate, normalize)
+	}
+	var total float64
+	for _, c := range currencies {
+		converted, err := s.exchangeRates.Convert(float64(c.Total), c.Currency, normalize)
+		if err != nil {
+			return RevenueReport{}, err
+		}
+		total += converted
+	}
+	report.NormalizedCurrency = normalize
+	report.NormalizedTotal = &total
+	return report, nil
+}
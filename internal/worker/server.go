@@ -2,19 +2,25 @@ package worker
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
+
+	"example.com/temporal-go/internal/metrics"
 )
 
 // Server exposes endpoints that mimic the worker's public API surface.
@@ -24,19 +30,148 @@ type Server struct {
 	store         *Store
 	builderClient *BuilderClient
 	orchestrator  SyncOrchestrator
+	sink          EventSink
+	sinkQueue     *sinkQueue
+	metrics       *metrics.Registry
+	exchangeRates ExchangeRates
 	logger        *slog.Logger
+
+	// pageConcurrency is how many user/order pages a paged sync fetches at once.
+	pageConcurrency int
+	// builderPageSize is the page_size (and changes limit) requested from the builder.
+	builderPageSize int
+	config          Config
+	adminToken      string
+	// skipLogEvery logs one in this many dedupe-skipped sync events; 0 logs only the totals.
+	skipLogEvery int
+	skipCount    atomic.Int64
+	// suppressAttribution lists event names every site syncs without utm_source attribution.
+	suppressAttribution []string
+	// attributionModel is the attribution_model of sites that have not set the flag.
+	attributionModel string
+	// autoSyncCron is the cron expression of per-site autosync workflows once StartAutoSyncCron
+	// has run; empty in ticker mode.
+	autoSyncCron string
+
+	// background tracks long-running loops (autosync, retention) so shutdown can drain them.
+	background sync.WaitGroup
+	autoSync   autoSyncTracker
+}
+
+// ServerOption customises optional Server collaborators.
+type ServerOption func(*Server)
+
+// WithMetrics exposes reg at /worker/debug/metrics.
+func WithMetrics(reg *metrics.Registry) ServerOption {
+	return func(s *Server) {
+		s.metrics = reg
+	}
+}
+
+// WithEventSink forwards every inserted event to sink in addition to SQLite.
+func WithEventSink(sink EventSink) ServerOption {
+	return func(s *Server) {
+		s.sink = sink
+	}
+}
+
+// WithExchangeRates enables ?normalize= on the revenue endpoint using static rates.
+func WithExchangeRates(rates ExchangeRates) ServerOption {
+	return func(s *Server) {
+		s.exchangeRates = rates
+	}
+}
+
+// WithAdminToken requires the X-Admin-Token header on cross-site admin endpoints. Those
+// endpoints are disabled when no token is set.
+func WithAdminToken(token string) ServerOption {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithConfig exposes cfg, redacted, at /worker/config.
+func WithConfig(cfg Config) ServerOption {
+	return func(s *Server) {
+		s.config = cfg
+	}
+}
+
+// WithSkipLogSample logs one in every n sync events skipped as already stored, so a large
+// re-sync stays observable without a line per event. n <= 0 keeps the per-page totals only.
+func WithSkipLogSample(n int) ServerOption {
+	return func(s *Server) {
+		s.skipLogEvery = n
+	}
+}
+
+// WithAttributionModel makes model, AttributionModelLast or AttributionModelFirst, the
+// attribution_model of every site that has not set the flag itself.
+func WithAttributionModel(model string) ServerOption {
+	return func(s *Server) {
+		s.attributionModel = model
+	}
+}
+
+// WithSuppressedAttribution syncs events with these names on every site without inheriting a
+// utm_source, for events such as internal admin actions that no campaign should claim. Sites can
+// suppress further names with the suppress_attribution flag.
+func WithSuppressedAttribution(eventNames []string) ServerOption {
+	return func(s *Server) {
+		s.suppressAttribution = eventNames
+	}
+}
+
+// MaxSyncPageConcurrency caps WithSyncPageConcurrency so one sync cannot flood the builder.
+const MaxSyncPageConcurrency = 16
+
+// ClampSyncPageConcurrency bounds n to [1, MaxSyncPageConcurrency].
+func ClampSyncPageConcurrency(n int) int {
+	return min(max(n, 1), MaxSyncPageConcurrency)
+}
+
+// WithSyncPageConcurrency lets paged user/order syncs fetch up to n pages in parallel once the
+// first page has reported the total. n is clamped with ClampSyncPageConcurrency; 1 keeps the
+// serial behaviour.
+func WithSyncPageConcurrency(n int) ServerOption {
+	return func(s *Server) {
+		s.pageConcurrency = ClampSyncPageConcurrency(n)
+	}
 }
 
 const (
-	maxPageSize            = 10
+	defaultBuilderPageSize = 10
 	autoSyncPerSiteTimeout = 2 * time.Minute
 )
 
+// MaxBuilderPageSize matches the builder's hard page size ceiling.
+const MaxBuilderPageSize = 500
+
+// ClampBuilderPageSize bounds n to [1, MaxBuilderPageSize].
+func ClampBuilderPageSize(n int) int {
+	return min(max(n, 1), MaxBuilderPageSize)
+}
+
+// WithBuilderPageSize requests pages of n users or orders from the builder instead of 10. The
+// builder only serves them when started with a --max-page-size at least as large; otherwise it
+// returns smaller pages, and the sync follows the page_size it reports.
+func WithBuilderPageSize(n int) ServerOption {
+	return func(s *Server) {
+		s.builderPageSize = ClampBuilderPageSize(n)
+	}
+}
+
 // SyncOrchestrator abstracts how sync operations are executed. For production we
 // back this with a Temporal workflow runner so all syncs flow through the same pipeline.
 type SyncOrchestrator interface {
 	RunSync(ctx context.Context, input SyncWorkflowInput) (SyncWorkflowResult, error)
 	RunSyncAsync(ctx context.Context, input SyncWorkflowInput) (string, error)
+	WorkflowHistory(ctx context.Context, workflowID string, afterEventID int64, limit int) ([]WorkflowHistoryEvent, int64, error)
+	RunningWorkflows(ctx context.Context) (int64, error)
+	CancelSync(ctx context.Context, workflowID string) error
+	ListActiveSyncs(ctx context.Context, siteID string) ([]ActiveSync, error)
+	ScheduleSync(ctx context.Context, input SyncWorkflowInput, cron string) (string, error)
+	UnscheduleSync(ctx context.Context, siteID string) error
 }
 
 // SyncWorkflowInput carries parameters into the Temporal workflow.
@@ -47,32 +182,97 @@ type SyncWorkflowInput struct {
 	Page          int        `json:"page"`
 	IncludeUsers  bool       `json:"include_users"`
 	IncludeOrders bool       `json:"include_orders"`
-	Reason        string     `json:"reason"`
+	// UseChanges resumes from the site's stored watermark via the builder changes feed
+	// instead of paging users/orders by date.
+	UseChanges bool   `json:"use_changes,omitempty"`
+	Reason     string `json:"reason"`
+	// BuilderBaseURL, when set, replaces the registered site's builder URL for this run only.
+	// recordRun clears it before the input is stored in sync_runs, so replays use the
+	// registered URL.
+	BuilderBaseURL string `json:"builder_base_url,omitempty"`
+	// ReplayOf is the sync_runs id this input was reconstructed from, when the run is a replay.
+	ReplayOf int64 `json:"replay_of,omitempty"`
+	// Progress is set by the workflow when it continues as new; callers leave it nil.
+	Progress *SyncProgress `json:"progress,omitempty"`
 }
 
-// SyncWorkflowResult captures the combined workflow output.
+// SyncProgress carries a sync across continue-as-new runs: which paged phases are done, where
+// the orders phase resumes, and the totals earlier runs accumulated. Page on the input is the
+// page the users phase resumes at, or the orders phase once users are done.
+type SyncProgress struct {
+	UsersDone      bool          `json:"users_done,omitempty"`
+	OrdersDone     bool          `json:"orders_done,omitempty"`
+	OrdersPage     int           `json:"orders_page"`
+	Users          *SyncSummary  `json:"users,omitempty"`
+	Orders         *SyncSummary  `json:"orders,omitempty"`
+	UsersDuration  time.Duration `json:"users_duration_ns,omitempty"`
+	OrdersDuration time.Duration `json:"orders_duration_ns,omitempty"`
+	StartedAt      time.Time     `json:"started_at"`
+	Continuations  int           `json:"continuations"`
+}
+
+// ErrNothingToSync rejects workflow input that selects no entity to sync.
+var ErrNothingToSync = errors.New("nothing to sync: set include_users, include_orders, or use_changes")
+
+// Validate reports input the sync workflow would not be able to act on.
+func (in SyncWorkflowInput) Validate() error {
+	if in.SiteID == "" {
+		return errors.New("site_id required")
+	}
+	if !in.IncludeUsers && !in.IncludeOrders && !in.UseChanges {
+		return ErrNothingToSync
+	}
+	return nil
+}
+
+// SyncWorkflowResult captures the combined workflow output. The per-phase durations are
+// measured with workflow time around each phase's activities, so they include retries.
 type SyncWorkflowResult struct {
-	WorkflowID  string       `json:"workflow_id"`
-	RunID       string       `json:"run_id"`
-	Users       *SyncSummary `json:"users,omitempty"`
-	Orders      *SyncSummary `json:"orders,omitempty"`
-	StartedAt   time.Time    `json:"started_at"`
-	CompletedAt time.Time    `json:"completed_at"`
+	WorkflowID      string        `json:"workflow_id"`
+	RunID           string        `json:"run_id"`
+	Users           *SyncSummary  `json:"users,omitempty"`
+	Orders          *SyncSummary  `json:"orders,omitempty"`
+	Changes         *SyncSummary  `json:"changes,omitempty"`
+	StartedAt       time.Time     `json:"started_at"`
+	CompletedAt     time.Time     `json:"completed_at"`
+	UsersDuration   time.Duration `json:"users_duration_ns,omitempty"`
+	OrdersDuration  time.Duration `json:"orders_duration_ns,omitempty"`
+	ChangesDuration time.Duration `json:"changes_duration_ns,omitempty"`
+	// Continuations counts the continue-as-new runs the sync took; 0 when it fit in one run.
+	Continuations int `json:"continuations,omitempty"`
+	// Cancelled is set when a sync.cancel signal stopped the sync early; the summaries then
+	// cover only what ran before it.
+	Cancelled bool `json:"cancelled,omitempty"`
 }
 
 // NewServer creates a worker server with the required collaborators wired in.
-func NewServer(store *Store, client *BuilderClient, orchestrator SyncOrchestrator, logger *slog.Logger) *Server {
-	return &Server{
+func NewServer(store *Store, client *BuilderClient, orchestrator SyncOrchestrator, logger *slog.Logger, opts ...ServerOption) *Server {
+	s := &Server{
 		store:         store,
 		builderClient: client,
 		orchestrator:  orchestrator,
+		sink:          NopEventSink{},
 		logger:        logger,
+
+		pageConcurrency: 1,
+		builderPageSize: defaultBuilderPageSize,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.startEventSink()
+	return s
+}
+
+// SyncPageConcurrency reports the effective page fetch concurrency after clamping.
+func (s *Server) SyncPageConcurrency() int {
+	return s.pageConcurrency
 }
 
 // Router configures all worker routes.
 func (s *Server) Router() http.Handler {
 	r := chi.NewRouter()
+	r.Use(negotiateJSONFormat)
 	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 	})
@@ -80,68 +280,138 @@ func (s *Server) Router() http.Handler {
 	r.Route("/worker", func(r chi.Router) {
 		r.Get("/sites", s.handleListSites)
 		r.Post("/sites", s.handleRegisterSite)
+		r.With(s.requireAdminToken).Delete("/sites", s.handleBulkUnregisterSites)
+		r.Get("/sites/{siteID}", s.handleGetSite)
 		r.Delete("/sites/{siteID}", s.handleUnregisterSite)
 
 		// Sync endpoints allow external schedulers or cronjobs to tell the worker to ingest
 		// data from the builder. All heavy lifting happens inside the handler to keep the flow visible.
 		r.Post("/sites/{siteID}/sync/users", s.handleSyncUsers)
 		r.Post("/sites/{siteID}/sync/orders", s.handleSyncOrders)
+		r.Post("/sites/{siteID}/sync/changes", s.handleSyncChanges)
+		r.Post("/sites/{siteID}/sync", s.handleSync)
+		r.Post("/sites/{siteID}/backfill", s.handleBackfill)
+		r.Get("/sites/{siteID}/watermark", s.handleGetWatermarks)
+		r.Put("/sites/{siteID}/watermark", s.handleSetWatermark)
+		r.Get("/sites/{siteID}/flags", s.handleListFlags)
+		r.Put("/sites/{siteID}/flags/{key}", s.handleSetFlag)
+		r.Delete("/sites/{siteID}/flags/{key}", s.handleDeleteFlag)
+		r.Get("/sites/{siteID}/conversion-latency", s.handleConversionLatency)
+		r.Get("/sites/{siteID}/revenue", s.handleRevenue)
+		r.Get("/sites/{siteID}/attribution-map", s.handleAttributionMap)
+		r.Get("/sites/{siteID}/attribution-coverage", s.handleAttributionCoverage)
+		r.Get("/sites/{siteID}/distinct-users", s.handleDistinctUsers)
+		r.Get("/sites/{siteID}/orders-with-attribution", s.handleOrdersWithAttribution)
+		r.Post("/sites/{siteID}/backfill-attribution", s.handleBackfillAttribution)
+		r.Post("/attribution/resolve", s.handleResolveAttribution)
 
 		// Event seeding helpers make it easy to test UTM attribution propagation.
 		r.Post("/events/random", s.handleRandomEvent)
 		r.Post("/events", s.handleManualEvent)
+		r.Post("/events/dedupe-key", s.handleDedupeKeyPreview)
 		r.Get("/events", s.handleListEvents)
+		r.Get("/events/cdc", s.handleEventsCDC)
+		r.With(s.requireAdminToken).Get("/users/{userID}/sites", s.handleUserSites)
+		r.With(s.requireAdminToken).Post("/events/purge", s.handlePurgeEvents)
+
+		r.Get("/reports/funnel", s.handleFunnel)
+		r.Get("/reports/revenue", s.handleRevenueByAttribution)
+
+		r.Get("/sync/{workflowID}/history", s.handleWorkflowHistory)
+		r.Post("/syncs/{workflowID}/cancel", s.handleCancelSync)
+		r.Get("/sync-runs", s.handleListSyncRuns)
+		r.Get("/syncs", s.handleListSyncRuns)
+		r.Get("/syncs/active", s.handleListActiveSyncs)
+		r.Get("/sync-runs/summary", s.handleSyncRunSummary)
+		r.Post("/sync-runs/{id}/replay", s.handleReplaySyncRun)
+
+		r.Get("/debug/metrics", s.handleMetrics)
+		r.Get("/config", s.handleConfig)
+		r.Get("/status", s.handleStatus)
+		r.With(s.requireAdminToken).Get("/export", s.handleExport)
+		r.With(s.requireAdminToken).Post("/import", s.handleImport)
 	})
 
 	return r
 }
 
+// maxBuilderBaseURLs caps how many builder endpoints one site can register.
+const maxBuilderBaseURLs = 5
+
 func (s *Server) handleRegisterSite(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
-		SiteID         string `json:"site_id"`
-		AccessKey      string `json:"access_key"`
-		BuilderBaseURL string `json:"builder_base_url"`
+		SiteID          string   `json:"site_id"`
+		AccessKey       string   `json:"access_key"`
+		BuilderBaseURL  string   `json:"builder_base_url"`
+		BuilderBaseURLs []string `json:"builder_base_urls"`
+		APIPrefix       string   `json:"api_prefix"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
 		return
 	}
+	payload.SiteID = strings.TrimSpace(payload.SiteID)
+	apiPrefix, err := normalizeAPIPrefix(payload.APIPrefix)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	baseURLs := builderBaseURLList(payload.BuilderBaseURL, payload.BuilderBaseURLs)
 
-	if strings.TrimSpace(payload.SiteID) == "" ||
+	if payload.SiteID == "" ||
 		strings.TrimSpace(payload.AccessKey) == "" ||
-		strings.TrimSpace(payload.BuilderBaseURL) == "" {
+		len(baseURLs) == 0 {
 		writeError(w, http.StatusBadRequest, "site_id, access_key, and builder_base_url are required")
 		return
 	}
-
-	if _, err := url.ParseRequestURI(payload.BuilderBaseURL); err != nil {
-		writeError(w, http.StatusBadRequest, "builder_base_url must be a valid URL")
+	if len(baseURLs) > maxBuilderBaseURLs {
+		writeError(w, http.StatusBadRequest, "at most %d builder base URLs per site", maxBuilderBaseURLs)
 		return
 	}
+	for _, baseURL := range baseURLs {
+		if _, err := url.ParseRequestURI(baseURL); err != nil {
+			writeError(w, http.StatusBadRequest, "builder_base_url must be a valid URL")
+			return
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
 	defer cancel()
 
-	siteProfile, err := s.builderClient.FetchSiteProfile(ctx, payload.BuilderBaseURL, payload.SiteID, payload.AccessKey)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, "validate against builder: %v", err)
-		return
-	}
-
 	record := RegisteredSite{
 		SiteID:         payload.SiteID,
 		AccessKey:      payload.AccessKey,
-		BuilderBaseURL: payload.BuilderBaseURL,
+		BuilderBaseURL: baseURLs[0],
+		APIPrefix:      apiPrefix,
 		RegisteredAt:   time.Now().UTC(),
 	}
+	if len(baseURLs) > 1 {
+		record.BuilderBaseURLs = baseURLs
+	}
+	var siteProfile BuilderSite
+	err = s.withBuilderFailover(ctx, record, func(baseURL string) (err error) {
+		siteProfile, err = s.builderClient.FetchSiteProfile(ctx, baseURL, record.APIPrefix, payload.SiteID, payload.AccessKey)
+		return err
+	})
+	if err != nil {
+		writeError(w, builderErrorStatus(err), "validate against builder: %v", err)
+		return
+	}
+	record.BuilderSiteName = siteProfile.Name
+
 	if err := s.store.RegisterSite(r.Context(), record); err != nil {
+		if errors.Is(err, ErrSiteIDConflict) {
+			writeError(w, http.StatusConflict, "%v", err)
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "register site: %v", err)
 		return
 	}
 
-	s.logger.Info("worker site registered", "site_id", record.SiteID, "builder_base_url", record.BuilderBaseURL)
+	s.logger.Info("worker site registered", "site_id", record.SiteID, "builder_base_urls", record.BaseURLs())
+	s.reconcileAutoSyncSchedule(r.Context(), record.SiteID)
 
-	writeJSON(w, http.StatusCreated, map[string]any{
+	resp := map[string]any{
 		"site_id":          record.SiteID,
 		"builder_base_url": record.BuilderBaseURL,
 		"registered_at":    record.RegisteredAt.Format(time.RFC3339),
@@ -150,7 +420,44 @@ func (s *Server) handleRegisterSite(w http.ResponseWriter, r *http.Request) {
 			"name":       siteProfile.Name,
 			"created_at": siteProfile.CreatedAt,
 		},
-	})
+	}
+	if len(record.BuilderBaseURLs) > 0 {
+		resp["builder_base_urls"] = record.BuilderBaseURLs
+	}
+	if record.APIPrefix != "" {
+		resp["api_prefix"] = record.APIPrefix
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// normalizeAPIPrefix validates a registration's api_prefix and strips its trailing slash. An
+// empty prefix, or the default one, is stored as "" so the site follows DefaultBuilderAPIPrefix.
+func normalizeAPIPrefix(raw string) (string, error) {
+	prefix := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if prefix == "" || prefix == DefaultBuilderAPIPrefix {
+		return "", nil
+	}
+	u, err := url.Parse(prefix)
+	if err != nil || !strings.HasPrefix(prefix, "/") || u.Path != prefix {
+		return "", fmt.Errorf("api_prefix must be a URL path starting with /, such as /api/v2")
+	}
+	return prefix, nil
+}
+
+// builderBaseURLList merges the single and list registration fields into one ordered,
+// de-duplicated list. builder_base_url, when given, goes first.
+func builderBaseURLList(single string, list []string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, raw := range append([]string{single}, list...) {
+		u := strings.TrimSpace(raw)
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+	return urls
 }
 
 func (s *Server) handleUnregisterSite(w http.ResponseWriter, r *http.Request) {
@@ -169,14 +476,90 @@ func (s *Server) handleUnregisterSite(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 	s.logger.Info("worker site unregistered", "site_id", siteID)
+	s.unscheduleAutoSync(r.Context(), siteID)
+}
+
+// handleBulkUnregisterSites unregisters every site matching ?registered_before= and/or a body
+// {"site_ids": [...]}. At least one filter is required so a bare DELETE cannot empty the registry.
+func (s *Server) handleBulkUnregisterSites(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		SiteIDs []string `json:"site_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+			return
+		}
+	}
+	filter := SiteFilter{}
+	for _, id := range payload.SiteIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			filter.SiteIDs = append(filter.SiteIDs, id)
+		}
+	}
+	if raw := strings.TrimSpace(r.URL.Query().Get("registered_before")); raw != "" {
+		ts, err := parseTime(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "registered_before: %v", err)
+			return
+		}
+		filter.RegisteredBefore = &ts
+	}
+	if filter.Empty() {
+		writeError(w, http.StatusBadRequest, "registered_before or site_ids is required")
+		return
+	}
+	purgeEvents := r.URL.Query().Get("purge_events") == "true"
+	result, err := s.store.UnregisterSites(r.Context(), filter, purgeEvents)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "unregister sites: %v", err)
+		return
+	}
+	s.logger.Info("worker sites unregistered in bulk",
+		"registered_before", formatTimePtr(filter.RegisteredBefore),
+		"requested_site_ids", len(filter.SiteIDs),
+		"site_ids", result.SiteIDs,
+		"unregistered", result.Unregistered,
+		"purge_events", purgeEvents,
+		"events_purged", result.EventsPurged)
+	s.unscheduleAutoSync(r.Context(), result.SiteIDs...)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleGetSite returns one registered site. The access key is masked unless reveal_key=true,
+// which requires the admin token.
+func (s *Server) handleGetSite(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	site, err := s.store.GetSite(r.Context(), siteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	if r.URL.Query().Get("reveal_key") == "true" {
+		if !s.checkAdminToken(w, r) {
+			return
+		}
+	} else {
+		site.AccessKey = maskSecret(site.AccessKey)
+	}
+	writeJSON(w, http.StatusOK, site)
 }
 
+// handleListSites returns every registered site with its access key masked. Use handleGetSite
+// with reveal_key to read one key.
 func (s *Server) handleListSites(w http.ResponseWriter, r *http.Request) {
 	sites, err := s.store.ListSites(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "list sites: %v", err)
 		return
 	}
+	for i := range sites {
+		sites[i].AccessKey = maskSecret(sites[i].AccessKey)
+	}
 	writeJSON(w, http.StatusOK, map[string]any{"sites": sites})
 }
 
@@ -195,7 +578,7 @@ func (s *Server) handleSyncUsers(w http.ResponseWriter, r *http.Request) {
 	page := parseIntDefault(r.URL.Query().Get("page"), 1)
 	start, end, err := parseDateRange(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusBadRequest, "%v", err)
 		return
 	}
 
@@ -219,6 +602,7 @@ func (s *Server) handleSyncUsers(w http.ResponseWriter, r *http.Request) {
 	}
 	if result.Users != nil {
 		payload["synced"] = result.Users
+		payload["duration_ns"] = result.UsersDuration
 	}
 	writeJSON(w, http.StatusOK, payload)
 }
@@ -238,7 +622,7 @@ func (s *Server) handleSyncOrders(w http.ResponseWriter, r *http.Request) {
 	page := parseIntDefault(r.URL.Query().Get("page"), 1)
 	start, end, err := parseDateRange(r)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusBadRequest, "%v", err)
 		return
 	}
 
@@ -262,289 +646,1642 @@ func (s *Server) handleSyncOrders(w http.ResponseWriter, r *http.Request) {
 	}
 	if result.Orders != nil {
 		payload["synced"] = result.Orders
+		payload["duration_ns"] = result.OrdersDuration
 	}
 	writeJSON(w, http.StatusOK, payload)
 }
 
-type pagedFetcher func(ctx context.Context, site RegisteredSite, page int, start, end *time.Time) (pagedResult, error)
-
-type pagedResult struct {
-	page     int
-	total    int
-	hasMore  bool
-	nextPage *int
-	inserted int
-	skipped  int
-}
-
-func (s *Server) fetchUsersPage(ctx context.Context, site RegisteredSite, page int, start, end *time.Time) (pagedResult, error) {
-	resp, err := s.builderClient.FetchUsers(ctx, site.BuilderBaseURL, site.SiteID, site.AccessKey, page, maxPageSize, start, end)
-	if err != nil {
-		return pagedResult{}, err
-	}
-	inserted, skipped, err := s.persistUsers(ctx, site, resp.Users)
+// handleSync accepts the full workflow input as a JSON body so callers can combine entities and
+// date filters in ways the per-entity query-param endpoints cannot.
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	site, err := s.store.GetSite(r.Context(), siteID)
 	if err != nil {
-		return pagedResult{}, err
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
 	}
-	return pagedResult{
-		page:     resp.Page,
-		total:    resp.Total,
-		hasMore:  resp.HasMore,
-		nextPage: resp.NextPage,
-		inserted: inserted,
-		skipped:  skipped,
-	}, nil
-}
 
-func (s *Server) fetchOrdersPage(ctx context.Context, site RegisteredSite, page int, start, end *time.Time) (pagedResult, error) {
-	resp, err := s.builderClient.FetchOrders(ctx, site.BuilderBaseURL, site.SiteID, site.AccessKey, page, maxPageSize, start, end)
-	if err != nil {
-		return pagedResult{}, err
+	var payload struct {
+		IncludeUsers   bool   `json:"include_users"`
+		IncludeOrders  bool   `json:"include_orders"`
+		Start          string `json:"start"`
+		End            string `json:"end"`
+		Page           int    `json:"page"`
+		Reason         string `json:"reason"`
+		BuilderBaseURL string `json:"builder_base_url"`
 	}
-	inserted, skipped, err := s.persistOrders(ctx, site, resp.Orders)
-	if err != nil {
-		return pagedResult{}, err
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
 	}
-	return pagedResult{
-		page:     resp.Page,
-		total:    resp.Total,
-		hasMore:  resp.HasMore,
-		nextPage: resp.NextPage,
-		inserted: inserted,
-		skipped:  skipped,
-	}, nil
-}
-
-func (s *Server) syncSite(ctx context.Context, site RegisteredSite, page int, start, end *time.Time, fetch pagedFetcher) (SyncSummary, error) {
-	summary := SyncSummary{}
-	currentPage := page
-	for {
-		if err := ctx.Err(); err != nil {
-			return summary, err
-		}
-		res, err := fetch(ctx, site, currentPage, start, end)
-		if err != nil {
-			return summary, err
+	input := SyncWorkflowInput{
+		SiteID:         site.SiteID,
+		Page:           payload.Page,
+		IncludeUsers:   payload.IncludeUsers,
+		IncludeOrders:  payload.IncludeOrders,
+		Reason:         payload.Reason,
+		BuilderBaseURL: strings.TrimSpace(payload.BuilderBaseURL),
+	}
+	if input.BuilderBaseURL != "" {
+		// The run sends the site's access key to the override, so only admins may redirect it.
+		if !s.checkAdminToken(w, r) {
+			return
 		}
-		summary.Inserted += res.inserted
-		summary.Skipped += res.skipped
-		summary.Pages++
-		if res.total > summary.Total {
-			summary.Total = res.total
+		if err := validateBuilderBaseURL(input.BuilderBaseURL); err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
 		}
-		if !res.hasMore {
-			break
+		s.logger.Warn("sync using builder base URL override", "site_id", site.SiteID, "registered_urls", site.BaseURLs(), "override_url", input.BuilderBaseURL)
+	}
+	if input.Page < 1 {
+		input.Page = 1
+	}
+	if strings.TrimSpace(input.Reason) == "" {
+		input.Reason = "api-sync"
+	}
+	if payload.Start != "" {
+		ts, err := parseTime(payload.Start)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "start: %v", err)
+			return
 		}
-		if res.nextPage != nil {
-			currentPage = *res.nextPage
-		} else {
-			currentPage++
+		input.Start = &ts
+	}
+	if payload.End != "" {
+		ts, err := parseTime(payload.End)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "end: %v", err)
+			return
 		}
+		input.End = &ts
+	}
+
+	if err := input.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	result, err := s.runSyncInput(r.Context(), input)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "sync via workflow: %v", err)
+		return
 	}
-	return summary, nil
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id": site.SiteID,
+		"input":   input,
+		"result":  result,
+	})
 }
 
-func (s *Server) runSyncWorkflow(ctx context.Context, site RegisteredSite, includeUsers, includeOrders bool, page int, start, end *time.Time, reason string) (SyncWorkflowResult, error) {
-	if s.orchestrator == nil {
-		return SyncWorkflowResult{}, errors.New("sync orchestrator not configured")
+// handleBackfill syncs one historical [start, end] window for the selected entity types in a
+// single workflow run. Both entity types are included unless the body says otherwise.
+func (s *Server) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	site, err := s.store.GetSite(r.Context(), siteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+
+	var payload struct {
+		Start         string `json:"start"`
+		End           string `json:"end"`
+		IncludeUsers  *bool  `json:"include_users"`
+		IncludeOrders *bool  `json:"include_orders"`
+		Reason        string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	if payload.Start == "" || payload.End == "" {
+		writeError(w, http.StatusBadRequest, "start and end are required")
+		return
+	}
+	start, err := parseTime(payload.Start)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "start: %v", err)
+		return
+	}
+	end, err := parseTime(payload.End)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "end: %v", err)
+		return
+	}
+	if !start.Before(end) {
+		writeError(w, http.StatusBadRequest, "start must be before end")
+		return
 	}
 	input := SyncWorkflowInput{
 		SiteID:        site.SiteID,
-		Start:         start,
-		End:           end,
-		Page:          page,
-		IncludeUsers:  includeUsers,
-		IncludeOrders: includeOrders,
-		Reason:        reason,
+		Start:         &start,
+		End:           &end,
+		Page:          1,
+		IncludeUsers:  payload.IncludeUsers == nil || *payload.IncludeUsers,
+		IncludeOrders: payload.IncludeOrders == nil || *payload.IncludeOrders,
+		Reason:        defaultString(payload.Reason, "api-backfill"),
 	}
-	result, err := s.orchestrator.RunSync(ctx, input)
+	if err := input.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	result, err := s.runSyncInput(r.Context(), input)
 	if err != nil {
-		s.logger.Error("workflow sync failed", "site_id", site.SiteID, "reason", reason, "error", err)
-		return result, err
+		writeError(w, http.StatusBadGateway, "backfill via workflow: %v", err)
+		return
 	}
-	s.logger.Info("workflow sync completed", "site_id", site.SiteID, "reason", reason, "workflow_id", result.WorkflowID, "run_id", result.RunID, "include_users", includeUsers, "include_orders", includeOrders)
-	return result, nil
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id": site.SiteID,
+		"input":   input,
+		"result":  result,
+	})
 }
 
-// syncEntities is a shared workflow between user and order synchronisation. The comment explains
-// the "activity" like flow so non-Go readers can trace the steps.
-//
-//  1. Determine the target site and interpret optional date filters from the request.
-//  2. Loop over pages from the builder API (enforcing the 10 item max) until the remote endpoint
-//     signals there are no additional pages.
-//  3. Persist each entity as an event while pulling the latest attribution data from the event store.
-//  4. Aggregate stats (inserted/skipped counts) and expose them in the HTTP response.
-func (s *Server) persistUsers(ctx context.Context, site RegisteredSite, users []BuilderUser) (int, int, error) {
-	inserted := 0
-	skipped := 0
-	for _, user := range users {
-		utm, ok, err := s.store.LatestAttribution(ctx, user.ID)
-		if err != nil {
-			return 0, 0, err
-		}
-		event := Event{
+// handleSyncChanges runs a resumable sync that picks up from the site's stored watermark.
+func (s *Server) handleSyncChanges(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	site, err := s.store.GetSite(r.Context(), siteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+
+	result, err := s.runSyncInput(r.Context(), SyncWorkflowInput{
+		SiteID:     site.SiteID,
+		UseChanges: true,
+		Reason:     "api-sync-changes",
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "sync via workflow: %v", err)
+		return
+	}
+
+	payload := map[string]any{
+		"site_id":      site.SiteID,
+		"workflow_id":  result.WorkflowID,
+		"run_id":       result.RunID,
+		"started_at":   result.StartedAt.Format(time.RFC3339Nano),
+		"completed_at": result.CompletedAt.Format(time.RFC3339Nano),
+	}
+	if result.Changes != nil {
+		payload["synced"] = result.Changes
+		payload["duration_ns"] = result.ChangesDuration
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) handleGetWatermarks(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	watermarks, err := s.store.ListWatermarks(r.Context(), siteID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "list watermarks: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id":    siteID,
+		"watermarks": watermarks,
+	})
+}
+
+// handleSetWatermark overwrites a site's stored watermark so the next changes sync resumes
+// elsewhere: back to re-ingest a period, or forward past bad data. The body names the entity and
+// either the seq itself or a timestamp, which is resolved through the builder changes feed.
+func (s *Server) handleSetWatermark(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	var payload struct {
+		Entity    string `json:"entity"`
+		Seq       *int64 `json:"seq"`
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	entity := defaultString(strings.TrimSpace(payload.Entity), changesWatermarkEntity)
+	if entity != changesWatermarkEntity {
+		writeError(w, http.StatusBadRequest, "entity must be %q", changesWatermarkEntity)
+		return
+	}
+	if (payload.Seq == nil) == (payload.Timestamp == "") {
+		writeError(w, http.StatusBadRequest, "exactly one of seq or timestamp is required")
+		return
+	}
+	var seq int64
+	var at *time.Time
+	if payload.Seq != nil {
+		if *payload.Seq < 0 {
+			writeError(w, http.StatusBadRequest, "seq must be non-negative")
+			return
+		}
+		seq = *payload.Seq
+	} else {
+		ts, err := parseTime(payload.Timestamp)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "timestamp: %v", err)
+			return
+		}
+		if ts.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, "timestamp must not be in the future")
+			return
+		}
+		at = &ts
+		seq, err = s.changesSeqBefore(r.Context(), site, ts)
+		if err != nil {
+			writeError(w, builderErrorStatus(err), "resolve timestamp against builder: %v", err)
+			return
+		}
+	}
+	previous, _, err := s.store.GetWatermark(r.Context(), site.SiteID, entity)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	wm := SyncWatermark{SiteID: site.SiteID, Entity: entity, Seq: seq, UpdatedAt: time.Now().UTC()}
+	if err := s.store.SetWatermark(r.Context(), wm); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	s.logger.Warn("sync watermark overridden manually", "site_id", site.SiteID, "entity", entity, "previous_seq", previous.Seq, "seq", seq, "timestamp", formatTimePtr(at))
+	resp := map[string]any{
+		"site_id":      wm.SiteID,
+		"entity":       wm.Entity,
+		"seq":          wm.Seq,
+		"previous_seq": previous.Seq,
+		"updated_at":   wm.UpdatedAt,
+	}
+	if at != nil {
+		resp["timestamp"] = at.UTC()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// changesSeqBefore walks the site's builder changes feed from the start and returns the seq of
+// the last change before at, so resuming from it re-ingests everything from at on. The feed is in
+// creation order, so the walk stops at the first change at or after at; 0 means before them all.
+func (s *Server) changesSeqBefore(ctx context.Context, site RegisteredSite, at time.Time) (int64, error) {
+	var seq int64
+	for {
+		var resp ChangesResponse
+		err := s.withBuilderFailover(ctx, site, func(baseURL string) (err error) {
+			resp, err = s.builderClient.FetchChanges(ctx, baseURL, site.APIPrefix, site.SiteID, site.AccessKey, seq, s.builderPageSize)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, change := range resp.Changes {
+			if !change.ChangedAt.Before(at) {
+				return seq, nil
+			}
+			seq = change.Seq
+		}
+		if !resp.HasMore || len(resp.Changes) == 0 {
+			return seq, nil
+		}
+	}
+}
+
+func (s *Server) handleListFlags(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	flags, err := s.EffectiveFlags(r.Context(), site.SiteID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "list flags: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"site_id": site.SiteID, "flags": flags})
+}
+
+func (s *Server) handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	var payload struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	flag := FeatureFlag{SiteID: site.SiteID, Key: chi.URLParam(r, "key"), Value: strings.TrimSpace(payload.Value)}
+	if err := validateFeatureFlag(flag.Key, flag.Value); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	flag.UpdatedAt = time.Now().UTC()
+	if err := s.store.SetFeatureFlag(r.Context(), flag); err != nil {
+		writeError(w, http.StatusInternalServerError, "set flag: %v", err)
+		return
+	}
+	s.logger.Info("feature flag set", "site_id", flag.SiteID, "key", flag.Key, "value", flag.Value)
+	if flag.Key == FlagAutoSync {
+		s.reconcileAutoSyncSchedule(r.Context(), flag.SiteID)
+	}
+	writeJSON(w, http.StatusOK, flag)
+}
+
+func (s *Server) handleDeleteFlag(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	key := chi.URLParam(r, "key")
+	if err := s.store.DeleteFeatureFlag(r.Context(), site.SiteID, key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "flag not set")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "delete flag: %v", err)
+		return
+	}
+	s.logger.Info("feature flag cleared", "site_id", site.SiteID, "key", key)
+	if key == FlagAutoSync {
+		s.reconcileAutoSyncSchedule(r.Context(), site.SiteID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type pagedFetcher func(ctx context.Context, site RegisteredSite, page int, start, end *time.Time) (pagedResult, error)
+
+type pagedResult struct {
+	page        int
+	pageSize    int
+	total       int
+	hasMore     bool
+	nextPage    *int
+	inserted    int
+	skipped     int
+	fetchTime   time.Duration
+	persistTime time.Duration
+}
+
+func (s *Server) fetchUsersPage(ctx context.Context, site RegisteredSite, page int, start, end *time.Time) (pagedResult, error) {
+	fetchStart := time.Now()
+	var resp PagedUsersResponse
+	err := s.withBuilderFailover(ctx, site, func(baseURL string) (err error) {
+		resp, err = s.builderClient.FetchUsers(ctx, baseURL, site.APIPrefix, site.SiteID, site.AccessKey, page, s.builderPageSize, start, end)
+		return err
+	})
+	if err != nil {
+		return pagedResult{}, err
+	}
+	persistStart := time.Now()
+	inserted, skipped, err := s.persistUsers(ctx, site, resp.Users)
+	if err != nil {
+		return pagedResult{}, err
+	}
+	return pagedResult{
+		page:        resp.Page,
+		pageSize:    s.returnedPageSize(site, "users", resp.PageSize),
+		total:       resp.Total,
+		hasMore:     resp.HasMore,
+		nextPage:    resp.NextPage,
+		inserted:    inserted,
+		skipped:     skipped,
+		fetchTime:   persistStart.Sub(fetchStart),
+		persistTime: time.Since(persistStart),
+	}, nil
+}
+
+func (s *Server) fetchOrdersPage(ctx context.Context, site RegisteredSite, page int, start, end *time.Time) (pagedResult, error) {
+	fetchStart := time.Now()
+	var resp PagedOrdersResponse
+	err := s.withBuilderFailover(ctx, site, func(baseURL string) (err error) {
+		resp, err = s.builderClient.FetchOrders(ctx, baseURL, site.APIPrefix, site.SiteID, site.AccessKey, page, s.builderPageSize, start, end)
+		return err
+	})
+	if err != nil {
+		return pagedResult{}, err
+	}
+	persistStart := time.Now()
+	inserted, skipped, err := s.persistOrders(ctx, site, resp.Orders)
+	if err != nil {
+		return pagedResult{}, err
+	}
+	return pagedResult{
+		page:        resp.Page,
+		pageSize:    s.returnedPageSize(site, "orders", resp.PageSize),
+		total:       resp.Total,
+		hasMore:     resp.HasMore,
+		nextPage:    resp.NextPage,
+		inserted:    inserted,
+		skipped:     skipped,
+		fetchTime:   persistStart.Sub(fetchStart),
+		persistTime: time.Since(persistStart),
+	}, nil
+}
+
+// returnedPageSize is the page size the builder says it used, which is what its page numbers
+// and totals are based on. The builder clamps the requested size, so the two can differ; a
+// response without page_size falls back to the size that was requested.
+func (s *Server) returnedPageSize(site RegisteredSite, endpoint string, size int) int {
+	if size <= 0 {
+		return s.builderPageSize
+	}
+	if size != s.builderPageSize {
+		s.logger.Debug("builder page size differs from requested", "site_id", site.SiteID, "endpoint", endpoint, "requested", s.builderPageSize, "returned", size)
+	}
+	return size
+}
+
+// withBuilderFailover calls fn with each of the site's builder base URLs in order and stops at
+// the first success. Every endpoint is expected to serve the same site data; events carry
+// deterministic dedupe keys, so a page that is re-read from another endpoint is skipped rather
+// than duplicated. A single-URL site behaves exactly as if fn were called directly.
+func (s *Server) withBuilderFailover(ctx context.Context, site RegisteredSite, fn func(baseURL string) error) error {
+	urls := site.BaseURLs()
+	var errs []error
+	for i, baseURL := range urls {
+		err := fn(baseURL)
+		if err == nil {
+			return nil
+		}
+		if len(urls) == 1 {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", baseURL, err))
+		if ctx.Err() != nil {
+			break
+		}
+		if i+1 < len(urls) {
+			s.logger.Warn("builder endpoint failed, trying next", "site_id", site.SiteID, "failed_url", baseURL, "next_url", urls[i+1], "error", err)
+		}
+	}
+	return fmt.Errorf("all %d builder endpoints failed: %w", len(urls), errors.Join(errs...))
+}
+
+// syncSite walks pages from page until the builder reports no more, or until maxPages pages
+// have been processed when maxPages is positive; the result then carries the page to resume at.
+// With a page concurrency above 1, the pages the first response's total and page size say remain
+// (up to the page budget) are fetched in parallel; anything that appeared since (hasMore on the
+// last of them) is then picked up the same way. Page math uses the page size the builder
+// returned, not the size requested, since the builder may clamp it. Run inside an activity it
+// heartbeats a pageCheckpoint after each page (or parallel batch), and a retried attempt resumes
+// from the last checkpoint instead of page, with its totals and page budget carried over.
+func (s *Server) syncSite(ctx context.Context, site RegisteredSite, page, maxPages int, start, end *time.Time, fetch pagedFetcher) (PagesBatchResult, error) {
+	result := PagesBatchResult{}
+	summary := &result.Summary
+	if cp, ok := lastPageCheckpoint(ctx); ok {
+		s.logger.Info("sync resuming from heartbeat", "site_id", site.SiteID, "requested_page", page, "resume_page", cp.NextPage, "pages_done", cp.Summary.Pages)
+		result.Summary = cp.Summary
+		if !cp.HasMore {
+			return result, nil
+		}
+		page = cp.NextPage
+		if maxPages > 0 && summary.Pages >= maxPages {
+			result.NextPage = page
+			result.HasMore = true
+			return result, nil
+		}
+	}
+	add := func(res pagedResult) {
+		summary.Inserted += res.inserted
+		summary.Skipped += res.skipped
+		summary.FetchDuration += res.fetchTime
+		summary.PersistDuration += res.persistTime
+		summary.Pages++
+		if res.total > summary.Total {
+			summary.Total = res.total
+		}
+	}
+	currentPage := page
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		res, err := fetch(ctx, site, currentPage, start, end)
+		if err != nil {
+			return result, err
+		}
+		add(res)
+		if !res.hasMore {
+			heartbeatPage(ctx, pageCheckpoint{Summary: *summary})
+			break
+		}
+		next := currentPage + 1
+		if res.nextPage != nil {
+			next = *res.nextPage
+		}
+		heartbeatPage(ctx, pageCheckpoint{NextPage: next, HasMore: true, Summary: *summary})
+		last := (res.total + res.pageSize - 1) / res.pageSize
+		if maxPages > 0 {
+			last = min(last, next+maxPages-summary.Pages-1)
+		}
+		if s.pageConcurrency > 1 && last > next {
+			results, err := s.fetchPagesConcurrently(ctx, site, next, last, start, end, fetch)
+			for _, r := range results {
+				add(r)
+			}
+			if err != nil {
+				return result, err
+			}
+			final := results[len(results)-1]
+			if !final.hasMore {
+				heartbeatPage(ctx, pageCheckpoint{Summary: *summary})
+				break
+			}
+			next = last + 1
+			if final.nextPage != nil {
+				next = *final.nextPage
+			}
+			heartbeatPage(ctx, pageCheckpoint{NextPage: next, HasMore: true, Summary: *summary})
+		}
+		if maxPages > 0 && summary.Pages >= maxPages {
+			result.NextPage = next
+			result.HasMore = true
+			break
+		}
+		currentPage = next
+	}
+	return result, nil
+}
+
+// fetchPagesConcurrently fetches pages first..last with at most s.pageConcurrency in flight. On
+// success results are in page order; on failure the remaining fetches are cancelled and only the
+// pages that completed are returned alongside the first error.
+func (s *Server) fetchPagesConcurrently(ctx context.Context, site RegisteredSite, first, last int, start, end *time.Time, fetch pagedFetcher) ([]pagedResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]pagedResult, last-first+1)
+	done := make([]bool, len(results))
+	sem := make(chan struct{}, s.pageConcurrency)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := range results {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res, err := fetch(ctx, site, first+i, start, end)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			results[i] = res
+			done[i] = true
+		}(i)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		completed := make([]pagedResult, 0, len(results))
+		for i, res := range results {
+			if done[i] {
+				completed = append(completed, res)
+			}
+		}
+		return completed, firstErr
+	}
+	return results, nil
+}
+
+func (s *Server) runSyncWorkflow(ctx context.Context, site RegisteredSite, includeUsers, includeOrders bool, page int, start, end *time.Time, reason string) (SyncWorkflowResult, error) {
+	return s.runSyncInput(ctx, SyncWorkflowInput{
+		SiteID:        site.SiteID,
+		Start:         start,
+		End:           end,
+		Page:          page,
+		IncludeUsers:  includeUsers,
+		IncludeOrders: includeOrders,
+		Reason:        reason,
+	})
+}
+
+func (s *Server) runSyncInput(ctx context.Context, input SyncWorkflowInput) (SyncWorkflowResult, error) {
+	if err := input.Validate(); err != nil {
+		return SyncWorkflowResult{}, err
+	}
+	if s.orchestrator == nil {
+		return SyncWorkflowResult{}, errors.New("sync orchestrator not configured")
+	}
+	result, err := s.orchestrator.RunSync(ctx, input)
+	if err != nil {
+		s.logger.Error("workflow sync failed", "site_id", input.SiteID, "reason", input.Reason, "error", err)
+		return result, err
+	}
+	s.logger.Info("workflow sync completed", "site_id", input.SiteID, "reason", input.Reason, "workflow_id", result.WorkflowID, "run_id", result.RunID, "include_users", input.IncludeUsers, "include_orders", input.IncludeOrders, "use_changes", input.UseChanges)
+	return result, nil
+}
+
+// syncChangesBatch ingests up to maxPages batches of the builder changes feed after since.
+// Events are written with the same dedupe keys as the paged sync, so replaying a batch after a
+// crash (before the watermark was stored) is harmless.
+func (s *Server) syncChangesBatch(ctx context.Context, site RegisteredSite, since int64, maxPages int) (ChangesBatchResult, error) {
+	result := ChangesBatchResult{NextSeq: since}
+	for result.Summary.Pages < maxPages {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		fetchStart := time.Now()
+		var resp ChangesResponse
+		err := s.withBuilderFailover(ctx, site, func(baseURL string) (err error) {
+			resp, err = s.builderClient.FetchChanges(ctx, baseURL, site.APIPrefix, site.SiteID, site.AccessKey, result.NextSeq, s.builderPageSize)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+		persistStart := time.Now()
+		result.Summary.FetchDuration += persistStart.Sub(fetchStart)
+		for _, change := range resp.Changes {
+			var inserted, skipped int
+			switch {
+			case change.User != nil:
+				inserted, skipped, err = s.persistUsers(ctx, site, []BuilderUser{*change.User})
+			case change.Order != nil:
+				inserted, skipped, err = s.persistOrders(ctx, site, []BuilderOrder{*change.Order})
+			}
+			if err != nil {
+				return result, err
+			}
+			result.Summary.Inserted += inserted
+			result.Summary.Skipped += skipped
+			result.Summary.Total++
+		}
+		result.Summary.PersistDuration += time.Since(persistStart)
+		result.Summary.Pages++
+		if resp.NextSince > result.NextSeq {
+			result.NextSeq = resp.NextSince
+		}
+		result.HasMore = resp.HasMore
+		if !resp.HasMore {
+			break
+		}
+	}
+	return result, nil
+}
+
+// syncEntities is a shared workflow between user and order synchronisation. The comment explains
+// the "activity" like flow so non-Go readers can trace the steps.
+//
+//  1. Determine the target site and interpret optional date filters from the request.
+//  2. Loop over pages from the builder API (enforcing the 10 item max) until the remote endpoint
+//     signals there are no additional pages.
+//  3. Persist each entity as an event while pulling the latest attribution data from the event store.
+//  4. Aggregate stats (inserted/skipped counts) and expose them in the HTTP response.
+func (s *Server) persistUsers(ctx context.Context, site RegisteredSite, users []BuilderUser) (int, int, error) {
+	attribution := s.attributionLookup(ctx, site.SiteID, "signup")
+	timestampPolicy := s.flagValue(ctx, site.SiteID, FlagEventTimestamp)
+	inserted := 0
+	skipped := 0
+	for _, user := range users {
+		attr, ok, err := attribution(ctx, user.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		event := Event{
+			SiteID:    site.SiteID,
+			UserID:    user.ID,
+			EventName: "signup",
+			UTMSource: utmIf(ok, attr.Source),
+			Properties: map[string]any{
+				"email":      user.Email,
+				"first_name": user.FirstName,
+				"last_name":  user.LastName,
+				"signup_at":  user.SignupAt.Format(time.RFC3339),
+			},
+			DedupeKey: fmt.Sprintf("signup:%s:%s", site.SiteID, user.ID),
+		}
+		event.Timestamp, event.IngestedAt = eventTimes(timestampPolicy, user.SignupAt)
+		if ok {
+			event.Metadata = attr.Metadata()
+		}
+		okInserted, err := s.store.InsertEvent(ctx, event)
+		if err != nil {
+			return 0, 0, err
+		}
+		if okInserted {
+			inserted++
+			s.publishEvent(event)
+		} else {
+			skipped++
+			s.logSkip(event)
+		}
+	}
+	return inserted, skipped, nil
+}
+
+// logSkip logs event as a sampled dedupe skip when WithSkipLogSample is set. The counter is shared
+// across sites and concurrent page fetches, and the first skip is always logged.
+func (s *Server) logSkip(event Event) {
+	if s.skipLogEvery <= 0 {
+		return
+	}
+	n := s.skipCount.Add(1)
+	if (n-1)%int64(s.skipLogEvery) != 0 {
+		return
+	}
+	s.logger.Info("sync event skipped as duplicate (sampled)", "site_id", event.SiteID, "event_name", event.EventName, "user_id", event.UserID, "dedupe_key", event.DedupeKey, "skips_seen", n, "sample_every", s.skipLogEvery)
+}
+
+func (s *Server) persistOrders(ctx context.Context, site RegisteredSite, orders []BuilderOrder) (int, int, error) {
+	attribution := s.attributionLookup(ctx, site.SiteID, "order_created")
+	timestampPolicy := s.flagValue(ctx, site.SiteID, FlagEventTimestamp)
+	inserted := 0
+	skipped := 0
+	for _, order := range orders {
+		attr, ok, err := attribution(ctx, order.UserID)
+		if err != nil {
+			return 0, 0, err
+		}
+		event := Event{
 			SiteID:    site.SiteID,
-			Timestamp: user.SignupAt,
-			UserID:    user.ID,
-			EventName: "signup",
-			UTMSource: utmIf(ok, utm),
+			UserID:    order.UserID,
+			EventName: "order_created",
+			UTMSource: utmIf(ok, attr.Source),
 			Properties: map[string]any{
-				"email":      user.Email,
-				"first_name": user.FirstName,
-				"last_name":  user.LastName,
-				"signup_at":  user.SignupAt.Format(time.RFC3339),
+				"order_id":     order.ID,
+				"order_number": order.OrderNumber,
+				"total_amount": order.TotalAmount,
+				"currency":     order.Currency,
+				"user_id":      order.UserID,
+				"placed_at":    order.PlacedAt.Format(time.RFC3339),
 			},
-			DedupeKey: fmt.Sprintf("signup:%s:%s", site.SiteID, user.ID),
+			DedupeKey: fmt.Sprintf("order:%s:%s", site.SiteID, order.ID),
+		}
+		event.Timestamp, event.IngestedAt = eventTimes(timestampPolicy, order.PlacedAt)
+		if ok {
+			event.Metadata = attr.Metadata()
+			// The path is every touch that led to the order, for multi-touch analysis; utm_source
+			// stays the single touch the site's attribution model picked.
+			path, err := s.store.AttributionPath(ctx, site.SiteID, order.UserID, event.Timestamp)
+			if err != nil {
+				return 0, 0, err
+			}
+			if len(path) > 0 {
+				event.Metadata["attribution_path"] = path
+			}
+		}
+		okInserted, err := s.store.InsertEvent(ctx, event)
+		if err != nil {
+			return 0, 0, err
+		}
+		if okInserted {
+			inserted++
+			s.publishEvent(event)
+		} else {
+			skipped++
+			s.logSkip(event)
+		}
+	}
+	return inserted, skipped, nil
+}
+
+func utmIf(ok bool, utm string) string {
+	if !ok {
+		return ""
+	}
+	return utm
+}
+
+func (s *Server) handleRandomEvent(w http.ResponseWriter, r *http.Request) {
+	var req RandomEventRequest
+	if err := newPropertiesDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	event, err := s.store.InsertRandomAttribution(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, ErrRandomDedupeCollision) {
+			s.logger.Error("random attribution event dedupe collision", "site_id", req.SiteID, "error", err)
+			writeError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.publishEvent(event)
+	s.logger.Info("random attribution event inserted", "site_id", event.SiteID, "user_id", event.UserID, "event_name", event.EventName)
+	writeJSON(w, http.StatusCreated, event)
+}
+
+// manualEventPayload is the body accepted by the manual event endpoints.
+type manualEventPayload struct {
+	SiteID     string                 `json:"site_id"`
+	Timestamp  string                 `json:"timestamp"`
+	UserID     string                 `json:"user_id"`
+	EventName  string                 `json:"event_name"`
+	UTMSource  string                 `json:"utm_source"`
+	Properties map[string]any         `json:"properties"`
+	DedupeKey  string                 `json:"dedupe_key"`
+	Metadata   map[string]interface{} `json:"metadata"`
+}
+
+// toEvent validates the payload and builds the event it describes. A missing dedupe_key is
+// replaced by a manual:<id> key drawn from ids, so such events never collide.
+func (p manualEventPayload) toEvent(ids IDGenerator) (Event, error) {
+	if p.SiteID == "" || p.UserID == "" || p.EventName == "" {
+		return Event{}, errors.New("site_id, user_id, and event_name are required")
+	}
+	ts := time.Now().UTC()
+	if p.Timestamp != "" {
+		parsed, err := parseTime(p.Timestamp)
+		if err != nil {
+			return Event{}, fmt.Errorf("timestamp: %w", err)
+		}
+		ts = parsed
+	}
+	if p.Properties == nil {
+		p.Properties = map[string]any{}
+	}
+	dedupe := p.DedupeKey
+	if dedupe == "" {
+		dedupe = fmt.Sprintf("manual:%s", ids.NewID())
+	}
+	return Event{
+		SiteID:     p.SiteID,
+		Timestamp:  ts,
+		UserID:     p.UserID,
+		EventName:  p.EventName,
+		UTMSource:  p.UTMSource,
+		Properties: p.Properties,
+		DedupeKey:  dedupe,
+		Metadata:   p.Metadata,
+	}, nil
+}
+
+func (s *Server) handleManualEvent(w http.ResponseWriter, r *http.Request) {
+	var payload manualEventPayload
+	if err := newPropertiesDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	event, err := payload.toEvent(s.store.ids)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	inserted, err := s.store.InsertEvent(r.Context(), event)
+	if err != nil {
+		if errors.Is(err, ErrPropertiesTooLarge) {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "insert event: %v", err)
+		return
+	}
+	s.logger.Info("manual event processed", "site_id", event.SiteID, "user_id", event.UserID, "event_name", event.EventName, "dedupe_key", event.DedupeKey, "inserted", inserted)
+	if inserted {
+		s.publishEvent(event)
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"inserted": true,
+			"event":    event,
+		})
+		return
+	}
+	// Return what is on record so a retried request can confirm it matches.
+	existing, found, err := s.store.GetEventByDedupeKey(r.Context(), event.SiteID, event.DedupeKey, event.UTMSource)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load existing event: %v", err)
+		return
+	}
+	resp := map[string]any{
+		"inserted": false,
+		"event":    event,
+	}
+	if found {
+		resp["existing_event"] = existing
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDedupeKeyPreview reports the dedupe key a manual event body would be stored under and
+// whether an event already holds it, without inserting anything.
+func (s *Server) handleDedupeKeyPreview(w http.ResponseWriter, r *http.Request) {
+	var payload manualEventPayload
+	if err := newPropertiesDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	event, err := payload.toEvent(s.store.ids)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	resp := map[string]any{
+		"dedupe_key":   event.DedupeKey,
+		"dedupe_scope": s.store.dedupeScopeValue(event),
+		"generated":    payload.DedupeKey == "",
+		"exists":       false,
+	}
+	// A generated key is random, so it cannot match a stored event.
+	if payload.DedupeKey != "" {
+		existing, ok, err := s.store.GetEventByDedupeKey(r.Context(), event.SiteID, event.DedupeKey, event.UTMSource)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "lookup dedupe key: %v", err)
+			return
+		}
+		resp["exists"] = ok
+		if ok {
+			resp["existing_event"] = existing
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleConversionLatency(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	report, err := s.ConversionLatency(r.Context(), siteID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "conversion latency: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleFunnel reports the signup-to-order funnel of one site, optionally per utm_source.
+func (s *Server) handleFunnel(w http.ResponseWriter, r *http.Request) {
+	siteID := strings.TrimSpace(r.URL.Query().Get("site_id"))
+	if siteID == "" {
+		writeError(w, http.StatusBadRequest, "site_id is required")
+		return
+	}
+	var byUTM bool
+	switch groupBy := r.URL.Query().Get("group_by"); groupBy {
+	case "":
+	case "utm_source":
+		byUTM = true
+	default:
+		writeError(w, http.StatusBadRequest, "group_by must be empty or %q", "utm_source")
+		return
+	}
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	report, err := s.Funnel(r.Context(), siteID, start, end, byUTM)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "funnel: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleRevenue(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	report, err := s.Revenue(r.Context(), siteID, start, end, r.URL.Query().Get("normalize"))
+	if err != nil {
+		if errors.Is(err, ErrMissingExchangeRate) {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "revenue: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleRevenueByAttribution(w http.ResponseWriter, r *http.Request) {
+	siteID := strings.TrimSpace(r.URL.Query().Get("site_id"))
+	if siteID == "" {
+		writeError(w, http.StatusBadRequest, "site_id is required")
+		return
+	}
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	sources, err := s.store.RevenueByAttribution(r.Context(), siteID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "revenue by attribution: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"site_id": siteID, "sources": sources})
+}
+
+func (s *Server) handleAttributionCoverage(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	report, err := s.store.AttributionCoverage(r.Context(), siteID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "attribution coverage: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleDistinctUsers(w http.ResponseWriter, r *http.Request) {
+	siteID := chi.URLParam(r, "siteID")
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	n, err := s.store.DistinctUsers(r.Context(), siteID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "distinct users: %v", err)
+		return
+	}
+	payload := map[string]any{"site_id": siteID, "distinct_users": n}
+	if start != nil {
+		payload["start"] = start.UTC().Format(time.RFC3339)
+	}
+	if end != nil {
+		payload["end"] = end.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// handleOrdersWithAttribution pages through a site's orders joined with each user's attribution
+// under the site's attribution_model flag. Callers pass next_after back as after.
+func (s *Server) handleOrdersWithAttribution(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	after, err := strconv.ParseInt(defaultString(r.URL.Query().Get("after"), "0"), 10, 64)
+	if err != nil || after < 0 {
+		writeError(w, http.StatusBadRequest, "after must be a non-negative integer")
+		return
+	}
+	limit := parseIntDefault(r.URL.Query().Get("limit"), DefaultOrderAttributionLimit)
+	model := s.flagValue(r.Context(), site.SiteID, FlagAttributionModel)
+	orders, nextAfter, err := s.store.OrdersWithAttribution(r.Context(), site.SiteID, model, after, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "orders with attribution: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id":           site.SiteID,
+		"attribution_model": model,
+		"orders":            orders,
+		"count":             len(orders),
+		"after":             after,
+		"next_after":        nextAfter,
+	})
+}
+
+func (s *Server) handleWorkflowHistory(w http.ResponseWriter, r *http.Request) {
+	if s.orchestrator == nil {
+		writeError(w, http.StatusServiceUnavailable, "sync orchestrator not configured")
+		return
+	}
+	workflowID := chi.URLParam(r, "workflowID")
+	after, err := strconv.ParseInt(defaultString(r.URL.Query().Get("after"), "0"), 10, 64)
+	if err != nil || after < 0 {
+		writeError(w, http.StatusBadRequest, "after must be a non-negative integer")
+		return
+	}
+	limit := parseIntDefault(r.URL.Query().Get("limit"), DefaultWorkflowHistoryLimit)
+	events, nextAfter, err := s.orchestrator.WorkflowHistory(r.Context(), workflowID, after, limit)
+	if err != nil {
+		if errors.Is(err, ErrWorkflowNotFound) {
+			writeError(w, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"workflow_id": workflowID,
+		"events":      events,
+		"count":       len(events),
+		"after":       after,
+		"next_after":  nextAfter,
+	})
+}
+
+// handleCancelSync asks a running sync to stop before its next activity. The sync still
+// finishes on its own, so the response only confirms the signal was delivered.
+func (s *Server) handleCancelSync(w http.ResponseWriter, r *http.Request) {
+	if s.orchestrator == nil {
+		writeError(w, http.StatusServiceUnavailable, "sync orchestrator not configured")
+		return
+	}
+	workflowID := chi.URLParam(r, "workflowID")
+	if err := s.orchestrator.CancelSync(r.Context(), workflowID); err != nil {
+		if errors.Is(err, ErrWorkflowNotFound) {
+			writeError(w, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"workflow_id": workflowID,
+		"status":      "cancel_requested",
+	})
+}
+
+// handleListActiveSyncs lists the sync workflows currently running, straight from Temporal,
+// optionally only those of the site_id query parameter.
+func (s *Server) handleListActiveSyncs(w http.ResponseWriter, r *http.Request) {
+	if s.orchestrator == nil {
+		writeError(w, http.StatusServiceUnavailable, "sync orchestrator not configured")
+		return
+	}
+	syncs, err := s.orchestrator.ListActiveSyncs(r.Context(), r.URL.Query().Get("site_id"))
+	if err != nil {
+		if errors.Is(err, ErrVisibilityUnavailable) {
+			writeError(w, http.StatusServiceUnavailable, "%v", err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"syncs": syncs, "count": len(syncs)})
+}
+
+func (s *Server) handleBackfillAttribution(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	siteID := site.SiteID
+	result, err := s.store.BackfillAttribution(r.Context(), siteID, s.suppressedAttribution(r.Context(), siteID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "backfill attribution: %v", err)
+		return
+	}
+	s.logger.Info("attribution backfilled", "site_id", siteID, "candidates", result.Candidates, "backfilled", result.Backfilled, "still_empty", result.StillEmpty, "conflicts", result.Conflicts)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"site_id":     siteID,
+		"candidates":  result.Candidates,
+		"backfilled":  result.Backfilled,
+		"still_empty": result.StillEmpty,
+		"conflicts":   result.Conflicts,
+	})
+}
+
+// handleResolveAttribution previews the attribution a synced event for user_id would get, through
+// the same store lookup as the sync, without inserting anything. The model defaults to the site's
+// attribution_model flag; timestamp and window narrow the touches considered as they would for an
+// event at that time.
+func (s *Server) handleResolveAttribution(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		SiteID    string `json:"site_id"`
+		UserID    string `json:"user_id"`
+		Timestamp string `json:"timestamp"`
+		Model     string `json:"model"`
+		Window    string `json:"window"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+		return
+	}
+	if payload.SiteID == "" || payload.UserID == "" {
+		writeError(w, http.StatusBadRequest, "site_id and user_id are required")
+		return
+	}
+	site, err := s.store.GetSite(r.Context(), payload.SiteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
 		}
-		okInserted, err := s.store.InsertEvent(ctx, event)
-		if err != nil {
-			return 0, 0, err
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	q := AttributionQuery{
+		SiteID: site.SiteID,
+		UserID: payload.UserID,
+		Model:  defaultString(payload.Model, s.flagValue(r.Context(), site.SiteID, FlagAttributionModel)),
+	}
+	if q.Model != AttributionModelLast && q.Model != AttributionModelFirst {
+		writeError(w, http.StatusBadRequest, "model must be %q or %q", AttributionModelLast, AttributionModelFirst)
+		return
+	}
+	if payload.Timestamp != "" {
+		if q.AsOf, err = parseTime(payload.Timestamp); err != nil {
+			writeError(w, http.StatusBadRequest, "timestamp: %v", err)
+			return
 		}
-		if okInserted {
-			inserted++
-		} else {
-			skipped++
+	}
+	if payload.Window != "" {
+		q.Window, err = time.ParseDuration(payload.Window)
+		if err != nil || q.Window <= 0 {
+			writeError(w, http.StatusBadRequest, "window must be a positive duration such as 720h")
+			return
 		}
 	}
-	return inserted, skipped, nil
+
+	attr, ok, err := s.store.ResolveAttribution(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "resolve attribution: %v", err)
+		return
+	}
+	resp := map[string]any{
+		"site_id":    site.SiteID,
+		"user_id":    q.UserID,
+		"model":      q.Model,
+		"attributed": ok,
+		"utm_source": attr.Source,
+	}
+	if !q.AsOf.IsZero() {
+		resp["timestamp"] = q.AsOf
+	}
+	if q.Window > 0 {
+		resp["window"] = q.Window.String()
+	}
+	if ok {
+		resp["source_event_id"] = attr.SourceEventID
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) persistOrders(ctx context.Context, site RegisteredSite, orders []BuilderOrder) (int, int, error) {
-	inserted := 0
-	skipped := 0
-	for _, order := range orders {
-		utm, ok, err := s.store.LatestAttribution(ctx, order.UserID)
-		if err != nil {
-			return 0, 0, err
-		}
-		event := Event{
-			SiteID:    site.SiteID,
-			Timestamp: order.PlacedAt,
-			UserID:    order.UserID,
-			EventName: "order_created",
-			UTMSource: utmIf(ok, utm),
-			Properties: map[string]any{
-				"order_id":     order.ID,
-				"order_number": order.OrderNumber,
-				"total_amount": order.TotalAmount,
-				"currency":     order.Currency,
-				"user_id":      order.UserID,
-				"placed_at":    order.PlacedAt.Format(time.RFC3339),
-			},
-			DedupeKey: fmt.Sprintf("order:%s:%s", site.SiteID, order.ID),
-		}
-		okInserted, err := s.store.InsertEvent(ctx, event)
-		if err != nil {
-			return 0, 0, err
+// handleAttributionMap streams {user_id: utm_source} for every attributed user in a site as a
+// single JSON object, writing entries straight from the database cursor.
+func (s *Server) handleAttributionMap(w http.ResponseWriter, r *http.Request) {
+	site, err := s.store.GetSite(r.Context(), chi.URLParam(r, "siteID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "site not registered")
+			return
 		}
-		if okInserted {
-			inserted++
-		} else {
-			skipped++
+		writeError(w, http.StatusInternalServerError, "load site: %v", err)
+		return
+	}
+	siteID := site.SiteID
+	model := defaultString(r.URL.Query().Get("model"), AttributionModelLast)
+	if model != AttributionModelLast && model != AttributionModelFirst {
+		writeError(w, http.StatusBadRequest, "model must be %q or %q", AttributionModelLast, AttributionModelFirst)
+		return
+	}
+	var since *time.Time
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			writeError(w, http.StatusBadRequest, "window must be a positive duration such as 720h")
+			return
 		}
+		ts := time.Now().UTC().Add(-window)
+		since = &ts
 	}
-	return inserted, skipped, nil
-}
 
-func utmIf(ok bool, utm string) string {
-	if !ok {
-		return ""
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	header, _ := json.Marshal(map[string]string{"site_id": siteID, "model": model})
+	// Reopen the header object so the attribution entries can be streamed into it.
+	w.Write(header[:len(header)-1])
+	w.Write([]byte(`,"attribution":{`))
+	count := 0
+	err = s.store.IterateAttribution(r.Context(), siteID, model, since, func(userID, utm string) error {
+		key, _ := json.Marshal(userID)
+		value, _ := json.Marshal(utm)
+		if count > 0 {
+			w.Write([]byte(","))
+		}
+		count++
+		w.Write(key)
+		w.Write([]byte(":"))
+		_, err := w.Write(value)
+		return err
+	})
+	if err != nil {
+		// Headers are already sent; leaving the object unterminated makes the failure visible
+		// to clients as invalid JSON instead of a silently partial map.
+		s.logger.Error("attribution map stream failed", "site_id", siteID, "written", count, "error", err)
+		return
 	}
-	return utm
+	w.Write([]byte("}}\n"))
+	s.logger.Info("attribution map exported", "site_id", siteID, "model", model, "users", count)
 }
 
-func (s *Server) handleRandomEvent(w http.ResponseWriter, r *http.Request) {
-	var req RandomEventRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+// handleListSyncRuns pages through sync history newest first. Pass next_cursor back as before
+// to fetch the following page.
+func (s *Server) handleListSyncRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status != "" && status != SyncRunStatusSuccess && status != SyncRunStatusFailed && status != SyncRunStatusCancelled {
+		writeError(w, http.StatusBadRequest, "status must be %q, %q, or %q", SyncRunStatusSuccess, SyncRunStatusFailed, SyncRunStatusCancelled)
 		return
 	}
-	event, err := s.store.InsertRandomAttribution(r.Context(), req)
+	page, err := s.store.ListSyncRuns(r.Context(), SyncRunFilter{
+		SiteID: q.Get("site_id"),
+		Status: status,
+		Before: q.Get("before"),
+		Limit:  parseIntDefault(q.Get("limit"), DefaultSyncRunLimit),
+	})
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		if errors.Is(err, ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "list sync runs: %v", err)
 		return
 	}
-	s.logger.Info("random attribution event inserted", "site_id", event.SiteID, "user_id", event.UserID, "event_name", event.EventName)
-	writeJSON(w, http.StatusCreated, event)
+	writeJSON(w, http.StatusOK, page)
 }
 
-func (s *Server) handleManualEvent(w http.ResponseWriter, r *http.Request) {
-	var payload struct {
-		SiteID     string                 `json:"site_id"`
-		Timestamp  string                 `json:"timestamp"`
-		UserID     string                 `json:"user_id"`
-		EventName  string                 `json:"event_name"`
-		UTMSource  string                 `json:"utm_source"`
-		Properties map[string]any         `json:"properties"`
-		DedupeKey  string                 `json:"dedupe_key"`
-		Metadata   map[string]interface{} `json:"metadata"`
+// defaultRecentRunsPerSite is the per-site run count of /sync-runs/summary without ?n=.
+const defaultRecentRunsPerSite = 5
+
+// handleSyncRunSummary returns the latest runs of every site for a fleet overview.
+func (s *Server) handleSyncRunSummary(w http.ResponseWriter, r *http.Request) {
+	n := parseIntDefault(r.URL.Query().Get("n"), defaultRecentRunsPerSite)
+	if n < 1 || n > MaxRecentRunsPerSite {
+		writeError(w, http.StatusBadRequest, "n must be between 1 and %d", MaxRecentRunsPerSite)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json: %v", err)
+	runs, err := s.store.RecentRunsPerSite(r.Context(), n)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "sync run summary: %v", err)
 		return
 	}
-	if payload.SiteID == "" || payload.UserID == "" || payload.EventName == "" {
-		writeError(w, http.StatusBadRequest, "site_id, user_id, and event_name are required")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"n":     n,
+		"sites": runs,
+		"count": len(runs),
+	})
+}
+
+// handleReplaySyncRun dispatches a fresh workflow with the exact input of a recorded run, so an
+// operator can reproduce a historical sync. The replay is recorded as its own sync run.
+func (s *Server) handleReplaySyncRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid sync run id")
 		return
 	}
-	ts := time.Now().UTC()
-	if payload.Timestamp != "" {
-		parsed, err := parseTime(payload.Timestamp)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, "timestamp: %v", err)
+	run, err := s.store.GetSyncRun(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "sync run not found")
 			return
 		}
-		ts = parsed
+		writeError(w, http.StatusInternalServerError, "load sync run: %v", err)
+		return
 	}
-	if payload.Properties == nil {
-		payload.Properties = map[string]any{}
+	if s.orchestrator == nil {
+		writeError(w, http.StatusServiceUnavailable, "sync orchestrator not configured")
+		return
 	}
-	dedupe := payload.DedupeKey
-	if dedupe == "" {
-		dedupe = fmt.Sprintf("manual:%s", uuid.NewString())
+	input := run.Input
+	input.ReplayOf = run.ID
+	// Runs recorded before the override was stripped may still carry it.
+	input.BuilderBaseURL = ""
+	if err := input.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "recorded input cannot be replayed: %v", err)
+		return
 	}
-	event := Event{
-		SiteID:     payload.SiteID,
-		Timestamp:  ts,
-		UserID:     payload.UserID,
-		EventName:  payload.EventName,
-		UTMSource:  payload.UTMSource,
-		Properties: payload.Properties,
-		DedupeKey:  dedupe,
-		Metadata:   payload.Metadata,
+	workflowID, err := s.orchestrator.RunSyncAsync(r.Context(), input)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "dispatch replay: %v", err)
+		return
 	}
-	inserted, err := s.store.InsertEvent(r.Context(), event)
+	s.logger.Info("sync run replayed", "sync_run_id", run.ID, "site_id", input.SiteID, "workflow_id", workflowID)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"replay_of":   run.ID,
+		"workflow_id": workflowID,
+		"input":       input,
+	})
+}
+
+// handleUserSites lists every site with events for a user. User IDs are only unique per site,
+// so more than one entry means the same ID spans tenants.
+func (s *Server) handleUserSites(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	siteIDs, err := s.store.UserSiteIDs(r.Context(), userID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "insert event: %v", err)
+		writeError(w, http.StatusInternalServerError, "user sites: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"user_id": userID, "site_ids": siteIDs})
+}
+
+// handleEventsCDC lets downstream consumers tail the event store by id. Consumers pass the
+// returned next_after back as after.
+func (s *Server) handleEventsCDC(w http.ResponseWriter, r *http.Request) {
+	after, err := strconv.ParseInt(defaultString(r.URL.Query().Get("after"), "0"), 10, 64)
+	if err != nil || after < 0 {
+		writeError(w, http.StatusBadRequest, "after must be a non-negative integer")
 		return
 	}
-	status := http.StatusCreated
-	if !inserted {
-		status = http.StatusOK
+	limit := parseIntDefault(r.URL.Query().Get("limit"), DefaultCDCLimit)
+	events, nextAfter, err := s.store.EventsSinceID(r.Context(), after, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "events cdc: %v", err)
+		return
 	}
-	s.logger.Info("manual event processed", "site_id", event.SiteID, "user_id", event.UserID, "event_name", event.EventName, "dedupe_key", event.DedupeKey, "inserted", inserted)
-	writeJSON(w, status, map[string]any{
-		"inserted": inserted,
-		"event":    event,
+	if events == nil {
+		events = []Event{}
+	}
+	s.warnCorruptProperties(events)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"events":     events,
+		"count":      len(events),
+		"after":      after,
+		"next_after": nextAfter,
 	})
 }
 
 func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site_id")
-	userID := r.URL.Query().Get("user_id")
+	// user_id may repeat to inspect a cohort in one request.
+	var userIDs []string
+	seen := map[string]bool{}
+	for _, id := range r.URL.Query()["user_id"] {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		userIDs = append(userIDs, id)
+	}
+	start, end, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if start != nil && end != nil && start.After(*end) {
+		writeError(w, http.StatusBadRequest, "start must not be after end")
+		return
+	}
+	window := EventTimeRange{Start: start, End: end}
+	if window.StartInclusive, err = parseBoolDefault(r.URL.Query().Get("start_inclusive"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "start_inclusive: %v", err)
+		return
+	}
+	if window.EndInclusive, err = parseBoolDefault(r.URL.Query().Get("end_inclusive"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "end_inclusive: %v", err)
+		return
+	}
 	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
-	events, err := s.store.ListEvents(r.Context(), siteID, userID, limit)
+	events, err := s.store.ListEvents(r.Context(), siteID, userIDs, window, limit)
 	if err != nil {
+		if errors.Is(err, ErrTooManyUserIDs) {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "list events: %v", err)
 		return
 	}
-	s.logger.Info("events listed", "site_id", siteID, "user_id", userID, "count", len(events))
+	s.warnCorruptProperties(events)
+	s.logger.Info("events listed", "site_id", siteID, "user_ids", userIDs, "count", len(events))
 	writeJSON(w, http.StatusOK, map[string]any{
 		"events": events,
 		"count":  len(events),
 	})
 }
 
+// warnCorruptProperties logs every event whose stored properties could not be decoded.
+func (s *Server) warnCorruptProperties(events []Event) {
+	for _, e := range events {
+		if e.RawProperties != "" {
+			s.logger.Warn("event properties are not valid JSON", "event_id", e.ID, "site_id", e.SiteID, "dedupe_key", e.DedupeKey)
+		}
+	}
+}
+
+// checkAdminToken reports whether r carries the configured admin token, writing the error
+// response when it does not. It fails closed: with no token configured nothing is authorised.
+func (s *Server) checkAdminToken(w http.ResponseWriter, r *http.Request) bool {
+	if s.adminToken == "" {
+		writeError(w, http.StatusForbidden, "admin access is disabled; start the worker with --admin-token")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(s.adminToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, "missing or invalid X-Admin-Token header")
+		return false
+	}
+	return true
+}
+
+// requireAdminToken guards cross-site admin endpoints with checkAdminToken, so they stay
+// disabled until an admin token is configured.
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkAdminToken(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.Status(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "worker status: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.config.Redacted())
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	samples := s.metrics.Snapshot()
+	if samples == nil {
+		samples = []metrics.Sample{}
+	}
+	breakers := s.builderClient.CircuitStates()
+	if breakers == nil {
+		breakers = []CircuitState{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"metrics": samples, "builder_circuits": breakers})
+}
+
+func (s *Server) handlePurgeEvents(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimSpace(r.URL.Query().Get("retention"))
+	if raw == "" {
+		writeError(w, http.StatusBadRequest, "retention query param required (e.g. 720h)")
+		return
+	}
+	retention, err := time.ParseDuration(raw)
+	if err != nil || retention <= 0 {
+		writeError(w, http.StatusBadRequest, "retention must be a positive duration")
+		return
+	}
+	result, err := s.PurgeExpiredEvents(r.Context(), retention)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "purge events: %v", err)
+		return
+	}
+	s.logger.Info("manual retention purge", "retention", retention, "purged", result.Total)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func defaultString(v, fallback string) string {
+	if strings.TrimSpace(v) == "" {
+		return fallback
+	}
+	return v
+}
+
 func parseIntDefault(raw string, fallback int) int {
 	if raw == "" {
 		return fallback
@@ -556,6 +2293,15 @@ func parseIntDefault(raw string, fallback int) int {
 	return n
 }
 
+// parseBoolDefault parses an optional boolean query value. Unlike parseIntDefault it rejects
+// malformed input, since silently flipping a boundary would return the wrong rows.
+func parseBoolDefault(raw string, fallback bool) (bool, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(raw)
+}
+
 func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
 	var startPtr, endPtr *time.Time
 	if start := strings.TrimSpace(r.URL.Query().Get("start")); start != "" {
@@ -585,6 +2331,37 @@ func parseTime(value string) (time.Time, error) {
 	return time.Time{}, errors.New("invalid time format, use RFC3339 or YYYY-MM-DD")
 }
 
+// validateBuilderBaseURL accepts absolute http(s) URLs only.
+func validateBuilderBaseURL(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("builder_base_url must be an absolute http(s) URL, got %q", raw)
+	}
+	return nil
+}
+
+// builderErrorStatus maps a FetchSiteProfile error to the status returned to our caller.
+func builderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBuilderUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrBuilderSiteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBuilderTimeout):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// maskSecret keeps only the last four characters of a secret for display.
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-4) + secret[len(secret)-4:]
+}
+
 func formatTimePtr(ts *time.Time) any {
 	if ts == nil {
 		return nil
@@ -592,11 +2369,70 @@ func formatTimePtr(ts *time.Time) any {
 	return ts.Format(time.RFC3339)
 }
 
+// compactJSONWriter marks a response whose JSON body should be written without indentation.
+type compactJSONWriter struct {
+	http.ResponseWriter
+}
+
+func (w compactJSONWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (compactJSONWriter) compactJSON() bool { return true }
+
+// compactJSONResponder is implemented by response writers that carry a compact JSON request.
+type compactJSONResponder interface {
+	compactJSON() bool
+}
+
+// wantsCompactResponse reports whether w, or any writer it wraps through Unwrap, asked for
+// compact JSON, so middleware that wraps the writer later does not lose the preference.
+func wantsCompactResponse(w http.ResponseWriter) bool {
+	for {
+		if c, ok := w.(compactJSONResponder); ok {
+			return c.compactJSON()
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// negotiateJSONFormat switches writeJSON to compact output for machine consumers that ask for
+// it with ?pretty=false or an Accept of application/json;pretty=false. Pretty-printing stays the
+// default so responses remain readable when debugging by hand.
+func negotiateJSONFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantsCompactJSON(r) {
+			w = compactJSONWriter{w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func wantsCompactJSON(r *http.Request) bool {
+	if v := r.URL.Query().Get("pretty"); v != "" {
+		pretty, err := strconv.ParseBool(v)
+		return err == nil && !pretty
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "application/json" && params["pretty"] == "false" {
+			return true
+		}
+	}
+	return false
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
+	if !wantsCompactResponse(w) {
+		enc.SetIndent("", "  ")
+	}
 	_ = enc.Encode(payload)
 }
 
@@ -611,12 +2447,50 @@ func writeError(w http.ResponseWriter, status int, format string, args ...any) {
 
 // SyncUsersForSite executes a full pagination-based sync for the given site.
 func (s *Server) SyncUsersForSite(ctx context.Context, site RegisteredSite) (SyncSummary, error) {
-	return s.syncSite(ctx, site, 1, nil, nil, s.fetchUsersPage)
+	result, err := s.SyncUserPages(ctx, site, 1, 0, nil, nil)
+	return result.Summary, err
 }
 
 // SyncOrdersForSite executes a full pagination-based sync for the given site.
 func (s *Server) SyncOrdersForSite(ctx context.Context, site RegisteredSite) (SyncSummary, error) {
-	return s.syncSite(ctx, site, 1, nil, nil, s.fetchOrdersPage)
+	result, err := s.SyncOrderPages(ctx, site, 1, 0, nil, nil)
+	return result.Summary, err
+}
+
+// LoadSite returns the registered site, or sql.ErrNoRows.
+func (s *Server) LoadSite(ctx context.Context, siteID string) (RegisteredSite, error) {
+	return s.store.GetSite(ctx, siteID)
+}
+
+// SyncUserPages fetches and persists up to maxPages pages (all when maxPages <= 0) of the site's
+// users from page on, optionally date-filtered.
+func (s *Server) SyncUserPages(ctx context.Context, site RegisteredSite, page, maxPages int, start, end *time.Time) (PagesBatchResult, error) {
+	return s.syncSite(ctx, site, page, maxPages, start, end, s.fetchUsersPage)
+}
+
+// SyncOrderPages fetches and persists up to maxPages pages (all when maxPages <= 0) of the site's
+// orders from page on, optionally date-filtered.
+func (s *Server) SyncOrderPages(ctx context.Context, site RegisteredSite, page, maxPages int, start, end *time.Time) (PagesBatchResult, error) {
+	return s.syncSite(ctx, site, page, maxPages, start, end, s.fetchOrdersPage)
+}
+
+// SyncChangesBatch ingests up to maxPages batches of the changes feed after since.
+func (s *Server) SyncChangesBatch(ctx context.Context, site RegisteredSite, since int64, maxPages int) (ChangesBatchResult, error) {
+	return s.syncChangesBatch(ctx, site, since, maxPages)
+}
+
+// ChangesWatermark returns the last ingested change seq for a site, 0 when none is stored.
+func (s *Server) ChangesWatermark(ctx context.Context, siteID string) (int64, error) {
+	wm, _, err := s.store.GetWatermark(ctx, siteID, changesWatermarkEntity)
+	if err != nil {
+		return 0, err
+	}
+	return wm.Seq, nil
+}
+
+// SaveChangesWatermark stores the last ingested change seq for a site.
+func (s *Server) SaveChangesWatermark(ctx context.Context, siteID string, seq int64) error {
+	return s.store.SetWatermark(ctx, SyncWatermark{SiteID: siteID, Entity: changesWatermarkEntity, Seq: seq})
 }
 
 // SyncAllSitesOnce loops through every registered site and pulls both users and orders.
@@ -655,10 +2529,30 @@ func (s *Server) SyncAllSitesOnce(ctx context.Context) {
 	}
 }
 
-// StartAutoSync begins a ticker-driven loop that fetches builder data every interval.
-func (s *Server) StartAutoSync(ctx context.Context, interval time.Duration) {
+// StartAutoSync begins a ticker-driven loop that fetches builder data every interval. The first
+// sweep waits initialDelay plus a random jitter in [0, jitter) so workers restarted together
+// do not all hit the builder at once; zero for both sweeps immediately. Before that it
+// terminates any cron autosync workflows left from running in cron mode.
+func (s *Server) StartAutoSync(ctx context.Context, interval, initialDelay, jitter time.Duration) {
+	delay := initialDelay
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	s.background.Add(1)
 	go func() {
-		s.logger.Info("autosync loop started", "interval", interval)
+		defer s.background.Done()
+		s.unscheduleCronSyncs(ctx)
+		s.logger.Info("autosync loop started", "interval", interval, "initial_delay", delay)
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				s.logger.Info("autosync loop stopped", "reason", ctx.Err())
+				return
+			case <-timer.C:
+			}
+		}
 		s.dispatchAllSites(ctx, "autosync-initial")
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -674,6 +2568,28 @@ func (s *Server) StartAutoSync(ctx context.Context, interval time.Duration) {
 	}()
 }
 
+// WaitBackground blocks until every loop started by StartAutoSync, StartRetentionPurge, or
+// StartWatermarkStalenessCheck has returned, or ctx is done. The loops exit once the context
+// they were started with is cancelled. It also stops the event sink from accepting events and
+// waits for its workers to publish the ones already queued, so call it only once nothing
+// inserts events anymore.
+func (s *Server) WaitBackground(ctx context.Context) error {
+	if s.sinkQueue != nil {
+		s.sinkQueue.close()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (s *Server) dispatchAllSites(ctx context.Context, reason string) {
 	if s.orchestrator == nil {
 		s.logger.Warn("autosync orchestrator not available; skipping dispatch")
@@ -684,21 +2600,24 @@ func (s *Server) dispatchAllSites(ctx context.Context, reason string) {
 		s.logger.Error("autosync dispatch list sites failed", "error", err)
 		return
 	}
+	sweep := AutoSyncSweep{At: time.Now().UTC(), Reason: reason}
+	defer func() { s.autoSync.record(sweep) }()
 	for _, site := range sites {
 		if err := ctx.Err(); err != nil {
 			return
 		}
-		id, err := s.orchestrator.RunSyncAsync(ctx, SyncWorkflowInput{
-			SiteID:        site.SiteID,
-			IncludeUsers:  true,
-			IncludeOrders: true,
-			Page:          1,
-			Reason:        reason,
-		})
+		if enabled, _ := strconv.ParseBool(s.flagValue(ctx, site.SiteID, FlagAutoSync)); !enabled {
+			s.logger.Info("autosync skipped by feature flag", "site_id", site.SiteID, "reason", reason)
+			s.unscheduleAutoSync(ctx, site.SiteID)
+			continue
+		}
+		id, err := s.startAutoSync(ctx, autoSyncInput(site.SiteID, reason))
 		if err != nil {
 			s.logger.Error("autosync dispatch failed", "site_id", site.SiteID, "error", err)
+			sweep.Failed++
 			continue
 		}
+		sweep.Dispatched++
 		s.logger.Info("autosync dispatched workflow", "site_id", site.SiteID, "workflow_id", id, "reason", reason)
 	}
 }
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/temporal-go/internal/sqliteutil"
+)
+
+// newTestStore opens an initialised event store in a temporary directory.
+func newTestStore(t *testing.T, opts ...StoreOption) *Store {
+	t.Helper()
+	db, err := sqliteutil.Open(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := NewStore(db, opts...)
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatalf("init store: %v", err)
+	}
+	return store
+}
+
+// newTestServer builds a server over store with no orchestrator and a discarded log.
+func newTestServer(t *testing.T, store *Store, opts ...ServerOption) *Server {
+	t.Helper()
+	return NewServer(store, NewBuilderClient(), nil, discardLogger(), opts...)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// serve sends a request with an optional JSON body through the server's router.
+func serve(t *testing.T, h http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// mustInsert stores event and fails the test unless it was inserted.
+func mustInsert(t *testing.T, store *Store, event Event) {
+	t.Helper()
+	inserted, err := store.InsertEvent(context.Background(), event)
+	if err != nil {
+		t.Fatalf("insert %s: %v", event.DedupeKey, err)
+	}
+	if !inserted {
+		t.Fatalf("insert %s: skipped as duplicate", event.DedupeKey)
+	}
+}
+
+// fakeOrchestrator records the inputs it is asked to run. Methods a test does not override
+// panic through the nil embedded interface.
+type fakeOrchestrator struct {
+	SyncOrchestrator
+	started     []SyncWorkflowInput
+	unscheduled []string
+	cancelled   []string
+}
+
+func (f *fakeOrchestrator) RunSyncAsync(ctx context.Context, input SyncWorkflowInput) (string, error) {
+	f.started = append(f.started, input)
+	return "sync-" + input.SiteID, nil
+}
+
+func (f *fakeOrchestrator) RunSync(ctx context.Context, input SyncWorkflowInput) (SyncWorkflowResult, error) {
+	f.started = append(f.started, input)
+	return SyncWorkflowResult{WorkflowID: "sync-" + input.SiteID}, nil
+}
+
+func (f *fakeOrchestrator) UnscheduleSync(ctx context.Context, siteID string) error {
+	f.unscheduled = append(f.unscheduled, siteID)
+	return nil
+}
+
+// CancelSync knows only the workflow IDs RunSyncAsync handed out.
+func (f *fakeOrchestrator) CancelSync(ctx context.Context, workflowID string) error {
+	for _, in := range f.started {
+		if "sync-"+in.SiteID == workflowID {
+			f.cancelled = append(f.cancelled, workflowID)
+			return nil
+		}
+	}
+	return ErrWorkflowNotFound
+}
@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventSink receives every event after it has been durably inserted into SQLite so it can be
+// forwarded to an external analytics pipeline.
+type EventSink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// NopEventSink discards events. It is the default when no sink is configured.
+type NopEventSink struct{}
+
+// Publish implements EventSink.
+func (NopEventSink) Publish(context.Context, Event) error { return nil }
+
+// HTTPEventSink POSTs each event as JSON to a fixed URL, retrying transient failures.
+type HTTPEventSink struct {
+	url        string
+	retries    int
+	httpClient *http.Client
+}
+
+// NewHTTPEventSink builds a sink that posts to url, attempting each event up to retries+1 times.
+func NewHTTPEventSink(url string, retries int) *HTTPEventSink {
+	if retries < 0 {
+		retries = 0
+	}
+	return &HTTPEventSink{
+		url:     url,
+		retries: retries,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// Publish implements EventSink.
+func (h *HTTPEventSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	var lastErr error
+	for attempt := 0; attempt <= h.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
+			}
+		}
+		lastErr = h.post(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("publish event after %d attempts: %w", h.retries+1, lastErr)
+}
+
+func (h *HTTPEventSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sink responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Sizing of the background publisher. Events beyond a full queue are dropped with a warning
+// rather than blocking the sync that inserted them.
+const (
+	sinkQueueSize = 1024
+	sinkWorkers   = 4
+	sinkTimeout   = 30 * time.Second
+)
+
+// sinkQueue is the bounded buffer between inserts and the sink workers. Once closed it rejects
+// new events, and the workers exit after draining what is left.
+type sinkQueue struct {
+	mu     sync.RWMutex
+	closed bool
+	events chan Event
+}
+
+// enqueue adds event unless the queue is full or closed, and reports whether it did.
+func (q *sinkQueue) enqueue(event Event) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *sinkQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+}
+
+// startEventSink starts the fixed pool of workers that publish queued events. It is a no-op
+// when no sink is configured. The workers count as background loops, so WaitBackground drains
+// the queue on shutdown.
+func (s *Server) startEventSink() {
+	if _, ok := s.sink.(NopEventSink); ok || s.sink == nil {
+		return
+	}
+	s.sinkQueue = &sinkQueue{events: make(chan Event, sinkQueueSize)}
+	for range sinkWorkers {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			for event := range s.sinkQueue.events {
+				ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+				if err := s.sink.Publish(ctx, event); err != nil {
+					s.logger.Warn("event sink publish failed", "site_id", event.SiteID, "dedupe_key", event.DedupeKey, "error", err)
+				}
+				cancel()
+			}
+		}()
+	}
+}
+
+// publishEvent queues a freshly inserted event for the sink workers so sink latency or outages
+// never block a sync. When the queue is full the event is dropped and logged.
+func (s *Server) publishEvent(event Event) {
+	if s.sinkQueue == nil {
+		return
+	}
+	if !s.sinkQueue.enqueue(event) {
+		s.logger.Warn("event sink queue full or closed; event not published", "site_id", event.SiteID, "dedupe_key", event.DedupeKey, "queue_size", sinkQueueSize)
+	}
+}
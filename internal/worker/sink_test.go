@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink collects published events, optionally blocking until release is closed.
+type recordingSink struct {
+	release chan struct{}
+
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recordingSink) Publish(ctx context.Context, event Event) error {
+	if r.release != nil {
+		select {
+		case <-r.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordingSink) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+func TestPublishEventDrainsQueueOnWaitBackground(t *testing.T) {
+	sink := &recordingSink{}
+	srv := newTestServer(t, newTestStore(t), WithEventSink(sink))
+	for i := range 100 {
+		srv.publishEvent(Event{SiteID: "s1", DedupeKey: string(rune('a' + i%26))})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitBackground(ctx); err != nil {
+		t.Fatalf("wait background: %v", err)
+	}
+	if got := sink.count(); got != 100 {
+		t.Fatalf("published %d events, want 100", got)
+	}
+	srv.publishEvent(Event{SiteID: "s1", DedupeKey: "late"})
+	if got := sink.count(); got != 100 {
+		t.Fatalf("event published after shutdown")
+	}
+}
+
+func TestPublishEventDropsWhenQueueFull(t *testing.T) {
+	sink := &recordingSink{release: make(chan struct{})}
+	srv := newTestServer(t, newTestStore(t), WithEventSink(sink))
+	// Every worker holds one event while blocked, so this overfills the queue.
+	total := sinkQueueSize + sinkWorkers + 50
+	for range total {
+		srv.publishEvent(Event{SiteID: "s1"})
+	}
+	close(sink.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.WaitBackground(ctx); err != nil {
+		t.Fatalf("wait background: %v", err)
+	}
+	got := sink.count()
+	if got >= total || got < sinkQueueSize {
+		t.Fatalf("published %d of %d events, want the queue's worth and some dropped", got, total)
+	}
+}
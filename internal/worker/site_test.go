@@ -0,0 +1,176 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetSiteRevealKeyRequiresAdminToken(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.RegisterSite(context.Background(), RegisteredSite{SiteID: "s1", AccessKey: "key-123456", BuilderBaseURL: "http://builder"}); err != nil {
+		t.Fatalf("register site: %v", err)
+	}
+	accessKey := func(body []byte) string {
+		var site RegisteredSite
+		if err := json.Unmarshal(body, &site); err != nil {
+			t.Fatalf("decode site: %v", err)
+		}
+		return site.AccessKey
+	}
+
+	open := newTestServer(t, store).Router()
+	rec := serve(t, open, http.MethodGet, "/worker/sites/s1", "", nil)
+	if rec.Code != http.StatusOK || accessKey(rec.Body.Bytes()) == "key-123456" {
+		t.Fatalf("masked get: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := serve(t, open, http.MethodGet, "/worker/sites/s1?reveal_key=true", "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("reveal without a configured token: status %d, want 403", rec.Code)
+	}
+
+	if rec := serve(t, open, http.MethodGet, "/worker/sites", "", nil); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "key-123456") {
+		t.Fatalf("list sites leaks the access key: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	guarded := newTestServer(t, store, WithAdminToken("secret")).Router()
+	if rec := serve(t, guarded, http.MethodGet, "/worker/sites/s1?reveal_key=true", "", http.Header{"X-Admin-Token": {"nope"}}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reveal with a wrong token: status %d, want 401", rec.Code)
+	}
+	rec = serve(t, guarded, http.MethodGet, "/worker/sites/s1?reveal_key=true", "", http.Header{"X-Admin-Token": {"secret"}})
+	if rec.Code != http.StatusOK || accessKey(rec.Body.Bytes()) != "key-123456" {
+		t.Fatalf("reveal with the token: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminEndpointsRequireAdminToken(t *testing.T) {
+	store := newTestStore(t)
+	mustInsert(t, store, Event{SiteID: "s1", UserID: "u1", EventName: "signup", DedupeKey: "signup:s1:u1"})
+
+	open := newTestServer(t, store).Router()
+	if rec := serve(t, open, http.MethodGet, "/worker/users/u1/sites", "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("admin endpoint without a configured token: status %d, want 403", rec.Code)
+	}
+	if rec := serve(t, open, http.MethodGet, "/worker/export", "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("export without a configured token: status %d, want 403", rec.Code)
+	}
+
+	guarded := newTestServer(t, store, WithAdminToken("secret")).Router()
+	if rec := serve(t, guarded, http.MethodGet, "/worker/users/u1/sites", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("admin endpoint without a token: status %d, want 401", rec.Code)
+	}
+	rec := serve(t, guarded, http.MethodGet, "/worker/users/u1/sites", "", http.Header{"X-Admin-Token": {"secret"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin endpoint with the token: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		SiteIDs []string `json:"site_ids"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body.SiteIDs) != 1 || body.SiteIDs[0] != "s1" {
+		t.Fatalf("user sites = %s (%v), want [s1]", rec.Body, err)
+	}
+}
+
+// profileBuilder serves the builder site profile endpoint, answering with status for each site
+// ID it knows and 200 for the rest.
+func profileBuilder(t *testing.T, status map[string]int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siteID := strings.TrimPrefix(r.URL.Path, DefaultBuilderAPIPrefix+"/sites/")
+		if code, ok := status[siteID]; ok {
+			w.WriteHeader(code)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": siteID, "name": "Shop " + siteID})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRegisterSiteReportsBuilderFailures(t *testing.T) {
+	builder := profileBuilder(t, map[string]int{
+		"bad-key": http.StatusUnauthorized,
+		"missing": http.StatusNotFound,
+		"broken":  http.StatusInternalServerError,
+	})
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	h := newTestServer(t, newTestStore(t)).Router()
+	register := func(siteID, baseURL string) int {
+		body := fmt.Sprintf(`{"site_id":%q,"access_key":"key","builder_base_url":%q}`, siteID, baseURL)
+		return serve(t, h, http.MethodPost, "/worker/sites", body, nil).Code
+	}
+
+	for siteID, want := range map[string]int{
+		"ok":      http.StatusCreated,
+		"bad-key": http.StatusUnauthorized,
+		"missing": http.StatusNotFound,
+		"broken":  http.StatusBadGateway,
+	} {
+		if got := register(siteID, builder.URL); got != want {
+			t.Errorf("register %s: status %d, want %d", siteID, got, want)
+		}
+	}
+	if got := register("unreachable", down.URL); got != http.StatusBadGateway {
+		t.Errorf("register against a closed builder: status %d, want 502", got)
+	}
+}
+
+func TestRegisterSiteFailsOverBuilderBaseURLs(t *testing.T) {
+	builder := profileBuilder(t, nil)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	store := newTestStore(t)
+	h := newTestServer(t, store).Router()
+
+	body := fmt.Sprintf(`{"site_id":"s1","access_key":"key","builder_base_urls":[%q,%q]}`, down.URL, builder.URL)
+	if rec := serve(t, h, http.MethodPost, "/worker/sites", body, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("register with a dead first URL: status %d, body %s", rec.Code, rec.Body)
+	}
+	site, err := store.GetSite(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("get site: %v", err)
+	}
+	if want := []string{down.URL, builder.URL}; !slices.Equal(site.BaseURLs(), want) {
+		t.Fatalf("base URLs = %v, want %v in order", site.BaseURLs(), want)
+	}
+
+	body = fmt.Sprintf(`{"site_id":"s2","access_key":"key","builder_base_urls":[%q,%q]}`, down.URL, down.URL+"/other")
+	rec := serve(t, h, http.MethodPost, "/worker/sites", body, nil)
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "all 2 builder endpoints failed") {
+		t.Fatalf("register with every URL down: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	urls := make([]string, maxBuilderBaseURLs+1)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%q", fmt.Sprintf("http://builder-%d", i))
+	}
+	body = `{"site_id":"s3","access_key":"key","builder_base_urls":[` + strings.Join(urls, ",") + `]}`
+	if rec := serve(t, h, http.MethodPost, "/worker/sites", body, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("register with too many URLs: status %d, want 400", rec.Code)
+	}
+}
+
+func TestAttributionMapRejectsUnknownSites(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.RegisterSite(context.Background(), RegisteredSite{SiteID: "s1", AccessKey: "key", BuilderBaseURL: "http://builder"}); err != nil {
+		t.Fatalf("register site: %v", err)
+	}
+	mustInsert(t, store, Event{SiteID: "s1", UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: "touch"})
+	h := newTestServer(t, store).Router()
+
+	if rec := serve(t, h, http.MethodGet, "/worker/sites/s2/attribution-map", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown site: status %d, want 404", rec.Code)
+	}
+	rec := serve(t, h, http.MethodGet, "/worker/sites/s1/attribution-map", "", nil)
+	var body struct {
+		Attribution map[string]string `json:"attribution"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusOK || err != nil || body.Attribution["u1"] != "google" {
+		t.Fatalf("registered site: status %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// StartWatermarkStalenessCheck periodically logs a warning for every sync watermark that has not
+// advanced within threshold, so a site whose syncs silently stopped making progress is noticed
+// even though no individual run failed. A non-positive threshold disables the check.
+func (s *Server) StartWatermarkStalenessCheck(ctx context.Context, threshold, interval time.Duration) {
+	if threshold <= 0 {
+		s.logger.Info("watermark staleness check disabled")
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.logger.Info("watermark staleness loop started", "threshold", threshold, "interval", interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.logger.Info("watermark staleness loop stopped", "reason", ctx.Err())
+				return
+			case <-ticker.C:
+				s.checkStaleWatermarks(ctx, threshold)
+			}
+		}
+	}()
+}
+
+func (s *Server) checkStaleWatermarks(ctx context.Context, threshold time.Duration) {
+	watermarks, err := s.store.ListWatermarks(ctx, "")
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error("watermark staleness check failed", "error", err)
+		}
+		return
+	}
+	now := time.Now().UTC()
+	stale := 0
+	for _, wm := range watermarks {
+		age := now.Sub(wm.UpdatedAt)
+		if age <= threshold {
+			continue
+		}
+		stale++
+		s.logger.Warn("sync watermark is stale", "site_id", wm.SiteID, "entity", wm.Entity, "seq", wm.Seq, "updated_at", wm.UpdatedAt.Format(time.RFC3339), "age", age.Round(time.Second), "threshold", threshold)
+	}
+	s.logger.Info("watermark staleness check completed", "watermarks", len(watermarks), "stale", stale)
+}
@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/converter"
+)
+
+// statusTemporalTimeout bounds the Temporal lookup in Status so a down cluster cannot stall the
+// whole report.
+const statusTemporalTimeout = 2 * time.Second
+
+// statusRecentFailures is how many failed sync runs Status lists.
+const statusRecentFailures = 5
+
+// WorkerStatus is the one-glance operational view served at /worker/status.
+type WorkerStatus struct {
+	RegisteredSites int            `json:"registered_sites"`
+	LastAutoSync    *AutoSyncSweep `json:"last_autosync"`
+	Temporal        TemporalStatus `json:"temporal"`
+	RecentFailures  []SyncRun      `json:"recent_failures"`
+	PausedSites     []string       `json:"paused_sites"`
+	OpenCircuits    []CircuitState `json:"open_circuits"`
+	GeneratedAt     time.Time      `json:"generated_at"`
+}
+
+// AutoSyncSweep records when the autosync loop last dispatched workflows.
+type AutoSyncSweep struct {
+	At         time.Time `json:"at"`
+	Reason     string    `json:"reason"`
+	Dispatched int       `json:"dispatched"`
+	Failed     int       `json:"failed"`
+}
+
+// TemporalStatus reports the Temporal-dependent part of WorkerStatus. When the cluster cannot
+// be reached Available is false, RunningWorkflows is omitted, and Error says why.
+type TemporalStatus struct {
+	Available        bool   `json:"available"`
+	RunningWorkflows *int64 `json:"running_workflows,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// autoSyncTracker remembers the most recent autosync sweep for Status.
+type autoSyncTracker struct {
+	mu   sync.Mutex
+	last *AutoSyncSweep
+}
+
+func (t *autoSyncTracker) record(sweep AutoSyncSweep) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = &sweep
+}
+
+func (t *autoSyncTracker) snapshot() *AutoSyncSweep {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		return nil
+	}
+	sweep := *t.last
+	return &sweep
+}
+
+// ErrVisibilityUnavailable is returned when the Temporal cluster cannot answer visibility list
+// queries, typically because advanced visibility is not enabled.
+var ErrVisibilityUnavailable = errors.New("temporal visibility unavailable")
+
+// ActiveSync is one running sync workflow as Temporal visibility reports it.
+type ActiveSync struct {
+	WorkflowID string `json:"workflow_id"`
+	RunID      string `json:"run_id"`
+	// SiteID comes from the SiteID search attribute; it is empty for syncs started before the
+	// attribute was set.
+	SiteID    string    `json:"site_id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// runningSyncsQuery selects sync workflows that are still executing.
+var runningSyncsQuery = fmt.Sprintf("WorkflowType = '%s' AND ExecutionStatus = 'Running'", syncWorkflowName)
+
+// ListActiveSyncs lists the sync workflows Temporal reports as running, newest first as
+// visibility returns them, narrowed to one site through the SiteID search attribute when siteID
+// is set. A cluster that rejects the list query yields ErrVisibilityUnavailable.
+func (o *TemporalOrchestrator) ListActiveSyncs(ctx context.Context, siteID string) ([]ActiveSync, error) {
+	query := runningSyncsQuery
+	if siteID != "" {
+		query += fmt.Sprintf(" AND %s = '%s'", SiteIDSearchAttribute, strings.ReplaceAll(siteID, "'", "''"))
+	}
+	syncs := []ActiveSync{}
+	var token []byte
+	for {
+		resp, err := o.client.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Query:         query,
+			NextPageToken: token,
+		})
+		if err != nil {
+			var unimplemented *serviceerror.Unimplemented
+			var invalid *serviceerror.InvalidArgument
+			if errors.As(err, &unimplemented) || errors.As(err, &invalid) {
+				return nil, fmt.Errorf("%w: %v", ErrVisibilityUnavailable, err)
+			}
+			return nil, fmt.Errorf("list running syncs: %w", err)
+		}
+		for _, info := range resp.GetExecutions() {
+			syncs = append(syncs, ActiveSync{
+				WorkflowID: info.GetExecution().GetWorkflowId(),
+				RunID:      info.GetExecution().GetRunId(),
+				SiteID:     searchAttributeString(info.GetSearchAttributes(), SiteIDSearchAttribute),
+				StartedAt:  info.GetStartTime().AsTime(),
+			})
+		}
+		token = resp.GetNextPageToken()
+		if len(token) == 0 {
+			return syncs, nil
+		}
+	}
+}
+
+// searchAttributeString decodes a Keyword search attribute from a visibility record, returning ""
+// when it is absent or not a string.
+func searchAttributeString(attrs *commonpb.SearchAttributes, name string) string {
+	payload, ok := attrs.GetIndexedFields()[name]
+	if !ok {
+		return ""
+	}
+	var value string
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &value); err != nil {
+		return ""
+	}
+	return value
+}
+
+// RunningWorkflows counts sync workflows Temporal reports as running.
+func (o *TemporalOrchestrator) RunningWorkflows(ctx context.Context) (int64, error) {
+	resp, err := o.client.CountWorkflow(ctx, &workflowservice.CountWorkflowExecutionsRequest{
+		Query: runningSyncsQuery,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetCount(), nil
+}
+
+// Status assembles WorkerStatus from the store, the autosync loop, the builder client, and
+// Temporal. Store failures fail the report; a Temporal failure only marks that section
+// unavailable.
+func (s *Server) Status(ctx context.Context) (WorkerStatus, error) {
+	sites, err := s.store.ListSites(ctx)
+	if err != nil {
+		return WorkerStatus{}, err
+	}
+	failures, err := s.store.ListSyncRuns(ctx, SyncRunFilter{Status: SyncRunStatusFailed, Limit: statusRecentFailures})
+	if err != nil {
+		return WorkerStatus{}, err
+	}
+	status := WorkerStatus{
+		RegisteredSites: len(sites),
+		LastAutoSync:    s.autoSync.snapshot(),
+		Temporal:        s.temporalStatus(ctx),
+		RecentFailures:  failures.Runs,
+		PausedSites:     []string{},
+		OpenCircuits:    []CircuitState{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+	for _, site := range sites {
+		if enabled, _ := strconv.ParseBool(s.flagValue(ctx, site.SiteID, FlagAutoSync)); !enabled {
+			status.PausedSites = append(status.PausedSites, site.SiteID)
+		}
+	}
+	for _, c := range s.builderClient.CircuitStates() {
+		if c.State != CircuitClosed {
+			status.OpenCircuits = append(status.OpenCircuits, c)
+		}
+	}
+	return status, nil
+}
+
+func (s *Server) temporalStatus(ctx context.Context) TemporalStatus {
+	if s.orchestrator == nil {
+		return TemporalStatus{Error: "sync orchestrator not configured"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, statusTemporalTimeout)
+	defer cancel()
+	running, err := s.orchestrator.RunningWorkflows(ctx)
+	if err != nil {
+		return TemporalStatus{Error: err.Error()}
+	}
+	return TemporalStatus{Available: true, RunningWorkflows: &running}
+}
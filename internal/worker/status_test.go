@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// runningSync is the visibility record of a running sync workflow for siteID.
+func runningSync(t *testing.T, workflowID, runID, siteID string, started time.Time) *workflowpb.WorkflowExecutionInfo {
+	t.Helper()
+	payload, err := converter.GetDefaultDataConverter().ToPayload(siteID)
+	require.NoError(t, err)
+	return &workflowpb.WorkflowExecutionInfo{
+		Execution:        &commonpb.WorkflowExecution{WorkflowId: workflowID, RunId: runID},
+		StartTime:        timestamppb.New(started),
+		SearchAttributes: &commonpb.SearchAttributes{IndexedFields: map[string]*commonpb.Payload{SiteIDSearchAttribute: payload}},
+	}
+}
+
+func TestListActiveSyncsFollowsPageTokens(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	c := mocks.NewClient(t)
+	c.On("ListWorkflow", mock.Anything, &workflowservice.ListWorkflowExecutionsRequest{Query: runningSyncsQuery}).
+		Return(&workflowservice.ListWorkflowExecutionsResponse{
+			Executions:    []*workflowpb.WorkflowExecutionInfo{runningSync(t, "sync-s1", "r1", "s1", t0)},
+			NextPageToken: []byte("next"),
+		}, nil).Once()
+	c.On("ListWorkflow", mock.Anything, &workflowservice.ListWorkflowExecutionsRequest{Query: runningSyncsQuery, NextPageToken: []byte("next")}).
+		Return(&workflowservice.ListWorkflowExecutionsResponse{
+			Executions: []*workflowpb.WorkflowExecutionInfo{runningSync(t, "autosync-s2", "r2", "s2", t0.Add(time.Minute))},
+		}, nil).Once()
+	h := NewServer(newTestStore(t), NewBuilderClient(), NewTemporalOrchestrator(c, discardLogger()), discardLogger()).Router()
+
+	rec := serve(t, h, http.MethodGet, "/worker/syncs/active", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Syncs []ActiveSync `json:"syncs"`
+		Count int          `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 2, body.Count)
+	require.Equal(t, []ActiveSync{
+		{WorkflowID: "sync-s1", RunID: "r1", SiteID: "s1", StartedAt: t0},
+		{WorkflowID: "autosync-s2", RunID: "r2", SiteID: "s2", StartedAt: t0.Add(time.Minute)},
+	}, body.Syncs)
+}
+
+func TestListActiveSyncsFiltersBySite(t *testing.T) {
+	c := mocks.NewClient(t)
+	c.On("ListWorkflow", mock.Anything, &workflowservice.ListWorkflowExecutionsRequest{
+		Query: runningSyncsQuery + " AND " + SiteIDSearchAttribute + " = 'o''brien'",
+	}).Return(&workflowservice.ListWorkflowExecutionsResponse{}, nil).Once()
+
+	syncs, err := NewTemporalOrchestrator(c, discardLogger()).ListActiveSyncs(context.Background(), "o'brien")
+	require.NoError(t, err)
+	require.Empty(t, syncs)
+}
+
+func TestListActiveSyncsWithoutVisibility(t *testing.T) {
+	c := mocks.NewClient(t)
+	c.On("ListWorkflow", mock.Anything, mock.Anything).
+		Return(nil, serviceerror.NewUnimplemented("advanced visibility is not enabled"))
+	h := NewServer(newTestStore(t), NewBuilderClient(), NewTemporalOrchestrator(c, discardLogger()), discardLogger()).Router()
+
+	rec := serve(t, h, http.MethodGet, "/worker/syncs/active", "", nil)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), ErrVisibilityUnavailable.Error())
+}
@@ -3,28 +3,79 @@ package worker
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/google/uuid"
 )
 
+// DefaultMaxPropertiesBytes caps the serialized size of an event's properties.
+const DefaultMaxPropertiesBytes = 64 * 1024
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrPropertiesTooLarge is returned by InsertEvent when serialized properties exceed the cap.
+var ErrPropertiesTooLarge = errors.New("event properties exceed size limit")
+
+// ErrSiteIDConflict is returned by RegisterSite when case-insensitive site IDs are enabled and a
+// different-case variant of the ID is already registered.
+var ErrSiteIDConflict = errors.New("site_id differs only in case from a registered site")
+
 // Store encapsulates access to the worker side SQLite database.
 type Store struct {
-	db *sql.DB
+	db                 *sql.DB
+	maxPropertiesBytes int
+	dedupeScope        string
+	foldSiteIDs        bool
+	ids                IDGenerator
+}
+
+// StoreOption customises optional Store behaviour.
+type StoreOption func(*Store)
+
+// WithMaxPropertiesBytes overrides the serialized properties cap. Non-positive values disable it.
+func WithMaxPropertiesBytes(n int) StoreOption {
+	return func(s *Store) {
+		s.maxPropertiesBytes = n
+	}
+}
+
+// WithCaseInsensitiveSiteIDs makes registry lookups ignore ASCII case in site_id. IDs are still
+// stored as registered, since the builder matches them exactly. Init refuses to start while two
+// registered IDs differ only in case.
+func WithCaseInsensitiveSiteIDs() StoreOption {
+	return func(s *Store) {
+		s.foldSiteIDs = true
+	}
+}
+
+// WithIDGenerator replaces the UUIDs used in generated user IDs, session IDs, and dedupe keys.
+func WithIDGenerator(gen IDGenerator) StoreOption {
+	return func(s *Store) {
+		s.ids = gen
+	}
 }
 
 // NewStore constructs a worker data access object.
-func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+func NewStore(db *sql.DB, opts ...StoreOption) *Store {
+	s := &Store{db: db, maxPropertiesBytes: DefaultMaxPropertiesBytes, dedupeScope: DedupeScopeKey, ids: UUIDGenerator}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Init applies schema changes for the event and site registry tables.
 func (s *Store) Init(ctx context.Context) error {
+	if err := s.validateDedupeScope(); err != nil {
+		return err
+	}
 	stmts := []string{
 		`CREATE TABLE IF NOT EXISTS registered_sites (
 			site_id TEXT PRIMARY KEY,
@@ -32,37 +83,141 @@ func (s *Store) Init(ctx context.Context) error {
 			builder_base_url TEXT NOT NULL,
 			registered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);`,
-		`CREATE TABLE IF NOT EXISTS events (
+		eventsTableSQL("events"),
+		`CREATE TABLE IF NOT EXISTS sync_watermarks (
+			site_id TEXT NOT NULL,
+			entity TEXT NOT NULL,
+			seq INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(site_id, entity)
+		);`,
+		`CREATE TABLE IF NOT EXISTS sync_runs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			workflow_id TEXT NOT NULL,
+			run_id TEXT NOT NULL DEFAULT '',
 			site_id TEXT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			user_id TEXT NOT NULL,
-			event_name TEXT NOT NULL,
-			utm_source TEXT,
-			properties TEXT NOT NULL,
-			dedupe_key TEXT NOT NULL UNIQUE,
-			ingested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			metadata TEXT
+			reason TEXT NOT NULL DEFAULT '',
+			input TEXT NOT NULL,
+			status TEXT NOT NULL,
+			inserted INTEGER NOT NULL DEFAULT 0,
+			skipped INTEGER NOT NULL DEFAULT 0,
+			pages INTEGER NOT NULL DEFAULT 0,
+			started_at TIMESTAMP NOT NULL,
+			completed_at TIMESTAMP NOT NULL,
+			error TEXT
 		);`,
-		`CREATE INDEX IF NOT EXISTS idx_events_user ON events(user_id, timestamp DESC);`,
-		`CREATE INDEX IF NOT EXISTS idx_events_site ON events(site_id, timestamp DESC);`,
+		`CREATE TABLE IF NOT EXISTS feature_flags (
+			site_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(site_id, key)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_runs_started ON sync_runs(started_at DESC, id DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_runs_site_started ON sync_runs(site_id, started_at DESC, id DESC);`,
 	}
 	for _, stmt := range stmts {
 		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
 			return fmt.Errorf("apply worker schema: %w", err)
 		}
 	}
+	columns := []struct{ table, column, decl string }{
+		{"registered_sites", "builder_site_name", "TEXT"},
+		{"registered_sites", "builder_base_urls", "TEXT"},
+		{"registered_sites", "api_prefix", "TEXT"},
+		{"events", "dedupe_scope", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if err := s.addColumnIfMissing(ctx, c.table, c.column, c.decl); err != nil {
+			return fmt.Errorf("apply worker schema: %w", err)
+		}
+	}
+	for _, stmt := range eventIndexes {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("apply worker schema: %w", err)
+		}
+	}
+	if s.foldSiteIDs {
+		var dupe string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT site_id FROM registered_sites GROUP BY site_id COLLATE NOCASE HAVING COUNT(*) > 1 LIMIT 1`).Scan(&dupe)
+		if err == nil {
+			return fmt.Errorf("case-insensitive site ids: %w: %q", ErrSiteIDConflict, dupe)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("check site id case collisions: %w", err)
+		}
+	}
+	return s.migrateDedupeScope(ctx)
+}
+
+// siteIDMatch is the WHERE clause for one site_id placeholder, shared by the registry and the
+// per-site flag, watermark, sync run, and purge queries. Callers pass a trimmed site ID.
+func (s *Store) siteIDMatch() string {
+	if s.foldSiteIDs {
+		return "site_id = ? COLLATE NOCASE"
+	}
+	return "site_id = ?"
+}
+
+// addColumnIfMissing upgrades databases created before a column was introduced.
+func (s *Store) addColumnIfMissing(ctx context.Context, table, column, decl string) error {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("inspect %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	rows.Close()
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl)); err != nil {
+		return fmt.Errorf("add %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
-// RegisterSite stores builder credentials so the worker can talk to the external API.
+// RegisterSite stores builder credentials so the worker can talk to the external API. The
+// site_id is trimmed before it is stored.
 func (s *Store) RegisterSite(ctx context.Context, site RegisteredSite) error {
+	site.SiteID = strings.TrimSpace(site.SiteID)
+	if s.foldSiteIDs {
+		var existing string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT site_id FROM registered_sites WHERE `+s.siteIDMatch(), site.SiteID).Scan(&existing)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("register site: %w", err)
+		}
+		if err == nil && existing != site.SiteID {
+			return fmt.Errorf("%w: %q", ErrSiteIDConflict, existing)
+		}
+	}
+	var baseURLs string
+	if len(site.BuilderBaseURLs) > 1 {
+		encoded, err := json.Marshal(site.BuilderBaseURLs)
+		if err != nil {
+			return fmt.Errorf("encode builder base urls: %w", err)
+		}
+		baseURLs = string(encoded)
+	}
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO registered_sites(site_id, access_key, builder_base_url, registered_at) 
-		 VALUES(?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))
+		`INSERT INTO registered_sites(site_id, access_key, builder_base_url, builder_base_urls, builder_site_name, api_prefix, registered_at) 
+		 VALUES(?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))
 		 ON CONFLICT(site_id) DO UPDATE SET access_key = excluded.access_key,
-			builder_base_url = excluded.builder_base_url`,
-		site.SiteID, site.AccessKey, site.BuilderBaseURL, site.RegisteredAt,
+			builder_base_url = excluded.builder_base_url,
+			builder_base_urls = excluded.builder_base_urls,
+			builder_site_name = excluded.builder_site_name,
+			api_prefix = excluded.api_prefix`,
+		site.SiteID, site.AccessKey, site.BuilderBaseURL, nullIfEmpty(baseURLs), nullIfEmpty(site.BuilderSiteName), nullIfEmpty(site.APIPrefix), site.RegisteredAt,
 	)
 	if err != nil {
 		return fmt.Errorf("register site: %w", err)
@@ -72,7 +227,7 @@ func (s *Store) RegisterSite(ctx context.Context, site RegisteredSite) error {
 
 // UnregisterSite removes worker credentials and prevents further sync attempts.
 func (s *Store) UnregisterSite(ctx context.Context, siteID string) error {
-	res, err := s.db.ExecContext(ctx, `DELETE FROM registered_sites WHERE site_id = ?`, siteID)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM registered_sites WHERE `+s.siteIDMatch(), strings.TrimSpace(siteID))
 	if err != nil {
 		return fmt.Errorf("unregister site: %w", err)
 	}
@@ -82,13 +237,106 @@ func (s *Store) UnregisterSite(ctx context.Context, siteID string) error {
 	return nil
 }
 
-// GetSite fetches a registered site.
+// SiteFilter selects registered sites for bulk operations. Set fields are combined with AND; an
+// empty filter matches nothing rather than the whole registry.
+type SiteFilter struct {
+	RegisteredBefore *time.Time
+	SiteIDs          []string
+}
+
+// Empty reports whether the filter has no criteria.
+func (f SiteFilter) Empty() bool {
+	return f.RegisteredBefore == nil && len(f.SiteIDs) == 0
+}
+
+// BulkUnregisterResult reports an UnregisterSites call.
+type BulkUnregisterResult struct {
+	SiteIDs      []string `json:"site_ids"`
+	Unregistered int      `json:"unregistered"`
+	EventsPurged int64    `json:"events_purged"`
+}
+
+// UnregisterSites removes every registered site matching filter in one transaction. With
+// purgeEvents their events are deleted in the same transaction.
+func (s *Store) UnregisterSites(ctx context.Context, filter SiteFilter, purgeEvents bool) (BulkUnregisterResult, error) {
+	if filter.Empty() {
+		return BulkUnregisterResult{}, errors.New("a filter is required to unregister sites in bulk")
+	}
+	var clauses []string
+	var args []any
+	if filter.RegisteredBefore != nil {
+		clauses = append(clauses, "registered_at < ?")
+		args = append(args, filter.RegisteredBefore.UTC())
+	}
+	if len(filter.SiteIDs) > 0 {
+		column := "site_id"
+		if s.foldSiteIDs {
+			column = "site_id COLLATE NOCASE"
+		}
+		clauses = append(clauses, fmt.Sprintf("%s IN (%s)", column, strings.TrimSuffix(strings.Repeat("?,", len(filter.SiteIDs)), ",")))
+		for _, id := range filter.SiteIDs {
+			args = append(args, strings.TrimSpace(id))
+		}
+	}
+	where := strings.Join(clauses, " AND ")
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return BulkUnregisterResult{}, fmt.Errorf("begin unregister tx: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT site_id FROM registered_sites WHERE `+where+` ORDER BY site_id`, args...)
+	if err != nil {
+		return BulkUnregisterResult{}, fmt.Errorf("select sites to unregister: %w", err)
+	}
+	result := BulkUnregisterResult{SiteIDs: []string{}}
+	for rows.Next() {
+		var siteID string
+		if err := rows.Scan(&siteID); err != nil {
+			rows.Close()
+			return BulkUnregisterResult{}, fmt.Errorf("scan site to unregister: %w", err)
+		}
+		result.SiteIDs = append(result.SiteIDs, siteID)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return BulkUnregisterResult{}, fmt.Errorf("iter sites to unregister: %w", err)
+	}
+	rows.Close()
+	if len(result.SiteIDs) == 0 {
+		return result, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(result.SiteIDs)), ",")
+	matched := make([]any, len(result.SiteIDs))
+	for i, id := range result.SiteIDs {
+		matched[i] = id
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM registered_sites WHERE site_id IN (`+placeholders+`)`, matched...)
+	if err != nil {
+		return BulkUnregisterResult{}, fmt.Errorf("unregister sites: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	result.Unregistered = int(n)
+	if purgeEvents {
+		res, err := tx.ExecContext(ctx, `DELETE FROM events WHERE site_id IN (`+placeholders+`)`, matched...)
+		if err != nil {
+			return BulkUnregisterResult{}, fmt.Errorf("purge unregistered site events: %w", err)
+		}
+		result.EventsPurged, _ = res.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		return BulkUnregisterResult{}, fmt.Errorf("commit unregister: %w", err)
+	}
+	return result, nil
+}
+
+// GetSite fetches a registered site. siteID is trimmed, and matched ignoring case when
+// WithCaseInsensitiveSiteIDs is set; the returned SiteID is always the stored spelling.
 func (s *Store) GetSite(ctx context.Context, siteID string) (RegisteredSite, error) {
-	var site RegisteredSite
 	row := s.db.QueryRowContext(ctx,
-		`SELECT site_id, access_key, builder_base_url, registered_at 
-		 FROM registered_sites WHERE site_id = ?`, siteID)
-	if err := row.Scan(&site.SiteID, &site.AccessKey, &site.BuilderBaseURL, &site.RegisteredAt); err != nil {
+		`SELECT `+registeredSiteColumns+` FROM registered_sites WHERE `+s.siteIDMatch(), strings.TrimSpace(siteID))
+	site, err := scanRegisteredSite(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return RegisteredSite{}, err
 		}
@@ -100,16 +348,15 @@ func (s *Store) GetSite(ctx context.Context, siteID string) (RegisteredSite, err
 // ListSites returns all registered sites.
 func (s *Store) ListSites(ctx context.Context) ([]RegisteredSite, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT site_id, access_key, builder_base_url, registered_at 
-		 FROM registered_sites ORDER BY registered_at DESC`)
+		`SELECT `+registeredSiteColumns+` FROM registered_sites ORDER BY registered_at DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("list sites: %w", err)
 	}
 	defer rows.Close()
 	var sites []RegisteredSite
 	for rows.Next() {
-		var site RegisteredSite
-		if err := rows.Scan(&site.SiteID, &site.AccessKey, &site.BuilderBaseURL, &site.RegisteredAt); err != nil {
+		site, err := scanRegisteredSite(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan site: %w", err)
 		}
 		sites = append(sites, site)
@@ -120,12 +367,577 @@ func (s *Store) ListSites(ctx context.Context) ([]RegisteredSite, error) {
 	return sites, nil
 }
 
+// registeredSiteColumns is the select list scanRegisteredSite expects.
+const registeredSiteColumns = `site_id, access_key, builder_base_url, COALESCE(builder_base_urls, ''), COALESCE(builder_site_name, ''), COALESCE(api_prefix, ''), registered_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRegisteredSite(row rowScanner) (RegisteredSite, error) {
+	var (
+		site     RegisteredSite
+		baseURLs string
+	)
+	if err := row.Scan(&site.SiteID, &site.AccessKey, &site.BuilderBaseURL, &baseURLs, &site.BuilderSiteName, &site.APIPrefix, &site.RegisteredAt); err != nil {
+		return RegisteredSite{}, err
+	}
+	if baseURLs != "" {
+		if err := json.Unmarshal([]byte(baseURLs), &site.BuilderBaseURLs); err != nil {
+			return RegisteredSite{}, fmt.Errorf("decode builder base urls for %s: %w", site.SiteID, err)
+		}
+	}
+	return site, nil
+}
+
+// GetWatermark returns the stored watermark for a site/entity. The bool is false when the site
+// has never recorded one, in which case callers should start from seq 0.
+func (s *Store) GetWatermark(ctx context.Context, siteID, entity string) (SyncWatermark, bool, error) {
+	wm := SyncWatermark{SiteID: siteID, Entity: entity}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT seq, updated_at FROM sync_watermarks WHERE `+s.siteIDMatch()+` AND entity = ?`, strings.TrimSpace(siteID), entity).
+		Scan(&wm.Seq, &wm.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return wm, false, nil
+		}
+		return SyncWatermark{}, false, fmt.Errorf("get watermark: %w", err)
+	}
+	return wm, true, nil
+}
+
+// SetWatermark upserts the watermark for a site/entity.
+func (s *Store) SetWatermark(ctx context.Context, wm SyncWatermark) error {
+	if wm.UpdatedAt.IsZero() {
+		wm.UpdatedAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO sync_watermarks(site_id, entity, seq, updated_at) VALUES(?, ?, ?, ?)
+		 ON CONFLICT(site_id, entity) DO UPDATE SET seq = excluded.seq, updated_at = excluded.updated_at`,
+		wm.SiteID, wm.Entity, wm.Seq, wm.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("set watermark: %w", err)
+	}
+	return nil
+}
+
+// ListWatermarks returns every stored watermark, optionally restricted to one site.
+func (s *Store) ListWatermarks(ctx context.Context, siteID string) ([]SyncWatermark, error) {
+	query := `SELECT site_id, entity, seq, updated_at FROM sync_watermarks`
+	var args []any
+	if siteID = strings.TrimSpace(siteID); siteID != "" {
+		query += ` WHERE ` + s.siteIDMatch()
+		args = append(args, siteID)
+	}
+	query += ` ORDER BY site_id, entity`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list watermarks: %w", err)
+	}
+	defer rows.Close()
+	var watermarks []SyncWatermark
+	for rows.Next() {
+		var wm SyncWatermark
+		if err := rows.Scan(&wm.SiteID, &wm.Entity, &wm.Seq, &wm.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan watermark: %w", err)
+		}
+		watermarks = append(watermarks, wm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter watermarks: %w", err)
+	}
+	return watermarks, nil
+}
+
+// GetFeatureFlag returns the stored value of a site's flag. The bool is false when the flag has
+// never been set, in which case callers should fall back to its default.
+func (s *Store) GetFeatureFlag(ctx context.Context, siteID, key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT value FROM feature_flags WHERE `+s.siteIDMatch()+` AND key = ?`, strings.TrimSpace(siteID), key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("get feature flag: %w", err)
+	}
+	return value, true, nil
+}
+
+// SetFeatureFlag upserts a site's flag.
+func (s *Store) SetFeatureFlag(ctx context.Context, flag FeatureFlag) error {
+	if flag.UpdatedAt.IsZero() {
+		flag.UpdatedAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO feature_flags(site_id, key, value, updated_at) VALUES(?, ?, ?, ?)
+		 ON CONFLICT(site_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		flag.SiteID, flag.Key, flag.Value, flag.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("set feature flag: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeatureFlag removes a site's flag so its default applies again. It returns sql.ErrNoRows
+// when the flag was not set.
+func (s *Store) DeleteFeatureFlag(ctx context.Context, siteID, key string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE `+s.siteIDMatch()+` AND key = ?`, strings.TrimSpace(siteID), key)
+	if err != nil {
+		return fmt.Errorf("delete feature flag: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListFeatureFlags returns every flag stored for a site, ordered by key.
+func (s *Store) ListFeatureFlags(ctx context.Context, siteID string) ([]FeatureFlag, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT site_id, key, value, updated_at FROM feature_flags WHERE `+s.siteIDMatch()+` ORDER BY key`, strings.TrimSpace(siteID))
+	if err != nil {
+		return nil, fmt.Errorf("list feature flags: %w", err)
+	}
+	defer rows.Close()
+	var flags []FeatureFlag
+	for rows.Next() {
+		var f FeatureFlag
+		if err := rows.Scan(&f.SiteID, &f.Key, &f.Value, &f.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan feature flag: %w", err)
+		}
+		flags = append(flags, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+// DefaultSyncRunLimit and MaxSyncRunLimit bound ListSyncRuns page sizes.
+const (
+	DefaultSyncRunLimit = 20
+	MaxSyncRunLimit     = 100
+)
+
+// RecordSyncRun appends a finished sync to the history table and returns its id.
+func (s *Store) RecordSyncRun(ctx context.Context, run SyncRun) (int64, error) {
+	input, err := json.Marshal(run.Input)
+	if err != nil {
+		return 0, fmt.Errorf("marshal sync run input: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO sync_runs(workflow_id, run_id, site_id, reason, input, status, inserted, skipped, pages, started_at, completed_at, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.WorkflowID, run.RunID, run.SiteID, run.Reason, string(input), run.Status,
+		run.Inserted, run.Skipped, run.Pages, run.StartedAt.UTC(), run.CompletedAt.UTC(), nullIfEmpty(run.Error),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("record sync run: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetSyncRun loads one recorded sync run. Returns sql.ErrNoRows when id does not exist.
+func (s *Store) GetSyncRun(ctx context.Context, id int64) (SyncRun, error) {
+	var run SyncRun
+	var input string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, workflow_id, run_id, site_id, reason, input, status, inserted, skipped, pages, started_at, completed_at, COALESCE(error, '')
+		 FROM sync_runs WHERE id = ?`, id).Scan(&run.ID, &run.WorkflowID, &run.RunID, &run.SiteID, &run.Reason, &input, &run.Status,
+		&run.Inserted, &run.Skipped, &run.Pages, &run.StartedAt, &run.CompletedAt, &run.Error)
+	if err != nil {
+		return SyncRun{}, err
+	}
+	if err := json.Unmarshal([]byte(input), &run.Input); err != nil {
+		return SyncRun{}, fmt.Errorf("decode sync run input: %w", err)
+	}
+	return run, nil
+}
+
+// ListSyncRuns pages through sync history newest first using a (started_at, id) keyset, so deep
+// pages cost the same as the first one.
+func (s *Store) ListSyncRuns(ctx context.Context, filter SyncRunFilter) (SyncRunPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultSyncRunLimit
+	}
+	if limit > MaxSyncRunLimit {
+		limit = MaxSyncRunLimit
+	}
+	var clauses []string
+	var args []any
+	if siteID := strings.TrimSpace(filter.SiteID); siteID != "" {
+		clauses = append(clauses, s.siteIDMatch())
+		args = append(args, siteID)
+	}
+	if filter.Status != "" {
+		clauses = append(clauses, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Before != "" {
+		startedAt, id, err := decodeSyncRunCursor(filter.Before)
+		if err != nil {
+			return SyncRunPage{}, err
+		}
+		clauses = append(clauses, "(started_at < ? OR (started_at = ? AND id < ?))")
+		args = append(args, startedAt, startedAt, id)
+	}
+	query := `SELECT id, workflow_id, run_id, site_id, reason, input, status, inserted, skipped, pages, started_at, completed_at, COALESCE(error, '')
+		FROM sync_runs`
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	query += ` ORDER BY started_at DESC, id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return SyncRunPage{}, fmt.Errorf("list sync runs: %w", err)
+	}
+	defer rows.Close()
+	runs := make([]SyncRun, 0, limit)
+	for rows.Next() {
+		var run SyncRun
+		var input string
+		if err := rows.Scan(&run.ID, &run.WorkflowID, &run.RunID, &run.SiteID, &run.Reason, &input, &run.Status,
+			&run.Inserted, &run.Skipped, &run.Pages, &run.StartedAt, &run.CompletedAt, &run.Error); err != nil {
+			return SyncRunPage{}, fmt.Errorf("scan sync run: %w", err)
+		}
+		if err := json.Unmarshal([]byte(input), &run.Input); err != nil {
+			return SyncRunPage{}, fmt.Errorf("decode sync run input: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return SyncRunPage{}, fmt.Errorf("iter sync runs: %w", err)
+	}
+
+	page := SyncRunPage{Runs: runs}
+	if len(runs) > limit {
+		page.Runs = runs[:limit]
+		last := page.Runs[limit-1]
+		page.NextCursor = encodeSyncRunCursor(last.StartedAt, last.ID)
+	}
+	return page, nil
+}
+
+// MaxRecentRunsPerSite bounds RecentRunsPerSite's n.
+const MaxRecentRunsPerSite = 50
+
+// RecentRunsPerSite returns the n most recent sync runs of every site that has any, newest
+// first, in one windowed query over idx_sync_runs_site_started.
+func (s *Store) RecentRunsPerSite(ctx context.Context, n int) (map[string][]SyncRun, error) {
+	if n <= 0 {
+		n = 1
+	}
+	if n > MaxRecentRunsPerSite {
+		n = MaxRecentRunsPerSite
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, workflow_id, run_id, site_id, reason, input, status, inserted, skipped, pages, started_at, completed_at, error
+		 FROM (
+			SELECT id, workflow_id, run_id, site_id, reason, input, status, inserted, skipped, pages, started_at, completed_at,
+				COALESCE(error, '') AS error,
+				ROW_NUMBER() OVER (PARTITION BY site_id ORDER BY started_at DESC, id DESC) AS rn
+			FROM sync_runs
+		 ) WHERE rn <= ?
+		 ORDER BY site_id, started_at DESC, id DESC`, n)
+	if err != nil {
+		return nil, fmt.Errorf("recent runs per site: %w", err)
+	}
+	defer rows.Close()
+	runs := map[string][]SyncRun{}
+	for rows.Next() {
+		var run SyncRun
+		var input string
+		if err := rows.Scan(&run.ID, &run.WorkflowID, &run.RunID, &run.SiteID, &run.Reason, &input, &run.Status,
+			&run.Inserted, &run.Skipped, &run.Pages, &run.StartedAt, &run.CompletedAt, &run.Error); err != nil {
+			return nil, fmt.Errorf("scan sync run: %w", err)
+		}
+		if err := json.Unmarshal([]byte(input), &run.Input); err != nil {
+			return nil, fmt.Errorf("decode sync run input: %w", err)
+		}
+		runs[run.SiteID] = append(runs[run.SiteID], run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter sync runs: %w", err)
+	}
+	return runs, nil
+}
+
+func encodeSyncRunCursor(startedAt time.Time, id int64) string {
+	raw := fmt.Sprintf("%d:%d", startedAt.UTC().UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSyncRunCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	runID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, n).UTC(), runID, nil
+}
+
+// ConversionLatencies returns, for every user in a site with both a signup event and a later
+// order_created event, the time from signup to their first order. Users without orders are
+// omitted. start and end filter on the signup timestamp.
+func (s *Store) ConversionLatencies(ctx context.Context, siteID string, start, end *time.Time) ([]time.Duration, error) {
+	clauses := []string{"s.site_id = ?", "s.event_name = 'signup'"}
+	args := []any{siteID}
+	if start != nil {
+		clauses = append(clauses, "s.timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "s.timestamp <= ?")
+		args = append(args, end.UTC())
+	}
+	query := fmt.Sprintf(`SELECT s.timestamp, o.timestamp FROM events s
+		JOIN events o ON o.id = (
+			SELECT id FROM events
+			WHERE site_id = s.site_id AND user_id = s.user_id AND event_name = 'order_created' AND timestamp >= s.timestamp
+			ORDER BY timestamp, id LIMIT 1
+		)
+		WHERE %s`, strings.Join(clauses, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("conversion latencies: %w", err)
+	}
+	defer rows.Close()
+	var latencies []time.Duration
+	for rows.Next() {
+		var signupAt, orderAt time.Time
+		if err := rows.Scan(&signupAt, &orderAt); err != nil {
+			return nil, fmt.Errorf("scan conversion latency: %w", err)
+		}
+		latencies = append(latencies, orderAt.Sub(signupAt))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter conversion latencies: %w", err)
+	}
+	return latencies, nil
+}
+
+// RevenueByCurrency sums the total_amount of a site's order_created events per currency,
+// ordered by currency code. start and end filter on the order timestamp.
+func (s *Store) RevenueByCurrency(ctx context.Context, siteID string, start, end *time.Time) ([]CurrencyRevenue, error) {
+	clauses := []string{"site_id = ?", "event_name = 'order_created'"}
+	args := []any{siteID}
+	if start != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, end.UTC())
+	}
+	query := fmt.Sprintf(`SELECT UPPER(COALESCE(json_extract(properties, '$.currency'), '')) AS currency,
+			COUNT(*), COALESCE(SUM(json_extract(properties, '$.total_amount')), 0)
+		FROM events WHERE %s GROUP BY currency ORDER BY currency`, strings.Join(clauses, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("revenue by currency: %w", err)
+	}
+	defer rows.Close()
+	revenue := []CurrencyRevenue{}
+	for rows.Next() {
+		var r CurrencyRevenue
+		if err := rows.Scan(&r.Currency, &r.Orders, &r.Total); err != nil {
+			return nil, fmt.Errorf("scan revenue: %w", err)
+		}
+		revenue = append(revenue, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter revenue: %w", err)
+	}
+	return revenue, nil
+}
+
+// RevenueByAttribution sums total_amount of a site's order_created events per utm_source and
+// currency, ordered by source then currency. start and end filter on the event timestamp.
+// Amounts in different currencies stay in separate rows.
+func (s *Store) RevenueByAttribution(ctx context.Context, siteID string, start, end *time.Time) ([]SourceRevenue, error) {
+	clauses := []string{"site_id = ?", "event_name = 'order_created'"}
+	args := []any{siteID}
+	if start != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, end.UTC())
+	}
+	query := fmt.Sprintf(`SELECT COALESCE(utm_source, '') AS source,
+			UPPER(COALESCE(json_extract(properties, '$.currency'), '')) AS currency,
+			COUNT(*), COALESCE(SUM(json_extract(properties, '$.total_amount')), 0)
+		FROM events WHERE %s GROUP BY source, currency ORDER BY source, currency`, strings.Join(clauses, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("revenue by attribution: %w", err)
+	}
+	defer rows.Close()
+	revenue := []SourceRevenue{}
+	for rows.Next() {
+		var r SourceRevenue
+		if err := rows.Scan(&r.Source, &r.Currency, &r.Orders, &r.TotalAmount); err != nil {
+			return nil, fmt.Errorf("scan revenue: %w", err)
+		}
+		revenue = append(revenue, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter revenue: %w", err)
+	}
+	return revenue, nil
+}
+
+// AttributionCoverage counts a site's signup and order_created events and how many of them have
+// a non-empty utm_source, per event name. start and end filter on the event timestamp. Coverage
+// is the attributed fraction, 0 when there are no events.
+func (s *Store) AttributionCoverage(ctx context.Context, siteID string, start, end *time.Time) (AttributionCoverage, error) {
+	clauses := []string{"site_id = ?", "event_name IN ('signup', 'order_created')"}
+	args := []any{siteID}
+	if start != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, end.UTC())
+	}
+	query := fmt.Sprintf(`SELECT event_name, COUNT(*),
+			SUM(CASE WHEN utm_source IS NOT NULL AND utm_source != '' THEN 1 ELSE 0 END)
+		FROM events WHERE %s GROUP BY event_name ORDER BY event_name`, strings.Join(clauses, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return AttributionCoverage{}, fmt.Errorf("attribution coverage: %w", err)
+	}
+	defer rows.Close()
+	report := AttributionCoverage{SiteID: siteID, ByEvent: []EventCoverage{}}
+	for rows.Next() {
+		var c EventCoverage
+		if err := rows.Scan(&c.EventName, &c.Total, &c.Attributed); err != nil {
+			return AttributionCoverage{}, fmt.Errorf("scan attribution coverage: %w", err)
+		}
+		c.Coverage = coverageRatio(c.Attributed, c.Total)
+		report.Total += c.Total
+		report.Attributed += c.Attributed
+		report.ByEvent = append(report.ByEvent, c)
+	}
+	if err := rows.Err(); err != nil {
+		return AttributionCoverage{}, fmt.Errorf("iter attribution coverage: %w", err)
+	}
+	report.Coverage = coverageRatio(report.Attributed, report.Total)
+	return report, nil
+}
+
+// DistinctUsers counts the distinct user_id values in a site's events. start and end filter on
+// the event timestamp, so a 30-day window gives MAU and a 1-day window DAU.
+func (s *Store) DistinctUsers(ctx context.Context, siteID string, start, end *time.Time) (int, error) {
+	clauses := []string{"site_id = ?"}
+	args := []any{siteID}
+	if start != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if end != nil {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, end.UTC())
+	}
+	var n int
+	query := fmt.Sprintf(`SELECT COUNT(DISTINCT user_id) FROM events WHERE %s`, strings.Join(clauses, " AND "))
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("distinct users: %w", err)
+	}
+	return n, nil
+}
+
+// DefaultOrderAttributionLimit and MaxOrderAttributionLimit bound OrdersWithAttribution pages.
+const (
+	DefaultOrderAttributionLimit = 100
+	MaxOrderAttributionLimit     = 1000
+)
+
+// OrdersWithAttribution returns up to limit of a site's order_created events with id greater
+// than afterID, each joined in the same query with its user's utm_source under model (first or
+// last touch). Users without any touch get an empty utm_source. The second return value is the
+// afterID for the next page (afterID itself when nothing is left).
+func (s *Store) OrdersWithAttribution(ctx context.Context, siteID, model string, afterID int64, limit int) ([]OrderAttribution, int64, error) {
+	if limit <= 0 {
+		limit = DefaultOrderAttributionLimit
+	}
+	if limit > MaxOrderAttributionLimit {
+		limit = MaxOrderAttributionLimit
+	}
+	order := "DESC"
+	if model == AttributionModelFirst {
+		order = "ASC"
+	}
+	query := fmt.Sprintf(`SELECT o.id, o.user_id,
+			COALESCE(json_extract(o.properties, '$.order_id'), ''),
+			COALESCE(json_extract(o.properties, '$.total_amount'), 0),
+			COALESCE(json_extract(o.properties, '$.currency'), ''),
+			COALESCE(a.utm_source, '')
+		FROM events o
+		LEFT JOIN (
+			SELECT user_id, utm_source,
+				ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY timestamp %[1]s, id %[1]s) AS rn
+			FROM events WHERE site_id = ? AND utm_source IS NOT NULL AND utm_source != ''
+		) a ON a.user_id = o.user_id AND a.rn = 1
+		WHERE o.site_id = ? AND o.event_name = 'order_created' AND o.id > ?
+		ORDER BY o.id LIMIT ?`, order)
+	rows, err := s.db.QueryContext(ctx, query, siteID, siteID, afterID, limit)
+	if err != nil {
+		return nil, afterID, fmt.Errorf("orders with attribution: %w", err)
+	}
+	defer rows.Close()
+	orders := []OrderAttribution{}
+	for rows.Next() {
+		var o OrderAttribution
+		if err := rows.Scan(&o.EventID, &o.UserID, &o.OrderID, &o.TotalAmount, &o.Currency, &o.UTMSource); err != nil {
+			return nil, afterID, fmt.Errorf("scan order attribution: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, afterID, fmt.Errorf("iter orders with attribution: %w", err)
+	}
+	next := afterID
+	if len(orders) > 0 {
+		next = orders[len(orders)-1].EventID
+	}
+	return orders, next, nil
+}
+
+func coverageRatio(attributed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(attributed) / float64(total)
+}
+
 // InsertEvent stores an event unless a duplicate already exists. Returns true when inserted.
 func (s *Store) InsertEvent(ctx context.Context, event Event) (bool, error) {
 	props, err := json.Marshal(event.Properties)
 	if err != nil {
 		return false, fmt.Errorf("marshal properties: %w", err)
 	}
+	if s.maxPropertiesBytes > 0 && len(props) > s.maxPropertiesBytes {
+		return false, fmt.Errorf("%w: %d bytes (max %d)", ErrPropertiesTooLarge, len(props), s.maxPropertiesBytes)
+	}
 	var metadata []byte
 	if len(event.Metadata) > 0 {
 		metadata, err = json.Marshal(event.Metadata)
@@ -135,9 +947,9 @@ func (s *Store) InsertEvent(ctx context.Context, event Event) (bool, error) {
 	}
 
 	res, err := s.db.ExecContext(ctx,
-		`INSERT INTO events(site_id, timestamp, user_id, event_name, utm_source, properties, dedupe_key, ingested_at, metadata)
-		 VALUES(?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?)
-		 ON CONFLICT(dedupe_key) DO NOTHING`,
+		`INSERT INTO events(site_id, timestamp, user_id, event_name, utm_source, properties, dedupe_key, ingested_at, metadata, dedupe_scope)
+		 VALUES(?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?, ?)
+		 ON CONFLICT(site_id, dedupe_key, dedupe_scope) DO NOTHING`,
 		event.SiteID,
 		event.Timestamp.UTC(),
 		event.UserID,
@@ -147,6 +959,7 @@ func (s *Store) InsertEvent(ctx context.Context, event Event) (bool, error) {
 		event.DedupeKey,
 		utcOrNil(event.IngestedAt),
 		bytesOrNil(metadata),
+		s.dedupeScopeValue(event),
 	)
 	if err != nil {
 		return false, fmt.Errorf("insert event: %w", err)
@@ -176,28 +989,254 @@ func bytesOrNil(b []byte) any {
 	return string(b)
 }
 
-// LatestAttribution returns the most recent non-empty utm_source for a user.
-func (s *Store) LatestAttribution(ctx context.Context, userID string) (string, bool, error) {
-	var utm sql.NullString
+// AttributionQuery selects which of a user's utm_source touches on one site an attribution may
+// come from. The zero bounds mean every touch the user has there, which is what the sync uses.
+type AttributionQuery struct {
+	SiteID string
+	UserID string
+	// Model picks the latest (AttributionModelLast) or earliest (AttributionModelFirst) touch.
+	Model string
+	// AsOf, when non-zero, ignores touches after it.
+	AsOf time.Time
+	// Window, when positive, ignores touches more than Window before AsOf, or before now when
+	// AsOf is zero.
+	Window time.Duration
+}
+
+// ResolveAttribution returns the utm_source touch q selects along with the event it came from.
+// The sync, backfill, and attribution preview all resolve through it.
+func (s *Store) ResolveAttribution(ctx context.Context, q AttributionQuery) (Attribution, bool, error) {
+	where := `site_id = ? AND user_id = ? AND utm_source IS NOT NULL AND utm_source != ''`
+	args := []any{q.SiteID, q.UserID}
+	if !q.AsOf.IsZero() {
+		where += ` AND timestamp <= ?`
+		args = append(args, q.AsOf.UTC())
+	}
+	if q.Window > 0 {
+		ref := q.AsOf
+		if ref.IsZero() {
+			ref = time.Now()
+		}
+		where += ` AND timestamp >= ?`
+		args = append(args, ref.Add(-q.Window).UTC())
+	}
+	attr := Attribution{Model: AttributionModelLast}
+	order := `timestamp DESC, id DESC`
+	if q.Model == AttributionModelFirst {
+		attr.Model = AttributionModelFirst
+		order = `timestamp ASC, id ASC`
+	}
 	err := s.db.QueryRowContext(ctx,
-		`SELECT utm_source FROM events WHERE user_id = ? AND utm_source IS NOT NULL AND utm_source != '' 
-		 ORDER BY timestamp DESC, id DESC LIMIT 1`, userID).Scan(&utm)
+		`SELECT id, utm_source FROM events WHERE `+where+` ORDER BY `+order+` LIMIT 1`, args...).
+		Scan(&attr.SourceEventID, &attr.Source)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", false, nil
+			return Attribution{}, false, nil
+		}
+		return Attribution{}, false, fmt.Errorf("resolve %s attribution: %w", attr.Model, err)
+	}
+	return attr, true, nil
+}
+
+// LatestAttribution returns the most recent non-empty utm_source for a user on siteID along with
+// the event it came from. Seeded user IDs can repeat across sites, so touches on other sites
+// never count.
+func (s *Store) LatestAttribution(ctx context.Context, siteID, userID string) (Attribution, bool, error) {
+	return s.ResolveAttribution(ctx, AttributionQuery{SiteID: siteID, UserID: userID, Model: AttributionModelLast})
+}
+
+// FirstAttribution returns the earliest non-empty utm_source for a user on siteID along with the
+// event it came from.
+func (s *Store) FirstAttribution(ctx context.Context, siteID, userID string) (Attribution, bool, error) {
+	return s.ResolveAttribution(ctx, AttributionQuery{SiteID: siteID, UserID: userID, Model: AttributionModelFirst})
+}
+
+// AttributionAsOf returns the user's most recent non-empty utm_source on siteID at or before
+// asOf, so historical events can be attributed as they would have been at the time.
+func (s *Store) AttributionAsOf(ctx context.Context, siteID, userID string, asOf time.Time) (Attribution, bool, error) {
+	return s.ResolveAttribution(ctx, AttributionQuery{SiteID: siteID, UserID: userID, Model: AttributionModelLast, AsOf: asOf})
+}
+
+// AttributionPath returns the user's non-empty utm_source touches on siteID at or before before,
+// oldest first, with consecutive repeats of the same source collapsed into one. A source the
+// user came back to after another one appears again.
+func (s *Store) AttributionPath(ctx context.Context, siteID, userID string, before time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT utm_source FROM events
+		 WHERE site_id = ? AND user_id = ? AND utm_source IS NOT NULL AND utm_source != '' AND timestamp <= ?
+		 ORDER BY timestamp ASC, id ASC`, siteID, userID, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("attribution path: %w", err)
+	}
+	defer rows.Close()
+	var path []string
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, fmt.Errorf("scan attribution path: %w", err)
+		}
+		if len(path) == 0 || path[len(path)-1] != source {
+			path = append(path, source)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter attribution path: %w", err)
+	}
+	return path, nil
+}
+
+// BackfillResult reports a BackfillAttribution pass.
+type BackfillResult struct {
+	Candidates int `json:"candidates"`
+	Backfilled int `json:"backfilled"`
+	StillEmpty int `json:"still_empty"`
+	// Conflicts counts events left empty because, under DedupeScopeSource, an event with the
+	// same dedupe_key is already stored for the source they would be attributed to.
+	Conflicts int `json:"conflicts"`
+}
+
+// BackfillAttribution fills utm_source on a site's signup and order_created events that have
+// none, using the attribution in effect at each event's timestamp. Events that already carry a
+// utm_source are never touched, and neither are events named in suppressed. dedupe_scope is
+// rescoped in the same update, and an event whose new scope would collide with a stored
+// duplicate is skipped, so idx_events_site_dedupe and migrateDedupeScope keep holding.
+func (s *Store) BackfillAttribution(ctx context.Context, siteID string, suppressed []string) (BackfillResult, error) {
+	type candidate struct {
+		id        int64
+		userID    string
+		timestamp time.Time
+		dedupeKey string
+		metadata  sql.NullString
+	}
+	where := `site_id = ? AND event_name IN ('signup', 'order_created') AND (utm_source IS NULL OR utm_source = '')`
+	args := []any{siteID}
+	if len(suppressed) > 0 {
+		where += fmt.Sprintf(` AND event_name NOT IN (%s)`, strings.TrimSuffix(strings.Repeat("?,", len(suppressed)), ","))
+		for _, name := range suppressed {
+			args = append(args, name)
+		}
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, timestamp, dedupe_key, metadata FROM events WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return BackfillResult{}, fmt.Errorf("find unattributed events: %w", err)
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.userID, &c.timestamp, &c.dedupeKey, &c.metadata); err != nil {
+			rows.Close()
+			return BackfillResult{}, fmt.Errorf("scan unattributed event: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return BackfillResult{}, fmt.Errorf("iter unattributed events: %w", err)
+	}
+
+	result := BackfillResult{Candidates: len(candidates)}
+	for _, c := range candidates {
+		attr, ok, err := s.AttributionAsOf(ctx, siteID, c.userID, c.timestamp)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			result.StillEmpty++
+			continue
+		}
+		metadata := map[string]interface{}{}
+		if c.metadata.Valid {
+			if err := json.Unmarshal([]byte(c.metadata.String), &metadata); err != nil {
+				return result, fmt.Errorf("decode metadata of event %d: %w", c.id, err)
+			}
+		}
+		for k, v := range attr.Metadata() {
+			metadata[k] = v
+		}
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return result, fmt.Errorf("marshal metadata: %w", err)
+		}
+		scope := s.dedupeScopeValue(Event{UTMSource: attr.Source})
+		var conflict bool
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM events WHERE site_id = ? AND dedupe_key = ? AND dedupe_scope = ? AND id != ?)`,
+			siteID, c.dedupeKey, scope, c.id,
+		).Scan(&conflict); err != nil {
+			return result, fmt.Errorf("check dedupe conflict for event %d: %w", c.id, err)
+		}
+		if conflict {
+			result.Conflicts++
+			continue
+		}
+		// The utm_source guard keeps a concurrent sync's attribution from being overwritten.
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE events SET utm_source = ?, metadata = ?, dedupe_scope = ? WHERE id = ? AND (utm_source IS NULL OR utm_source = '')`,
+			attr.Source, string(encoded), scope, c.id)
+		if err != nil {
+			return result, fmt.Errorf("backfill event %d: %w", c.id, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Backfilled++
 		}
-		return "", false, fmt.Errorf("latest attribution: %w", err)
 	}
-	return utm.String, utm.Valid, nil
+	return result, nil
 }
 
+// IterateAttribution calls fn with one utm_source per user in a site, chosen by model (first or
+// last touch). When since is set only touches at or after it are considered. Rows are streamed
+// from the cursor so large sites are never buffered.
+func (s *Store) IterateAttribution(ctx context.Context, siteID, model string, since *time.Time, fn func(userID, utmSource string) error) error {
+	order := "DESC"
+	if model == AttributionModelFirst {
+		order = "ASC"
+	}
+	clauses := []string{"site_id = ?", "utm_source IS NOT NULL", "utm_source != ''"}
+	args := []any{siteID}
+	if since != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, since.UTC())
+	}
+	query := fmt.Sprintf(`SELECT user_id, utm_source FROM (
+			SELECT user_id, utm_source,
+				ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY timestamp %[1]s, id %[1]s) AS rn
+			FROM events WHERE %[2]s
+		) WHERE rn = 1 ORDER BY user_id`, order, strings.Join(clauses, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query attribution: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID, utm string
+		if err := rows.Scan(&userID, &utm); err != nil {
+			return fmt.Errorf("scan attribution: %w", err)
+		}
+		if err := fn(userID, utm); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iter attribution: %w", err)
+	}
+	return nil
+}
+
+// maxRandomDedupeAttempts bounds how many seed keys InsertRandomAttribution draws.
+const maxRandomDedupeAttempts = 3
+
+// ErrRandomDedupeCollision is returned when every seed key InsertRandomAttribution drew was
+// already taken, which points at a broken ID generator rather than bad input.
+var ErrRandomDedupeCollision = errors.New("random event dedupe key kept colliding")
+
 // InsertRandomAttribution seeds arbitrary browser events used to back-fill utm_source values.
 func (s *Store) InsertRandomAttribution(ctx context.Context, req RandomEventRequest) (Event, error) {
 	if strings.TrimSpace(req.SiteID) == "" {
 		return Event{}, errors.New("site_id required")
 	}
 	if req.UserID == "" {
-		req.UserID = uuid.NewString()
+		req.UserID = s.ids.NewID()
 	}
 	eventName := req.EventName
 	if eventName == "" {
@@ -207,48 +1246,91 @@ func (s *Store) InsertRandomAttribution(ctx context.Context, req RandomEventRequ
 	if utm == "" {
 		utm = randomUTM()
 	}
+	props := map[string]any{
+		"session_id": s.ids.NewID(),
+		"page":       "/landing",
+		"referrer":   "https://example.io",
+	}
+	for k, v := range req.Properties {
+		props[k] = v
+	}
+	if req.Page != "" {
+		props["page"] = req.Page
+	}
+	if req.Referrer != "" {
+		props["referrer"] = req.Referrer
+	}
 	now := time.Now().UTC()
 	event := Event{
-		SiteID:    req.SiteID,
-		Timestamp: now,
-		UserID:    req.UserID,
-		EventName: eventName,
-		UTMSource: utm,
-		Properties: map[string]any{
-			"session_id": uuid.NewString(),
-			"page":       "/landing",
-			"referrer":   "https://example.io",
-		},
-		DedupeKey:  fmt.Sprintf("seed:%s", uuid.NewString()),
+		SiteID:     req.SiteID,
+		Timestamp:  now,
+		UserID:     req.UserID,
+		EventName:  eventName,
+		UTMSource:  utm,
+		Properties: props,
 		IngestedAt: now,
 	}
-	inserted, err := s.InsertEvent(ctx, event)
-	if err != nil {
-		return Event{}, err
-	}
-	if !inserted {
-		return Event{}, errors.New("duplicate random event unexpectedly skipped")
+	// A seed:<id> key only collides if the generator repeats itself; draw a fresh one rather
+	// than failing the request.
+	for attempt := 0; attempt < maxRandomDedupeAttempts; attempt++ {
+		event.DedupeKey = fmt.Sprintf("seed:%s", s.ids.NewID())
+		inserted, err := s.InsertEvent(ctx, event)
+		if err != nil {
+			return Event{}, err
+		}
+		if inserted {
+			return event, nil
+		}
 	}
-	return event, nil
+	return Event{}, fmt.Errorf("%w after %d attempts", ErrRandomDedupeCollision, maxRandomDedupeAttempts)
 }
 
-// ListEvents returns events filtered by user or site for debugging.
-func (s *Store) ListEvents(ctx context.Context, siteID, userID string, limit int) ([]Event, error) {
+// MaxListEventsUserIDs caps how many user IDs a single ListEvents call may filter on.
+const MaxListEventsUserIDs = 50
+
+// ErrTooManyUserIDs is returned by ListEvents when more than MaxListEventsUserIDs are given.
+var ErrTooManyUserIDs = fmt.Errorf("at most %d user_id values are allowed", MaxListEventsUserIDs)
+
+// ListEvents returns events filtered by site and, when userIDs is non-empty, by any of those
+// users for debugging.
+func (s *Store) ListEvents(ctx context.Context, siteID string, userIDs []string, window EventTimeRange, limit int) ([]Event, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 50
 	}
+	if len(userIDs) > MaxListEventsUserIDs {
+		return nil, ErrTooManyUserIDs
+	}
 	args := []any{}
 	clauses := []string{"1 = 1"}
 	if siteID != "" {
 		clauses = append(clauses, "site_id = ?")
 		args = append(args, siteID)
 	}
-	if userID != "" {
-		clauses = append(clauses, "user_id = ?")
-		args = append(args, userID)
+	if len(userIDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")
+		clauses = append(clauses, fmt.Sprintf("user_id IN (%s)", placeholders))
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+	if window.Start != nil {
+		op := ">"
+		if window.StartInclusive {
+			op = ">="
+		}
+		clauses = append(clauses, "timestamp "+op+" ?")
+		args = append(args, window.Start.UTC())
+	}
+	if window.End != nil {
+		op := "<"
+		if window.EndInclusive {
+			op = "<="
+		}
+		clauses = append(clauses, "timestamp "+op+" ?")
+		args = append(args, window.End.UTC())
 	}
-	query := fmt.Sprintf(`SELECT id, site_id, timestamp, user_id, event_name, utm_source, properties, dedupe_key, ingested_at, metadata 
-		FROM events WHERE %s ORDER BY timestamp DESC, id DESC LIMIT ?`, strings.Join(clauses, " AND "))
+	query := fmt.Sprintf(`SELECT %s FROM events WHERE %s ORDER BY timestamp DESC, id DESC LIMIT ?`,
+		eventColumns, strings.Join(clauses, " AND "))
 	args = append(args, limit)
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
@@ -256,36 +1338,75 @@ func (s *Store) ListEvents(ctx context.Context, siteID, userID string, limit int
 		return nil, fmt.Errorf("list events: %w", err)
 	}
 	defer rows.Close()
+	return scanEvents(rows)
+}
 
+// GetEventByDedupeKey returns the stored event that an insert on siteID with dedupeKey and
+// utmSource would collide with under the configured dedupe scope. utmSource only matters for
+// DedupeScopeSource.
+func (s *Store) GetEventByDedupeKey(ctx context.Context, siteID, dedupeKey, utmSource string) (Event, bool, error) {
+	scope := s.dedupeScopeValue(Event{UTMSource: utmSource})
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT %s FROM events WHERE site_id = ? AND dedupe_key = ? AND dedupe_scope = ? LIMIT 1`, eventColumns),
+		siteID, dedupeKey, scope)
+	if err != nil {
+		return Event{}, false, fmt.Errorf("get event by dedupe key: %w", err)
+	}
+	defer rows.Close()
+	events, err := scanEvents(rows)
+	if err != nil {
+		return Event{}, false, err
+	}
+	if len(events) == 0 {
+		return Event{}, false, nil
+	}
+	return events[0], true, nil
+}
+
+// DefaultCDCLimit and MaxCDCLimit bound EventsSinceID batches.
+const (
+	DefaultCDCLimit = 100
+	MaxCDCLimit     = 1000
+)
+
+// EventsSinceID returns up to limit events with id greater than afterID in id order, plus the
+// id to pass as afterID next time (afterID itself when nothing new exists). It walks the
+// primary key, so tailing consumers never rescan older rows.
+func (s *Store) EventsSinceID(ctx context.Context, afterID int64, limit int) ([]Event, int64, error) {
+	if limit <= 0 {
+		limit = DefaultCDCLimit
+	}
+	if limit > MaxCDCLimit {
+		limit = MaxCDCLimit
+	}
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT %s FROM events WHERE id > ? ORDER BY id LIMIT ?`, eventColumns),
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, afterID, fmt.Errorf("events since id: %w", err)
+	}
+	defer rows.Close()
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, afterID, err
+	}
+	maxID := afterID
+	if len(events) > 0 {
+		maxID = events[len(events)-1].ID
+	}
+	return events, maxID, nil
+}
+
+// eventColumns is the column list scanEvents expects.
+const eventColumns = `id, site_id, timestamp, user_id, event_name, utm_source, properties, dedupe_key, ingested_at, metadata`
+
+func scanEvents(rows *sql.Rows) ([]Event, error) {
 	var events []Event
 	for rows.Next() {
-		var (
-			e         Event
-			propsJSON string
-			metaJSON  sql.NullString
-		)
-		if err := rows.Scan(
-			&e.ID,
-			&e.SiteID,
-			&e.Timestamp,
-			&e.UserID,
-			&e.EventName,
-			&e.UTMSource,
-			&propsJSON,
-			&e.DedupeKey,
-			&e.IngestedAt,
-			&metaJSON,
-		); err != nil {
-			return nil, fmt.Errorf("scan event: %w", err)
-		}
-		if err := json.Unmarshal([]byte(propsJSON), &e.Properties); err != nil {
-			return nil, fmt.Errorf("decode properties: %w", err)
-		}
-		if metaJSON.Valid {
-			var m map[string]any
-			if err := json.Unmarshal([]byte(metaJSON.String), &m); err == nil {
-				e.Metadata = m
-			}
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
 		}
 		events = append(events, e)
 	}
@@ -295,6 +1416,123 @@ func (s *Store) ListEvents(ctx context.Context, siteID, userID string, limit int
 	return events, nil
 }
 
+// newPropertiesDecoder returns a decoder that keeps numbers inside untyped values as
+// json.Number. Event properties are free-form maps, and decoding them to float64 would round
+// integers above 2^53, such as large KRW order totals.
+func newPropertiesDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec
+}
+
+// scanEvent reads one row selected with eventColumns. extra receives any columns selected after
+// them. Properties that are not valid JSON come back as an empty map with the stored text in
+// RawProperties rather than failing the scan.
+func scanEvent(row rowScanner, extra ...any) (Event, error) {
+	var (
+		e         Event
+		utm       sql.NullString
+		propsJSON string
+		metaJSON  sql.NullString
+	)
+	dest := append([]any{
+		&e.ID,
+		&e.SiteID,
+		&e.Timestamp,
+		&e.UserID,
+		&e.EventName,
+		&utm,
+		&propsJSON,
+		&e.DedupeKey,
+		&e.IngestedAt,
+		&metaJSON,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return Event{}, fmt.Errorf("scan event: %w", err)
+	}
+	e.UTMSource = utm.String
+	if err := newPropertiesDecoder(strings.NewReader(propsJSON)).Decode(&e.Properties); err != nil {
+		e.Properties = map[string]any{}
+		e.RawProperties = propsJSON
+	}
+	if metaJSON.Valid {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(metaJSON.String), &m); err == nil {
+			e.Metadata = m
+		}
+	}
+	return e, nil
+}
+
+// EventSiteIDs returns every distinct site_id present in the events table, including
+// sites that have since been unregistered.
+func (s *Store) EventSiteIDs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT site_id FROM events ORDER BY site_id`)
+	if err != nil {
+		return nil, fmt.Errorf("list event sites: %w", err)
+	}
+	defer rows.Close()
+	var siteIDs []string
+	for rows.Next() {
+		var siteID string
+		if err := rows.Scan(&siteID); err != nil {
+			return nil, fmt.Errorf("scan event site: %w", err)
+		}
+		siteIDs = append(siteIDs, siteID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter event sites: %w", err)
+	}
+	return siteIDs, nil
+}
+
+// UserSiteIDs returns every distinct site_id that has events for userID.
+func (s *Store) UserSiteIDs(ctx context.Context, userID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT site_id FROM events WHERE user_id = ? ORDER BY site_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list user sites: %w", err)
+	}
+	defer rows.Close()
+	siteIDs := []string{}
+	for rows.Next() {
+		var siteID string
+		if err := rows.Scan(&siteID); err != nil {
+			return nil, fmt.Errorf("scan user site: %w", err)
+		}
+		siteIDs = append(siteIDs, siteID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iter user sites: %w", err)
+	}
+	return siteIDs, nil
+}
+
+// PurgeEventsBefore deletes a site's events older than cutoff. The earliest and latest
+// utm_source touch per user are always kept so both first- and last-touch attribution survive
+// the purge. Returns the number of rows removed.
+func (s *Store) PurgeEventsBefore(ctx context.Context, siteID string, cutoff time.Time) (int64, error) {
+	siteID = strings.TrimSpace(siteID)
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM events
+		 WHERE `+s.siteIDMatch()+` AND timestamp < ?
+		   AND id NOT IN (
+			SELECT id FROM (
+				SELECT id,
+					ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY timestamp DESC, id DESC) AS rn_desc,
+					ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY timestamp ASC, id ASC) AS rn_asc
+				FROM events
+				WHERE `+s.siteIDMatch()+` AND utm_source IS NOT NULL AND utm_source != ''
+			) WHERE rn_desc = 1 OR rn_asc = 1
+		   )`,
+		siteID, cutoff.UTC(), siteID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("purge events: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
 var (
 	randomEvents = []string{"page_view", "product_view", "basket_add", "checkout_view"}
 	randomUTMs   = []string{"google", "facebook", "newsletter", "kakao", "direct"}
@@ -0,0 +1,382 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackfillAttributionRescopesAndSkipsConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, WithDedupeScope(DedupeScopeSource))
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, e := range []Event{
+		{SiteID: "s1", Timestamp: t0, UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: "view:u1"},
+		{SiteID: "s1", Timestamp: t0.Add(time.Hour), UserID: "u1", EventName: "signup", DedupeKey: "signup:s1:u1"},
+		// The same signup was already synced with its source, so backfilling the empty copy
+		// would collide with it under the source scope.
+		{SiteID: "s1", Timestamp: t0.Add(time.Hour), UserID: "u1", EventName: "signup", UTMSource: "google", DedupeKey: "signup:s1:u1"},
+		{SiteID: "s1", Timestamp: t0, UserID: "u2", EventName: "page_view", UTMSource: "facebook", DedupeKey: "view:u2"},
+		{SiteID: "s1", Timestamp: t0.Add(time.Hour), UserID: "u2", EventName: "signup", DedupeKey: "signup:s1:u2"},
+		{SiteID: "s1", Timestamp: t0.Add(time.Hour), UserID: "u3", EventName: "signup", DedupeKey: "signup:s1:u3"},
+	} {
+		mustInsert(t, store, e)
+	}
+
+	result, err := store.BackfillAttribution(ctx, "s1", nil)
+	if err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	want := BackfillResult{Candidates: 3, Backfilled: 1, StillEmpty: 1, Conflicts: 1}
+	if result != want {
+		t.Fatalf("backfill = %+v, want %+v", result, want)
+	}
+	var source, scope string
+	if err := store.db.QueryRowContext(ctx,
+		`SELECT utm_source, dedupe_scope FROM events WHERE site_id = 's1' AND dedupe_key = 'signup:s1:u2'`,
+	).Scan(&source, &scope); err != nil {
+		t.Fatalf("load backfilled event: %v", err)
+	}
+	if source != "facebook" || scope != "facebook" {
+		t.Fatalf("backfilled event utm_source %q dedupe_scope %q, want facebook for both", source, scope)
+	}
+	// A restart re-derives every dedupe_scope and must not trip the unique index.
+	if err := NewStore(store.db, WithDedupeScope(DedupeScopeSource)).Init(ctx); err != nil {
+		t.Fatalf("re-init after backfill: %v", err)
+	}
+}
+
+func TestBackfillAttributionReportsCorruptMetadata(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: t0, UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: "view:u1"})
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: t0.Add(time.Hour), UserID: "u1", EventName: "signup", DedupeKey: "signup:s1:u1"})
+	if _, err := store.db.ExecContext(ctx, `UPDATE events SET metadata = '{not json' WHERE dedupe_key = 'signup:s1:u1'`); err != nil {
+		t.Fatalf("corrupt metadata: %v", err)
+	}
+	if _, err := store.BackfillAttribution(ctx, "s1", nil); err == nil {
+		t.Fatal("backfill over corrupt metadata: want error")
+	}
+}
+
+func TestInsertEventCapsPropertiesSize(t *testing.T) {
+	ctx := context.Background()
+	big := map[string]any{"blob": strings.Repeat("x", 100)}
+	capped := newTestStore(t, WithMaxPropertiesBytes(64))
+	if _, err := capped.InsertEvent(ctx, Event{SiteID: "s1", UserID: "u1", EventName: "page_view", DedupeKey: "big", Properties: big}); !errors.Is(err, ErrPropertiesTooLarge) {
+		t.Fatalf("insert over the cap: err %v, want ErrPropertiesTooLarge", err)
+	}
+	mustInsert(t, capped, Event{SiteID: "s1", UserID: "u1", EventName: "page_view", DedupeKey: "small", Properties: map[string]any{"a": 1}})
+
+	uncapped := newTestStore(t, WithMaxPropertiesBytes(0))
+	mustInsert(t, uncapped, Event{SiteID: "s1", UserID: "u1", EventName: "page_view", DedupeKey: "big", Properties: big})
+
+	h := newTestServer(t, capped).Router()
+	body := `{"site_id":"s1","user_id":"u1","event_name":"page_view","properties":{"blob":"` + strings.Repeat("x", 100) + `"}}`
+	if rec := serve(t, h, http.MethodPost, "/worker/events", body, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("manual event over the cap: status %d, want 400", rec.Code)
+	}
+}
+
+func TestSiteIDTrimmingAndCaseFolding(t *testing.T) {
+	ctx := context.Background()
+	site := func(id string) RegisteredSite {
+		return RegisteredSite{SiteID: id, AccessKey: "key", BuilderBaseURL: "http://builder"}
+	}
+
+	exact := newTestStore(t)
+	if err := exact.RegisterSite(ctx, site("  Shop ")); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if got, err := exact.GetSite(ctx, " Shop"); err != nil || got.SiteID != "Shop" {
+		t.Fatalf("get trimmed id = %q, %v; want Shop", got.SiteID, err)
+	}
+	if _, err := exact.GetSite(ctx, "shop"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("get other case without folding: err %v, want sql.ErrNoRows", err)
+	}
+	if err := exact.RegisterSite(ctx, site("shop")); err != nil {
+		t.Fatalf("register other case without folding: %v", err)
+	}
+	// Both spellings are registered, so a folding store must refuse to start on this database.
+	if err := NewStore(exact.db, WithCaseInsensitiveSiteIDs()).Init(ctx); !errors.Is(err, ErrSiteIDConflict) {
+		t.Fatalf("init folding store over case collisions: err %v, want ErrSiteIDConflict", err)
+	}
+
+	folded := newTestStore(t, WithCaseInsensitiveSiteIDs())
+	if err := folded.RegisterSite(ctx, site("Shop")); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if got, err := folded.GetSite(ctx, "SHOP"); err != nil || got.SiteID != "Shop" {
+		t.Fatalf("get folded id = %q, %v; want the stored spelling Shop", got.SiteID, err)
+	}
+	if err := folded.RegisterSite(ctx, site("shop")); !errors.Is(err, ErrSiteIDConflict) {
+		t.Fatalf("register other case with folding: err %v, want ErrSiteIDConflict", err)
+	}
+	if err := folded.RegisterSite(ctx, site("Shop")); err != nil {
+		t.Fatalf("re-register the same spelling: %v", err)
+	}
+}
+
+func TestPerSiteQueriesFoldSiteIDs(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, WithCaseInsensitiveSiteIDs())
+	if err := store.SetFeatureFlag(ctx, FeatureFlag{SiteID: "Shop1", Key: FlagAttributionModel, Value: AttributionModelFirst}); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	if err := store.SetWatermark(ctx, SyncWatermark{SiteID: "Shop1", Entity: changesWatermarkEntity, Seq: 7}); err != nil {
+		t.Fatalf("set watermark: %v", err)
+	}
+	if _, err := store.RecordSyncRun(ctx, SyncRun{WorkflowID: "sync-Shop1", RunID: "r1", SiteID: "Shop1", Status: SyncRunStatusSuccess}); err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	mustInsert(t, store, Event{SiteID: "Shop1", Timestamp: old, UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: "touch"})
+	mustInsert(t, store, Event{SiteID: "Shop1", Timestamp: old.Add(time.Minute), UserID: "u1", EventName: "page_view", DedupeKey: "view"})
+
+	const lookup = " shop1 "
+	if value, ok, err := store.GetFeatureFlag(ctx, lookup, FlagAttributionModel); err != nil || !ok || value != AttributionModelFirst {
+		t.Fatalf("get flag = %q (ok %v, err %v), want first", value, ok, err)
+	}
+	if flags, err := store.ListFeatureFlags(ctx, lookup); err != nil || len(flags) != 1 {
+		t.Fatalf("list flags = %v, %v; want one", flags, err)
+	}
+	if wm, ok, err := store.GetWatermark(ctx, lookup, changesWatermarkEntity); err != nil || !ok || wm.Seq != 7 {
+		t.Fatalf("get watermark = %+v (ok %v, err %v), want seq 7", wm, ok, err)
+	}
+	if wms, err := store.ListWatermarks(ctx, lookup); err != nil || len(wms) != 1 {
+		t.Fatalf("list watermarks = %v, %v; want one", wms, err)
+	}
+	if page, err := store.ListSyncRuns(ctx, SyncRunFilter{SiteID: lookup}); err != nil || len(page.Runs) != 1 {
+		t.Fatalf("list sync runs = %+v, %v; want one", page.Runs, err)
+	}
+	if n, err := store.PurgeEventsBefore(ctx, lookup, time.Now().UTC()); err != nil || n != 1 {
+		t.Fatalf("purge = %d, %v; want the untagged view only", n, err)
+	}
+	if err := store.DeleteFeatureFlag(ctx, lookup, FlagAttributionModel); err != nil {
+		t.Fatalf("delete flag: %v", err)
+	}
+}
+
+func TestAttributionIsScopedToSite(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	// Seeded user IDs repeat across sites; the same u1 touches both.
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: t0, UserID: "u1", EventName: "page_view", UTMSource: "google", DedupeKey: "s1-touch-1"})
+	mustInsert(t, store, Event{SiteID: "s1", Timestamp: t0.Add(time.Hour), UserID: "u1", EventName: "page_view", UTMSource: "newsletter", DedupeKey: "s1-touch-2"})
+	mustInsert(t, store, Event{SiteID: "s2", Timestamp: t0.Add(2 * time.Hour), UserID: "u1", EventName: "page_view", UTMSource: "facebook", DedupeKey: "s2-touch"})
+
+	for name, tc := range map[string]struct {
+		query AttributionQuery
+		want  string
+	}{
+		"s1 last":         {AttributionQuery{SiteID: "s1", UserID: "u1", Model: AttributionModelLast}, "newsletter"},
+		"s1 first":        {AttributionQuery{SiteID: "s1", UserID: "u1", Model: AttributionModelFirst}, "google"},
+		"s1 as of":        {AttributionQuery{SiteID: "s1", UserID: "u1", AsOf: t0.Add(30 * time.Minute)}, "google"},
+		"s2 last":         {AttributionQuery{SiteID: "s2", UserID: "u1"}, "facebook"},
+		"s2 before touch": {AttributionQuery{SiteID: "s2", UserID: "u1", AsOf: t0.Add(time.Hour)}, ""},
+		"other site":      {AttributionQuery{SiteID: "s3", UserID: "u1"}, ""},
+	} {
+		attr, ok, err := store.ResolveAttribution(ctx, tc.query)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ok != (tc.want != "") || attr.Source != tc.want {
+			t.Errorf("%s: source %q (found %v), want %q", name, attr.Source, ok, tc.want)
+		}
+	}
+}
+
+func TestRecordAndListSyncRuns(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, run := range []SyncRun{
+		{SiteID: "s1", Status: SyncRunStatusSuccess, Inserted: 10, Pages: 1},
+		{SiteID: "s2", Status: SyncRunStatusSuccess, Inserted: 3, Pages: 1},
+		{SiteID: "s1", Status: SyncRunStatusFailed, Error: "builder unavailable"},
+		{SiteID: "s1", Status: SyncRunStatusSuccess, Inserted: 5, Skipped: 2, Pages: 2},
+	} {
+		run.WorkflowID = fmt.Sprintf("sync-%s-%d", run.SiteID, i)
+		run.RunID = fmt.Sprintf("r%d", i)
+		run.Reason = "api-sync"
+		run.Input = SyncWorkflowInput{SiteID: run.SiteID, IncludeUsers: true, Page: 1, Reason: "api-sync"}
+		run.StartedAt = t0.Add(time.Duration(i) * time.Minute)
+		run.CompletedAt = run.StartedAt.Add(30 * time.Second)
+		if _, err := store.RecordSyncRun(ctx, run); err != nil {
+			t.Fatalf("record run %d: %v", i, err)
+		}
+	}
+
+	var got []string
+	var cursor string
+	for {
+		page, err := store.ListSyncRuns(ctx, SyncRunFilter{SiteID: "s1", Before: cursor, Limit: 2})
+		if err != nil {
+			t.Fatalf("list sync runs: %v", err)
+		}
+		for _, run := range page.Runs {
+			got = append(got, run.RunID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if want := []string{"r3", "r2", "r0"}; !slices.Equal(got, want) {
+		t.Fatalf("s1 runs = %v, want newest first %v", got, want)
+	}
+
+	failed, err := store.ListSyncRuns(ctx, SyncRunFilter{Status: SyncRunStatusFailed})
+	if err != nil {
+		t.Fatalf("list failed runs: %v", err)
+	}
+	if len(failed.Runs) != 1 {
+		t.Fatalf("failed runs = %+v, want one", failed.Runs)
+	}
+	run := failed.Runs[0]
+	if run.Error != "builder unavailable" || run.Input.SiteID != "s1" || !run.StartedAt.Equal(t0.Add(2*time.Minute)) {
+		t.Fatalf("failed run = %+v, want its error, input and start time kept", run)
+	}
+
+	if _, err := store.ListSyncRuns(ctx, SyncRunFilter{Before: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("malformed cursor error = %v, want ErrInvalidCursor", err)
+	}
+
+	rec := serve(t, newTestServer(t, store).Router(), http.MethodGet, "/worker/syncs?site_id=s2&limit=5", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /worker/syncs: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body SyncRunPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Runs) != 1 || body.Runs[0].RunID != "r1" {
+		t.Fatalf("GET /worker/syncs?site_id=s2 = %+v, want only run r1", body.Runs)
+	}
+}
+
+func TestRevenueByAttributionGroupsSourceAndCurrency(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	order := func(key, siteID, source, currency string, amount int, at time.Time) Event {
+		return Event{SiteID: siteID, Timestamp: at, UserID: "u-" + key, EventName: "order_created", UTMSource: source, DedupeKey: key,
+			Properties: map[string]any{"currency": currency, "total_amount": amount}}
+	}
+	for _, e := range []Event{
+		order("o1", "s1", "google", "USD", 1000, t0),
+		// Currency codes are grouped case-insensitively.
+		order("o2", "s1", "google", "usd", 500, t0),
+		order("o3", "s1", "google", "KRW", 20000, t0),
+		order("o4", "s1", "facebook", "EUR", 700, t0),
+		order("o5", "s1", "", "USD", 300, t0),
+		order("o6", "s2", "google", "USD", 9999, t0),
+		order("o7", "s1", "google", "USD", 8888, t0.Add(48*time.Hour)),
+		{SiteID: "s1", Timestamp: t0, UserID: "u1", EventName: "signup", UTMSource: "google", DedupeKey: "signup:u1",
+			Properties: map[string]any{"currency": "USD", "total_amount": 4242}},
+	} {
+		mustInsert(t, store, e)
+	}
+
+	end := t0.Add(24 * time.Hour)
+	got, err := store.RevenueByAttribution(ctx, "s1", nil, &end)
+	if err != nil {
+		t.Fatalf("revenue by attribution: %v", err)
+	}
+	want := []SourceRevenue{
+		{Source: "", Currency: "USD", Orders: 1, TotalAmount: 300},
+		{Source: "facebook", Currency: "EUR", Orders: 1, TotalAmount: 700},
+		{Source: "google", Currency: "KRW", Orders: 1, TotalAmount: 20000},
+		{Source: "google", Currency: "USD", Orders: 2, TotalAmount: 1500},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("revenue = %+v, want %+v", got, want)
+	}
+
+	h := newTestServer(t, store).Router()
+	if rec := serve(t, h, http.MethodGet, "/worker/reports/revenue", "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("without site_id: status %d, want 400", rec.Code)
+	}
+	rec := serve(t, h, http.MethodGet, "/worker/reports/revenue?site_id=s1&end=2025-03-02", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /worker/reports/revenue: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Sources []SourceRevenue `json:"sources"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !slices.Equal(body.Sources, want) {
+		t.Fatalf("endpoint sources = %+v, want %+v", body.Sources, want)
+	}
+}
+
+func TestAttributionPathKeepsTouchOrder(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	touch := func(siteID, userID, source string, hours int) Event {
+		return Event{SiteID: siteID, Timestamp: t0.Add(time.Duration(hours) * time.Hour), UserID: userID, EventName: "page_view",
+			UTMSource: source, DedupeKey: fmt.Sprintf("view:%s:%s:%d", siteID, userID, hours)}
+	}
+	for _, e := range []Event{
+		touch("s1", "u1", "google", 0),
+		touch("s1", "u1", "google", 1),
+		touch("s1", "u1", "facebook", 2),
+		touch("s1", "u1", "", 3),
+		touch("s1", "u1", "google", 4),
+		touch("s1", "u1", "newsletter", 6),
+		touch("s2", "u1", "tiktok", 1),
+		touch("s1", "u2", "bing", 1),
+	} {
+		mustInsert(t, store, e)
+	}
+
+	path, err := store.AttributionPath(ctx, "s1", "u1", t0.Add(5*time.Hour))
+	if err != nil {
+		t.Fatalf("attribution path: %v", err)
+	}
+	// Repeats collapse only when consecutive; touches after the cutoff, on other sites, or of
+	// other users never show up.
+	if want := []string{"google", "facebook", "google"}; !slices.Equal(path, want) {
+		t.Fatalf("path = %v, want %v", path, want)
+	}
+	if path, err := store.AttributionPath(ctx, "s1", "u3", t0.Add(5*time.Hour)); err != nil || len(path) != 0 {
+		t.Fatalf("path of a user without touches = %v, %v; want none", path, err)
+	}
+}
+
+func TestPersistOrdersRecordsAttributionPath(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	t0 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, source := range []string{"google", "facebook", "facebook"} {
+		mustInsert(t, store, Event{SiteID: "s1", Timestamp: t0.Add(time.Duration(i) * time.Hour), UserID: "u1", EventName: "page_view",
+			UTMSource: source, DedupeKey: fmt.Sprintf("view:%d", i)})
+	}
+	s := newTestServer(t, store)
+	site := RegisteredSite{SiteID: "s1"}
+	order := BuilderOrder{ID: "o1", SiteID: "s1", UserID: "u1", TotalAmount: 1000, Currency: "USD", PlacedAt: t0.Add(5 * time.Hour)}
+	if inserted, _, err := s.persistOrders(ctx, site, []BuilderOrder{order}); err != nil || inserted != 1 {
+		t.Fatalf("persist orders: inserted %d, err %v", inserted, err)
+	}
+
+	event, ok, err := store.GetEventByDedupeKey(ctx, "s1", "order:s1:o1", "facebook")
+	if err != nil || !ok {
+		t.Fatalf("stored order: ok %v, err %v; want it attributed to the last touch", ok, err)
+	}
+	raw, _ := json.Marshal(event.Metadata["attribution_path"])
+	if string(raw) != `["google","facebook"]` {
+		t.Fatalf("attribution_path = %s, want [google facebook]", raw)
+	}
+}
@@ -0,0 +1,372 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// newSyncTestEnv returns a test environment with SyncSiteWorkflow and every sync activity
+// registered under their production names. Tests mock the activities with OnActivity.
+func newSyncTestEnv(t *testing.T) *testsuite.TestWorkflowEnvironment {
+	t.Helper()
+	return newSyncTestEnvWith(t, nil)
+}
+
+// newSyncTestEnvWith is newSyncTestEnv with the real activities running against persister.
+func newSyncTestEnvWith(t *testing.T, persister SyncPersister) *testsuite.TestWorkflowEnvironment {
+	t.Helper()
+	var s testsuite.WorkflowTestSuite
+	s.SetLogger(log.NewStructuredLogger(discardLogger()))
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflowWithOptions(SyncSiteWorkflow, workflow.RegisterOptions{Name: syncWorkflowName})
+	activities := NewSyncActivities(persister, discardLogger())
+	env.RegisterActivityWithOptions(activities.SyncUsersActivity, activity.RegisterOptions{Name: syncUsersActivityName})
+	env.RegisterActivityWithOptions(activities.SyncOrdersActivity, activity.RegisterOptions{Name: syncOrdersActivityName})
+	env.RegisterActivityWithOptions(activities.SyncChangesActivity, activity.RegisterOptions{Name: syncChangesActivityName})
+	env.RegisterActivityWithOptions(activities.GetWatermarkActivity, activity.RegisterOptions{Name: getWatermarkActivityName})
+	env.RegisterActivityWithOptions(activities.SaveWatermarkActivity, activity.RegisterOptions{Name: saveWatermarkActivityName})
+	return env
+}
+
+// fakePersister serves the sync activities from canned results. Methods a test does not set
+// up panic through the nil embedded interface.
+type fakePersister struct {
+	SyncPersister
+	loadErr   error
+	userPages func(ctx context.Context, page int) (PagesBatchResult, error)
+	loads     atomic.Int32
+}
+
+func (f *fakePersister) LoadSite(_ context.Context, siteID string) (RegisteredSite, error) {
+	f.loads.Add(1)
+	if f.loadErr != nil {
+		return RegisteredSite{}, f.loadErr
+	}
+	return RegisteredSite{SiteID: siteID, AccessKey: "key", BuilderBaseURL: "http://builder"}, nil
+}
+
+func (f *fakePersister) SyncUserPages(ctx context.Context, _ RegisteredSite, page, _ int, _, _ *time.Time) (PagesBatchResult, error) {
+	return f.userPages(ctx, page)
+}
+
+// queryProgress answers the sync.progress query against the workflow running in env.
+func queryProgress(t *testing.T, env *testsuite.TestWorkflowEnvironment) LiveSyncProgress {
+	t.Helper()
+	value, err := env.QueryWorkflow(syncProgressQueryName)
+	require.NoError(t, err)
+	var progress LiveSyncProgress
+	require.NoError(t, value.Get(&progress))
+	return progress
+}
+
+func TestSyncProgressQuery(t *testing.T) {
+	env := newSyncTestEnv(t)
+	env.OnActivity(syncUsersActivityName, mock.Anything, mock.Anything).After(time.Minute).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 25, Skipped: 5, Pages: 3}}, nil).Once()
+
+	var during LiveSyncProgress
+	env.RegisterDelayedCallback(func() {
+		during = queryProgress(t, env)
+	}, 30*time.Second)
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, Page: 1, Reason: "test"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	require.Equal(t, LiveSyncProgress{Entity: "users"}, during)
+	require.Equal(t, LiveSyncProgress{Entity: "users", Pages: 3, Inserted: 25, Skipped: 5, Done: true}, queryProgress(t, env))
+	env.AssertExpectations(t)
+}
+
+func TestSyncChangesResumesFromWatermark(t *testing.T) {
+	env := newSyncTestEnv(t)
+	env.OnActivity(getWatermarkActivityName, mock.Anything, "s1").Return(int64(40), nil).Once()
+	env.OnActivity(syncChangesActivityName, mock.Anything, SyncChangesInput{SiteID: "s1", Since: 40, MaxPages: changesPagesPerActivity}).
+		Return(ChangesBatchResult{Summary: SyncSummary{Inserted: 10, Pages: 1}, NextSeq: 50, HasMore: true}, nil).Once()
+	env.OnActivity(saveWatermarkActivityName, mock.Anything, "s1", int64(50)).Return(nil).Once()
+	env.OnActivity(syncChangesActivityName, mock.Anything, SyncChangesInput{SiteID: "s1", Since: 50, MaxPages: changesPagesPerActivity}).
+		Return(ChangesBatchResult{Summary: SyncSummary{Inserted: 2, Skipped: 1, Pages: 1}, NextSeq: 53}, nil).Once()
+	env.OnActivity(saveWatermarkActivityName, mock.Anything, "s1", int64(53)).Return(nil).Once()
+
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", UseChanges: true, Reason: "test"})
+
+	require.NoError(t, env.GetWorkflowError())
+	var result SyncWorkflowResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.NotNil(t, result.Changes)
+	require.Equal(t, 12, result.Changes.Inserted)
+	require.Equal(t, 2, result.Changes.Pages)
+	env.AssertExpectations(t)
+}
+
+func TestSyncWorkflowInputValidate(t *testing.T) {
+	require.EqualError(t, SyncWorkflowInput{IncludeUsers: true}.Validate(), "site_id required")
+	require.ErrorIs(t, SyncWorkflowInput{SiteID: "s1"}.Validate(), ErrNothingToSync)
+	for _, in := range []SyncWorkflowInput{
+		{SiteID: "s1", IncludeUsers: true},
+		{SiteID: "s1", IncludeOrders: true},
+		{SiteID: "s1", UseChanges: true},
+	} {
+		require.NoError(t, in.Validate())
+	}
+}
+
+func TestSyncWorkflowRejectsEmptyInput(t *testing.T) {
+	env := newSyncTestEnv(t)
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", Reason: "test"})
+
+	err := env.GetWorkflowError()
+	var appErr *temporal.ApplicationError
+	require.ErrorAs(t, err, &appErr)
+	require.Equal(t, "InvalidSyncInput", appErr.Type())
+	require.True(t, appErr.NonRetryable())
+}
+
+func TestSyncEndpointRejectsEmptyInput(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.RegisterSite(context.Background(), RegisteredSite{SiteID: "s1", AccessKey: "key", BuilderBaseURL: "http://builder"}))
+	orch := &fakeOrchestrator{}
+	h := NewServer(store, NewBuilderClient(), orch, discardLogger()).Router()
+
+	rec := serve(t, h, http.MethodPost, "/worker/sites/s1/sync", `{"include_users":false,"include_orders":false}`, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "nothing to sync")
+	require.Empty(t, orch.started)
+}
+
+func TestSyncActivitiesFailPermanentlyForUnknownSitesAndRejectedKeys(t *testing.T) {
+	rejected := func(context.Context, int) (PagesBatchResult, error) {
+		return PagesBatchResult{}, fmt.Errorf("list users: %w", ErrBuilderUnauthorized)
+	}
+	for name, tc := range map[string]struct {
+		persister *fakePersister
+		wantType  string
+	}{
+		"unknown site": {&fakePersister{loadErr: sql.ErrNoRows}, ErrTypeSiteNotFound},
+		"rejected key": {&fakePersister{userPages: rejected}, ErrTypeInvalidAccessKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			env := newSyncTestEnvWith(t, tc.persister)
+			env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, Page: 1, Reason: "test"})
+
+			var appErr *temporal.ApplicationError
+			require.ErrorAs(t, env.GetWorkflowError(), &appErr)
+			require.Equal(t, tc.wantType, appErr.Type())
+			require.True(t, appErr.NonRetryable())
+			require.EqualValues(t, 1, tc.persister.loads.Load(), "the activity must not be retried")
+		})
+	}
+}
+
+func TestSyncCancelSignalStopsBeforeTheNextActivity(t *testing.T) {
+	env := newSyncTestEnv(t)
+	// Both phases report more pages, so without the signal the run would continue as new and
+	// schedule another orders batch.
+	env.OnActivity(syncUsersActivityName, mock.Anything, mock.Anything).After(time.Minute).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 10, Pages: 1}, NextPage: 2, HasMore: true}, nil).Once()
+	env.OnActivity(syncOrdersActivityName, mock.Anything, mock.Anything).After(time.Minute).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 4, Pages: 1}, NextPage: 2, HasMore: true}, nil).Once()
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(syncCancelSignalName, nil)
+	}, 30*time.Second)
+
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, IncludeOrders: true, Page: 1, Reason: "test"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError(), "a cancelled sync must not continue as new")
+	var result SyncWorkflowResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.True(t, result.Cancelled)
+	require.NotNil(t, result.Users)
+	require.NotNil(t, result.Orders)
+	require.Equal(t, 10, result.Users.Inserted)
+	require.Equal(t, 4, result.Orders.Inserted)
+	require.True(t, queryProgress(t, env).Done)
+	env.AssertExpectations(t)
+}
+
+func TestCancelSyncEndpoint(t *testing.T) {
+	orch := &fakeOrchestrator{started: []SyncWorkflowInput{{SiteID: "s1"}}}
+	h := NewServer(newTestStore(t), NewBuilderClient(), orch, discardLogger()).Router()
+
+	rec := serve(t, h, http.MethodPost, "/worker/syncs/sync-s1/cancel", "", nil)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	require.Equal(t, []string{"sync-s1"}, orch.cancelled)
+
+	rec = serve(t, h, http.MethodPost, "/worker/syncs/sync-other/cancel", "", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSyncRunsUsersAndOrdersConcurrently(t *testing.T) {
+	env := newSyncTestEnv(t)
+	env.OnActivity(syncUsersActivityName, mock.Anything, mock.Anything).After(time.Minute).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 10, Pages: 1}}, nil).Once()
+	env.OnActivity(syncOrdersActivityName, mock.Anything, mock.Anything).After(time.Minute).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 4, Pages: 1}}, nil).Once()
+
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, IncludeOrders: true, Page: 1, Reason: "test"})
+
+	require.NoError(t, env.GetWorkflowError())
+	var result SyncWorkflowResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.NotNil(t, result.Users)
+	require.NotNil(t, result.Orders)
+	require.Equal(t, 10, result.Users.Inserted)
+	require.Equal(t, 4, result.Orders.Inserted)
+	require.Less(t, result.CompletedAt.Sub(result.StartedAt), 2*time.Minute, "activities ran one after the other")
+	env.AssertExpectations(t)
+}
+
+func TestSyncKeepsSiblingProgressWhenOneActivityFails(t *testing.T) {
+	env := newSyncTestEnv(t)
+	env.OnActivity(syncUsersActivityName, mock.Anything, mock.Anything).
+		Return(PagesBatchResult{}, errors.New("builder unavailable"))
+	env.OnActivity(syncOrdersActivityName, mock.Anything, mock.Anything).After(time.Minute).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 4, Pages: 1}}, nil).Once()
+
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, IncludeOrders: true, Page: 1, Reason: "test"})
+
+	require.ErrorContains(t, env.GetWorkflowError(), "builder unavailable")
+	// The orders batch was persisted, so it still shows in the progress the run reports.
+	require.Equal(t, 4, queryProgress(t, env).Inserted)
+	env.AssertExpectations(t)
+}
+
+func TestSyncNonRetryableFailureCancelsSibling(t *testing.T) {
+	env := newSyncTestEnv(t)
+	env.OnActivity(syncUsersActivityName, mock.Anything, mock.Anything).
+		Return(PagesBatchResult{}, temporal.NewNonRetryableApplicationError("rejected", ErrTypeInvalidAccessKey, nil)).Once()
+	env.OnActivity(syncOrdersActivityName, mock.Anything, mock.Anything).After(time.Hour).
+		Return(PagesBatchResult{Summary: SyncSummary{Inserted: 4, Pages: 1}}, nil)
+	start := env.Now()
+
+	env.ExecuteWorkflow(SyncSiteWorkflow, SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, IncludeOrders: true, Page: 1, Reason: "test"})
+
+	var appErr *temporal.ApplicationError
+	require.ErrorAs(t, env.GetWorkflowError(), &appErr)
+	require.Equal(t, ErrTypeInvalidAccessKey, appErr.Type())
+	require.Less(t, env.Now().Sub(start), time.Hour, "the orders activity was waited for instead of cancelled")
+	require.Zero(t, queryProgress(t, env).Inserted)
+}
+
+func TestSyncContinuesAsNewAcrossLargeBackfills(t *testing.T) {
+	// 70 pages of users: three full batches, then a final one of 10 pages.
+	batch := func(_ context.Context, in SyncWorkflowInput) (PagesBatchResult, error) {
+		pages := min(syncPagesPerActivity, 71-in.Page)
+		next := in.Page + pages
+		return PagesBatchResult{
+			Summary:  SyncSummary{Inserted: pages * 10, Skipped: 1, Pages: pages, Total: 700},
+			NextPage: next,
+			HasMore:  next <= 70,
+		}, nil
+	}
+
+	input := SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, Page: 1, Reason: "test"}
+	var pages []int
+	for run := 0; ; run++ {
+		require.Less(t, run, 10, "sync never finished")
+		pages = append(pages, input.Page)
+		env := newSyncTestEnv(t)
+		env.OnActivity(syncUsersActivityName, mock.Anything, mock.Anything).Return(batch).Once()
+		env.ExecuteWorkflow(SyncSiteWorkflow, input)
+
+		var cont *workflow.ContinueAsNewError
+		if errors.As(env.GetWorkflowError(), &cont) {
+			require.Equal(t, syncWorkflowName, cont.WorkflowType.Name)
+			input = SyncWorkflowInput{}
+			require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(cont.Input, &input))
+			continue
+		}
+		require.NoError(t, env.GetWorkflowError())
+		var result SyncWorkflowResult
+		require.NoError(t, env.GetWorkflowResult(&result))
+		require.Equal(t, 3, result.Continuations)
+		require.Equal(t, &SyncSummary{Inserted: 700, Skipped: 4, Pages: 70, Total: 700}, result.Users)
+		break
+	}
+	require.Equal(t, []int{1, 21, 41, 61}, pages)
+}
+
+func TestSyncSiteResumesFromHeartbeatedPage(t *testing.T) {
+	s := newTestServer(t, newTestStore(t))
+	site := RegisteredSite{SiteID: "s1"}
+	// Six pages of ten users; the first attempt dies fetching page 4.
+	var requested []int
+	failAt := 4
+	fetch := func(_ context.Context, _ RegisteredSite, page int, _, _ *time.Time) (pagedResult, error) {
+		requested = append(requested, page)
+		if page == failAt {
+			return pagedResult{}, errors.New("worker killed")
+		}
+		return pagedResult{page: page, pageSize: 10, total: 60, hasMore: page < 6, inserted: 10}, nil
+	}
+	const name = "test.sync.pages"
+	run := func(ctx context.Context) (PagesBatchResult, error) {
+		return s.syncSite(ctx, site, 1, 0, nil, nil, fetch)
+	}
+	var suite testsuite.WorkflowTestSuite
+	suite.SetLogger(log.NewStructuredLogger(discardLogger()))
+
+	first := suite.NewTestActivityEnvironment()
+	first.RegisterActivityWithOptions(run, activity.RegisterOptions{Name: name})
+	var checkpoint pageCheckpoint
+	first.SetOnActivityHeartbeatListener(func(_ *activity.Info, details converter.EncodedValues) {
+		require.NoError(t, details.Get(&checkpoint))
+	})
+	_, err := first.ExecuteActivity(name)
+	require.ErrorContains(t, err, "worker killed")
+	require.Equal(t, []int{1, 2, 3, 4}, requested)
+	require.Equal(t, pageCheckpoint{NextPage: 4, HasMore: true, Summary: SyncSummary{Inserted: 30, Pages: 3, Total: 60}}, checkpoint)
+
+	requested, failAt = nil, 0
+	retry := suite.NewTestActivityEnvironment()
+	retry.RegisterActivityWithOptions(run, activity.RegisterOptions{Name: name})
+	retry.SetHeartbeatDetails(checkpoint)
+	value, err := retry.ExecuteActivity(name)
+	require.NoError(t, err)
+	var result PagesBatchResult
+	require.NoError(t, value.Get(&result))
+	require.Equal(t, []int{4, 5, 6}, requested, "the retry should pick up at the heartbeated page")
+	require.Equal(t, 60, result.Summary.Inserted)
+	require.Equal(t, 6, result.Summary.Pages)
+	require.False(t, result.HasMore)
+}
+
+func TestSyncBuilderBaseURLOverrideRequiresAdminToken(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.RegisterSite(context.Background(), RegisteredSite{SiteID: "s1", AccessKey: "key", BuilderBaseURL: "http://builder"}))
+	body := `{"include_users":true,"builder_base_url":"http://attacker.example"}`
+
+	orch := &fakeOrchestrator{}
+	open := NewServer(store, NewBuilderClient(), orch, discardLogger()).Router()
+	rec := serve(t, open, http.MethodPost, "/worker/sites/s1/sync", body, nil)
+	require.Equal(t, http.StatusForbidden, rec.Code, "override without a configured admin token")
+
+	guarded := NewServer(store, NewBuilderClient(), orch, discardLogger(), WithAdminToken("secret")).Router()
+	rec = serve(t, guarded, http.MethodPost, "/worker/sites/s1/sync", body, nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code, "override without the admin token")
+	require.Empty(t, orch.started)
+
+	// Without an override the endpoint stays open.
+	rec = serve(t, guarded, http.MethodPost, "/worker/sites/s1/sync", `{"include_users":true}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serve(t, guarded, http.MethodPost, "/worker/sites/s1/sync", body, http.Header{"X-Admin-Token": {"secret"}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, orch.started, 2)
+	require.Equal(t, "http://attacker.example", orch.started[1].BuilderBaseURL)
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+
+	"example.com/temporal-go/internal/metrics"
+)
+
+// Temporal metric series. Each observation is labelled with the activity or workflow type and a
+// status of ok, error, or (workflows only) continued_as_new, so the series count doubles as an
+// execution and failure counter.
+const (
+	temporalActivityMetric = "temporal_activity"
+	temporalWorkflowMetric = "temporal_workflow"
+)
+
+// TemporalMetricsInterceptor records activity and workflow execution durations in a metrics
+// registry, next to the builder client metrics served at /worker/debug/metrics.
+type TemporalMetricsInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	registry *metrics.Registry
+}
+
+// NewTemporalMetricsInterceptor returns an interceptor that records into reg.
+func NewTemporalMetricsInterceptor(reg *metrics.Registry) *TemporalMetricsInterceptor {
+	return &TemporalMetricsInterceptor{registry: reg}
+}
+
+// InterceptActivity implements interceptor.WorkerInterceptor.
+func (t *TemporalMetricsInterceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	i := &metricsActivityInbound{registry: t.registry}
+	i.Next = next
+	return i
+}
+
+// InterceptWorkflow implements interceptor.WorkerInterceptor.
+func (t *TemporalMetricsInterceptor) InterceptWorkflow(ctx workflow.Context, next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	i := &metricsWorkflowInbound{registry: t.registry}
+	i.Next = next
+	return i
+}
+
+type metricsActivityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+	registry *metrics.Registry
+}
+
+func (i *metricsActivityInbound) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	start := time.Now()
+	result, err := i.Next.ExecuteActivity(ctx, in)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	i.registry.Observe(temporalActivityMetric, map[string]string{
+		"activity": activity.GetInfo(ctx).ActivityType.Name,
+		"status":   status,
+	}, time.Since(start))
+	return result, err
+}
+
+type metricsWorkflowInbound struct {
+	interceptor.WorkflowInboundInterceptorBase
+	registry *metrics.Registry
+}
+
+// ExecuteWorkflow measures the run in workflow time from its start, and only records once the
+// run really completes rather than each time a worker replays it.
+func (i *metricsWorkflowInbound) ExecuteWorkflow(ctx workflow.Context, in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	result, err := i.Next.ExecuteWorkflow(ctx, in)
+	if workflow.IsReplaying(ctx) {
+		return result, err
+	}
+	info := workflow.GetInfo(ctx)
+	status := "ok"
+	var continued *workflow.ContinueAsNewError
+	switch {
+	case errors.As(err, &continued):
+		status = "continued_as_new"
+	case err != nil:
+		status = "error"
+	}
+	i.registry.Observe(temporalWorkflowMetric, map[string]string{
+		"workflow": info.WorkflowType.Name,
+		"status":   status,
+	}, workflow.Now(ctx).Sub(info.WorkflowStartTime))
+	return result, err
+}
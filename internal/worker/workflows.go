@@ -2,71 +2,293 @@ package worker
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
 	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/temporal"
 	temporalworker "go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
+
+	"example.com/temporal-go/internal/metrics"
+)
+
+const (
+	syncTaskQueue             = "worker-sync-task-queue"
+	syncWorkflowName          = "worker.sync.site"
+	syncUsersActivityName     = "worker.sync.users"
+	syncOrdersActivityName    = "worker.sync.orders"
+	syncChangesActivityName   = "worker.sync.changes"
+	getWatermarkActivityName  = "worker.watermark.get"
+	saveWatermarkActivityName = "worker.watermark.save"
+
+	// changesWatermarkEntity is the sync_watermarks entity used by the changes feed.
+	changesWatermarkEntity = "changes"
+	// changesPagesPerActivity bounds how much work a single changes activity performs before
+	// the workflow persists the watermark.
+	changesPagesPerActivity = 20
+	// syncPagesPerActivity bounds how many users or orders pages one activity processes before
+	// the workflow continues as new from the next page.
+	syncPagesPerActivity = 20
+	// syncHeartbeatTimeout is how long a sync activity may go without a heartbeat. It leaves
+	// room for a parallel page batch with builder failover between heartbeats.
+	syncHeartbeatTimeout = 2 * time.Minute
 )
 
+// syncProgressQueryName is the query SyncSiteWorkflow answers with its LiveSyncProgress.
+const syncProgressQueryName = "sync.progress"
+
+// syncCancelSignalName is the signal that stops SyncSiteWorkflow before its next activity.
+const syncCancelSignalName = "sync.cancel"
+
+// SiteIDSearchAttribute is the Keyword search attribute every sync workflow carries its site ID
+// in, so syncs can be filtered by site in the Temporal UI and visibility queries. It must be
+// registered on the namespace before the worker starts syncs, or starting them fails.
+const SiteIDSearchAttribute = "SiteID"
+
+var siteIDSearchAttributeKey = temporal.NewSearchAttributeKeyKeyword(SiteIDSearchAttribute)
+
+// syncSearchAttributes are the search attributes of a sync workflow for siteID.
+func syncSearchAttributes(siteID string) temporal.SearchAttributes {
+	return temporal.NewSearchAttributes(siteIDSearchAttributeKey.ValueSet(siteID))
+}
+
+// syncWorkflowOptions are the start options of a one-off sync workflow for input. The ID is
+// unique per start, so several syncs of a site may run side by side.
+func syncWorkflowOptions(input SyncWorkflowInput) client.StartWorkflowOptions {
+	return client.StartWorkflowOptions{
+		ID:                    fmt.Sprintf("sync-%s-%d", input.SiteID, time.Now().UnixNano()),
+		TaskQueue:             syncTaskQueue,
+		WorkflowIDReusePolicy: enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE,
+		WorkflowRunTimeout:    30 * time.Minute,
+		TypedSearchAttributes: syncSearchAttributes(input.SiteID),
+	}
+}
+
+// LiveSyncProgress is what the sync.progress query reports about a running sync: the entity
+// being synced and the running totals across every phase and continue-as-new run so far. It
+// advances once per activity, so a batch still in flight is not counted yet.
+type LiveSyncProgress struct {
+	// Entity is "users", "orders", "users+orders" while both run in parallel, or "changes".
+	Entity        string `json:"entity"`
+	Pages         int    `json:"pages_processed"`
+	Inserted      int    `json:"inserted"`
+	Skipped       int    `json:"skipped"`
+	Continuations int    `json:"continuations"`
+	Done          bool   `json:"done"`
+}
+
+func (p *LiveSyncProgress) add(batch SyncSummary) {
+	p.Pages += batch.Pages
+	p.Inserted += batch.Inserted
+	p.Skipped += batch.Skipped
+}
+
+// Application error types sync activities fail with when retrying cannot help. The sync
+// workflow's retry policy lists them as non-retryable.
 const (
-	syncTaskQueue          = "worker-sync-task-queue"
-	syncWorkflowName       = "worker.sync.site"
-	syncUsersActivityName  = "worker.sync.users"
-	syncOrdersActivityName = "worker.sync.orders"
+	// ErrTypeSiteNotFound means the site is not registered with the worker.
+	ErrTypeSiteNotFound = "SiteNotFound"
+	// ErrTypeInvalidAccessKey means the builder rejected the site's access key.
+	ErrTypeInvalidAccessKey = "InvalidAccessKey"
 )
 
-// SyncActivities hosts the activity implementations that reuse the existing server logic.
+// SyncChangesInput tells the changes activity where to resume.
+type SyncChangesInput struct {
+	SiteID         string `json:"site_id"`
+	Since          int64  `json:"since"`
+	MaxPages       int    `json:"max_pages"`
+	BuilderBaseURL string `json:"builder_base_url,omitempty"`
+}
+
+// ChangesBatchResult reports one bounded pass over the builder changes feed.
+type ChangesBatchResult struct {
+	Summary SyncSummary `json:"summary"`
+	NextSeq int64       `json:"next_seq"`
+	HasMore bool        `json:"has_more"`
+}
+
+// PagesBatchResult reports one bounded pass over a site's users or orders pages. NextPage is
+// where the next pass resumes when HasMore is set.
+type PagesBatchResult struct {
+	Summary  SyncSummary `json:"summary"`
+	NextPage int         `json:"next_page,omitempty"`
+	HasMore  bool        `json:"has_more"`
+}
+
+// SyncPersister is what the sync activities need from the worker: site lookup, fetching and
+// persisting builder pages, and the changes watermark. *Server implements it; tests can supply
+// a fake to exercise the activities without a builder or database.
+type SyncPersister interface {
+	LoadSite(ctx context.Context, siteID string) (RegisteredSite, error)
+	SyncUserPages(ctx context.Context, site RegisteredSite, page, maxPages int, start, end *time.Time) (PagesBatchResult, error)
+	SyncOrderPages(ctx context.Context, site RegisteredSite, page, maxPages int, start, end *time.Time) (PagesBatchResult, error)
+	SyncChangesBatch(ctx context.Context, site RegisteredSite, since int64, maxPages int) (ChangesBatchResult, error)
+	ChangesWatermark(ctx context.Context, siteID string) (int64, error)
+	SaveChangesWatermark(ctx context.Context, siteID string, seq int64) error
+}
+
+var _ SyncPersister = (*Server)(nil)
+
+// SyncActivities hosts the activity implementations on top of a SyncPersister.
 type SyncActivities struct {
-	server *Server
-	logger *slog.Logger
+	persister SyncPersister
+	logger    *slog.Logger
 }
 
-func NewSyncActivities(server *Server, logger *slog.Logger) *SyncActivities {
-	return &SyncActivities{server: server, logger: logger}
+func NewSyncActivities(persister SyncPersister, logger *slog.Logger) *SyncActivities {
+	return &SyncActivities{persister: persister, logger: logger}
 }
 
-// SyncUsersActivity pulls users from the builder and stores events.
-func (a *SyncActivities) SyncUsersActivity(ctx context.Context, input SyncWorkflowInput) (SyncSummary, error) {
-	site, err := a.server.store.GetSite(ctx, input.SiteID)
+// loadSite fetches the registered site and applies a per-run builder URL override, if any.
+func (a *SyncActivities) loadSite(ctx context.Context, siteID, baseURLOverride string) (RegisteredSite, error) {
+	site, err := a.persister.LoadSite(ctx, siteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RegisteredSite{}, temporal.NewNonRetryableApplicationError(fmt.Sprintf("site %q is not registered", siteID), ErrTypeSiteNotFound, err)
+	}
 	if err != nil {
-		return SyncSummary{}, err
+		return RegisteredSite{}, err
 	}
-	summary, err := a.server.syncSite(ctx, site, input.Page, input.Start, input.End, a.server.fetchUsersPage)
+	if baseURLOverride != "" {
+		if err := validateBuilderBaseURL(baseURLOverride); err != nil {
+			return RegisteredSite{}, temporal.NewNonRetryableApplicationError(err.Error(), "InvalidBuilderBaseURL", err)
+		}
+		activityLogger(ctx, a.logger).Warn("activity using builder base URL override", "registered_urls", site.BaseURLs(), "override_url", baseURLOverride)
+		site.BuilderBaseURL = baseURLOverride
+		site.BuilderBaseURLs = nil
+	}
+	return site, nil
+}
+
+// classifyActivityError marks builder responses that cannot be decoded, and rejected access
+// keys, as non-retryable, since neither will fix itself. Other errors keep the workflow's retry
+// policy.
+func classifyActivityError(err error) error {
+	var decodeErr *BuilderDecodeError
+	if errors.As(err, &decodeErr) {
+		return temporal.NewNonRetryableApplicationError(err.Error(), "BuilderDecodeError", err)
+	}
+	if errors.Is(err, ErrBuilderUnauthorized) {
+		return temporal.NewNonRetryableApplicationError(err.Error(), ErrTypeInvalidAccessKey, err)
+	}
+	return err
+}
+
+// pageCheckpoint is the heartbeat detail a paged sync records: the page it resumes at, whether
+// any remain, and the totals so far.
+type pageCheckpoint struct {
+	NextPage int         `json:"next_page"`
+	HasMore  bool        `json:"has_more"`
+	Summary  SyncSummary `json:"summary"`
+}
+
+// heartbeatPage records cp as the activity's heartbeat. Outside an activity it does nothing.
+func heartbeatPage(ctx context.Context, cp pageCheckpoint) {
+	if activity.IsActivity(ctx) {
+		activity.RecordHeartbeat(ctx, cp)
+	}
+}
+
+// lastPageCheckpoint returns the checkpoint an earlier attempt of the running activity
+// heartbeated, if there is one.
+func lastPageCheckpoint(ctx context.Context) (pageCheckpoint, bool) {
+	if !activity.IsActivity(ctx) || !activity.HasHeartbeatDetails(ctx) {
+		return pageCheckpoint{}, false
+	}
+	var cp pageCheckpoint
+	if err := activity.GetHeartbeatDetails(ctx, &cp); err != nil {
+		return pageCheckpoint{}, false
+	}
+	return cp, true
+}
+
+// retriesBefore turns a 1-based activity attempt number into the count of failed attempts
+// before it.
+func retriesBefore(attempt int32) int {
+	return max(int(attempt)-1, 0)
+}
+
+// SyncUsersActivity pulls up to syncPagesPerActivity pages of users from input.Page on and
+// stores events.
+func (a *SyncActivities) SyncUsersActivity(ctx context.Context, input SyncWorkflowInput) (PagesBatchResult, error) {
+	site, err := a.loadSite(ctx, input.SiteID, input.BuilderBaseURL)
 	if err != nil {
-		a.logger.Error("activity sync users failed", "site_id", input.SiteID, "error", err, "reason", input.Reason)
-		return summary, err
+		return PagesBatchResult{}, err
 	}
-	a.logger.Info("activity sync users", "site_id", input.SiteID, "inserted", summary.Inserted, "skipped", summary.Skipped, "pages", summary.Pages, "reason", input.Reason)
-	return summary, nil
+	attempt := activity.GetInfo(ctx).Attempt
+	result, err := a.persister.SyncUserPages(ctx, site, input.Page, syncPagesPerActivity, input.Start, input.End)
+	if err != nil {
+		activityLogger(ctx, a.logger).Error("activity sync users failed", "page", input.Page, "error", err, "attempt", attempt, "reason", input.Reason)
+		return result, classifyActivityError(err)
+	}
+	result.Summary.RetriesObserved = retriesBefore(attempt)
+	activityLogger(ctx, a.logger).Info("activity sync users", "page", input.Page, "next_page", result.NextPage, "inserted", result.Summary.Inserted, "skipped", result.Summary.Skipped, "pages", result.Summary.Pages, "has_more", result.HasMore, "attempt", attempt, "reason", input.Reason)
+	return result, nil
 }
 
-// SyncOrdersActivity pulls orders from the builder and stores events.
-func (a *SyncActivities) SyncOrdersActivity(ctx context.Context, input SyncWorkflowInput) (SyncSummary, error) {
-	site, err := a.server.store.GetSite(ctx, input.SiteID)
+// SyncOrdersActivity pulls up to syncPagesPerActivity pages of orders from input.Page on and
+// stores events.
+func (a *SyncActivities) SyncOrdersActivity(ctx context.Context, input SyncWorkflowInput) (PagesBatchResult, error) {
+	site, err := a.loadSite(ctx, input.SiteID, input.BuilderBaseURL)
 	if err != nil {
-		return SyncSummary{}, err
+		return PagesBatchResult{}, err
+	}
+	attempt := activity.GetInfo(ctx).Attempt
+	result, err := a.persister.SyncOrderPages(ctx, site, input.Page, syncPagesPerActivity, input.Start, input.End)
+	if err != nil {
+		activityLogger(ctx, a.logger).Error("activity sync orders failed", "page", input.Page, "error", err, "attempt", attempt, "reason", input.Reason)
+		return result, classifyActivityError(err)
+	}
+	result.Summary.RetriesObserved = retriesBefore(attempt)
+	activityLogger(ctx, a.logger).Info("activity sync orders", "page", input.Page, "next_page", result.NextPage, "inserted", result.Summary.Inserted, "skipped", result.Summary.Skipped, "pages", result.Summary.Pages, "has_more", result.HasMore, "attempt", attempt, "reason", input.Reason)
+	return result, nil
+}
+
+// SyncChangesActivity ingests a bounded number of change-feed batches after input.Since.
+func (a *SyncActivities) SyncChangesActivity(ctx context.Context, input SyncChangesInput) (ChangesBatchResult, error) {
+	site, err := a.loadSite(ctx, input.SiteID, input.BuilderBaseURL)
+	if err != nil {
+		return ChangesBatchResult{}, err
 	}
-	summary, err := a.server.syncSite(ctx, site, input.Page, input.Start, input.End, a.server.fetchOrdersPage)
+	attempt := activity.GetInfo(ctx).Attempt
+	result, err := a.persister.SyncChangesBatch(ctx, site, input.Since, input.MaxPages)
 	if err != nil {
-		a.logger.Error("activity sync orders failed", "site_id", input.SiteID, "error", err, "reason", input.Reason)
-		return summary, err
+		activityLogger(ctx, a.logger).Error("activity sync changes failed", "since", input.Since, "error", err, "attempt", attempt)
+		return result, classifyActivityError(err)
 	}
-	a.logger.Info("activity sync orders", "site_id", input.SiteID, "inserted", summary.Inserted, "skipped", summary.Skipped, "pages", summary.Pages, "reason", input.Reason)
-	return summary, nil
+	result.Summary.RetriesObserved = retriesBefore(attempt)
+	activityLogger(ctx, a.logger).Info("activity sync changes", "since", input.Since, "next_seq", result.NextSeq, "inserted", result.Summary.Inserted, "skipped", result.Summary.Skipped, "has_more", result.HasMore, "attempt", attempt)
+	return result, nil
+}
+
+// GetWatermarkActivity loads the last ingested change seq for a site (0 when none is stored).
+func (a *SyncActivities) GetWatermarkActivity(ctx context.Context, siteID string) (int64, error) {
+	return a.persister.ChangesWatermark(ctx, siteID)
 }
 
-// SyncSiteWorkflow orchestrates users/orders sync sequentially, guaranteeing all I/O flows through Temporal.
+// SaveWatermarkActivity persists the last ingested change seq for a site.
+func (a *SyncActivities) SaveWatermarkActivity(ctx context.Context, siteID string, seq int64) error {
+	return a.persister.SaveChangesWatermark(ctx, siteID, seq)
+}
+
+// SyncSiteWorkflow orchestrates users/orders sync, guaranteeing all I/O flows through Temporal.
+// When both are requested their activities run in parallel until one of them runs out of pages.
+// Each users or orders activity handles a bounded number of pages; while pages remain the
+// workflow continues as new from the next page, carrying the totals so far in input.Progress,
+// so large backfills never outgrow one activity timeout or one run's history. A sync.cancel
+// signal lets the activity in flight finish, then ends the sync with the partial result marked
+// Cancelled.
 func SyncSiteWorkflow(ctx workflow.Context, input SyncWorkflowInput) (SyncWorkflowResult, error) {
 	logger := workflow.GetLogger(ctx)
-	if input.SiteID == "" {
-		return SyncWorkflowResult{}, errors.New("site_id required")
+	if err := input.Validate(); err != nil {
+		return SyncWorkflowResult{}, temporal.NewNonRetryableApplicationError(err.Error(), "InvalidSyncInput", err)
 	}
 	options := workflow.ActivityOptions{
 		StartToCloseTimeout: 5 * time.Minute,
@@ -75,65 +297,340 @@ func SyncSiteWorkflow(ctx workflow.Context, input SyncWorkflowInput) (SyncWorkfl
 			InitialInterval:        time.Second,
 			BackoffCoefficient:     2.0,
 			MaximumInterval:        30 * time.Second,
-			NonRetryableErrorTypes: []string{"InvalidAccessKey", "SiteNotFound"},
+			NonRetryableErrorTypes: []string{ErrTypeInvalidAccessKey, ErrTypeSiteNotFound},
 		},
 	}
 	ctx = workflow.WithActivityOptions(ctx, options)
+	// The users and orders activities heartbeat after every page (see syncSite), so a stuck
+	// builder request is retried well before the start-to-close timeout.
+	pagedCtx := workflow.WithHeartbeatTimeout(ctx, syncHeartbeatTimeout)
+
+	progress := SyncProgress{StartedAt: workflow.Now(ctx), OrdersPage: input.Page}
+	if input.Progress != nil {
+		progress = *input.Progress
+	} else {
+		logger.Info("sync workflow started", "site_id", input.SiteID, "include_users", input.IncludeUsers, "include_orders", input.IncludeOrders, "use_changes", input.UseChanges, "reason", input.Reason)
+		if input.BuilderBaseURL != "" {
+			logger.Warn("sync workflow using builder base URL override", "site_id", input.SiteID, "override_url", input.BuilderBaseURL)
+		}
+	}
+	result := SyncWorkflowResult{StartedAt: progress.StartedAt, Continuations: progress.Continuations}
+
+	live := LiveSyncProgress{Continuations: progress.Continuations}
+	for _, summary := range []*SyncSummary{progress.Users, progress.Orders} {
+		if summary != nil {
+			live.add(*summary)
+		}
+	}
+	if err := workflow.SetQueryHandler(ctx, syncProgressQueryName, func() (LiveSyncProgress, error) {
+		return live, nil
+	}); err != nil {
+		return result, err
+	}
+
+	cancelCh := workflow.GetSignalChannel(ctx, syncCancelSignalName)
+	stopped := false
+	cancelled := func() bool {
+		if !stopped && cancelCh.ReceiveAsync(nil) {
+			stopped = true
+		}
+		return stopped
+	}
+	stop := func() (SyncWorkflowResult, error) {
+		result.Users, result.UsersDuration = progress.Users, progress.UsersDuration
+		result.Orders, result.OrdersDuration = progress.Orders, progress.OrdersDuration
+		result.Cancelled = true
+		result.CompletedAt = workflow.Now(ctx)
+		live.Done = true
+		logger.Info("sync workflow cancelled", "site_id", input.SiteID, "entity", live.Entity, "pages", live.Pages, "continuations", progress.Continuations, "reason", input.Reason)
+		return result, nil
+	}
 
-	result := SyncWorkflowResult{StartedAt: workflow.Now(ctx)}
-	logger.Info("sync workflow started", "site_id", input.SiteID, "include_users", input.IncludeUsers, "include_orders", input.IncludeOrders, "reason", input.Reason)
+	if input.IncludeUsers && input.IncludeOrders && !progress.UsersDone && !progress.OrdersDone {
+		if cancelled() {
+			return stop()
+		}
+		live.Entity = "users+orders"
+		ordersInput := input
+		ordersInput.Page = progress.OrdersPage
+		users, orders, err := syncUsersAndOrders(pagedCtx, input, ordersInput)
+		if users != nil {
+			live.add(users.Summary)
+			progress.Users = mergePagesSummary(progress.Users, users.Summary)
+			progress.UsersDuration += users.Duration
+		}
+		if orders != nil {
+			live.add(orders.Summary)
+			progress.Orders = mergePagesSummary(progress.Orders, orders.Summary)
+			progress.OrdersDuration += orders.Duration
+		}
+		if err != nil {
+			result.Users, result.UsersDuration = progress.Users, progress.UsersDuration
+			result.Orders, result.OrdersDuration = progress.Orders, progress.OrdersDuration
+			return result, err
+		}
+		if cancelled() {
+			return stop()
+		}
+		progress.UsersDone = !users.HasMore
+		progress.OrdersDone = !orders.HasMore
+		switch {
+		case users.HasMore:
+			progress.OrdersPage = orders.NextPage
+			return result, continueSync(ctx, input, progress, users.NextPage)
+		case orders.HasMore:
+			return result, continueSync(ctx, input, progress, orders.NextPage)
+		}
+	}
 
-	if input.IncludeUsers {
-		var summary SyncSummary
-		if err := workflow.ExecuteActivity(ctx, syncUsersActivityName, input).Get(ctx, &summary); err != nil {
+	if input.IncludeUsers && !progress.UsersDone {
+		if cancelled() {
+			return stop()
+		}
+		var batch PagesBatchResult
+		live.Entity = "users"
+		phaseStart := workflow.Now(ctx)
+		if err := workflow.ExecuteActivity(pagedCtx, syncUsersActivityName, input).Get(ctx, &batch); err != nil {
 			logger.Error("users activity failed", "error", err)
 			return result, err
 		}
-		result.Users = &summary
+		live.add(batch.Summary)
+		progress.Users = mergePagesSummary(progress.Users, batch.Summary)
+		progress.UsersDuration += workflow.Now(ctx).Sub(phaseStart)
+		if cancelled() {
+			return stop()
+		}
+		if batch.HasMore {
+			return result, continueSync(ctx, input, progress, batch.NextPage)
+		}
+		progress.UsersDone = true
+		input.Page = progress.OrdersPage
 	}
+	result.Users, result.UsersDuration = progress.Users, progress.UsersDuration
 
-	if input.IncludeOrders {
-		var summary SyncSummary
-		if err := workflow.ExecuteActivity(ctx, syncOrdersActivityName, input).Get(ctx, &summary); err != nil {
+	if input.IncludeOrders && !progress.OrdersDone {
+		if cancelled() {
+			return stop()
+		}
+		var batch PagesBatchResult
+		live.Entity = "orders"
+		phaseStart := workflow.Now(ctx)
+		if err := workflow.ExecuteActivity(pagedCtx, syncOrdersActivityName, input).Get(ctx, &batch); err != nil {
 			logger.Error("orders activity failed", "error", err)
 			return result, err
 		}
-		result.Orders = &summary
+		live.add(batch.Summary)
+		progress.Orders = mergePagesSummary(progress.Orders, batch.Summary)
+		progress.OrdersDuration += workflow.Now(ctx).Sub(phaseStart)
+		if cancelled() {
+			return stop()
+		}
+		if batch.HasMore {
+			return result, continueSync(ctx, input, progress, batch.NextPage)
+		}
+		progress.OrdersDone = true
+	}
+	result.Orders, result.OrdersDuration = progress.Orders, progress.OrdersDuration
+
+	if input.UseChanges {
+		if cancelled() {
+			return stop()
+		}
+		live.Entity = "changes"
+		phaseStart := workflow.Now(ctx)
+		summary, err := syncChangesFromWatermark(ctx, input.SiteID, input.BuilderBaseURL, &live, cancelled)
+		if err != nil {
+			logger.Error("changes sync failed", "error", err)
+			return result, err
+		}
+		result.Changes = &summary
+		result.ChangesDuration = workflow.Now(ctx).Sub(phaseStart)
+		if stopped {
+			return stop()
+		}
 	}
 
 	result.CompletedAt = workflow.Now(ctx)
-	logger.Info("sync workflow finished", "site_id", input.SiteID, "include_users", input.IncludeUsers, "include_orders", input.IncludeOrders, "reason", input.Reason)
+	live.Done = true
+	logger.Info("sync workflow finished", "site_id", input.SiteID, "include_users", input.IncludeUsers, "include_orders", input.IncludeOrders, "use_changes", input.UseChanges, "continuations", progress.Continuations, "reason", input.Reason)
 	return result, nil
 }
 
+// timedBatch is a paged batch together with how long its activity took in workflow time.
+type timedBatch struct {
+	PagesBatchResult
+	Duration time.Duration
+}
+
+// syncUsersAndOrders runs one users and one orders activity concurrently and returns the batch
+// of each that succeeded. A non-retryable failure cancels the other activity; any other failure
+// lets it finish, so pages it persisted are still counted. The first failure is returned.
+func syncUsersAndOrders(ctx workflow.Context, usersInput, ordersInput SyncWorkflowInput) (users, orders *timedBatch, err error) {
+	logger := workflow.GetLogger(ctx)
+	activityCtx, cancel := workflow.WithCancel(ctx)
+	defer cancel()
+	start := workflow.Now(ctx)
+	collect := func(entity string, target **timedBatch) func(workflow.Future) {
+		return func(f workflow.Future) {
+			var batch PagesBatchResult
+			if getErr := f.Get(ctx, &batch); getErr != nil {
+				if err != nil {
+					return
+				}
+				logger.Error(entity+" activity failed", "error", getErr)
+				err = getErr
+				if isNonRetryable(getErr) {
+					cancel()
+				}
+				return
+			}
+			*target = &timedBatch{PagesBatchResult: batch, Duration: workflow.Now(ctx).Sub(start)}
+		}
+	}
+	selector := workflow.NewSelector(ctx)
+	selector.AddFuture(workflow.ExecuteActivity(activityCtx, syncUsersActivityName, usersInput), collect("users", &users))
+	selector.AddFuture(workflow.ExecuteActivity(activityCtx, syncOrdersActivityName, ordersInput), collect("orders", &orders))
+	selector.Select(ctx)
+	selector.Select(ctx)
+	return users, orders, err
+}
+
+// isNonRetryable reports whether err is an application error marked non-retryable, such as the
+// ones classifyActivityError produces.
+func isNonRetryable(err error) bool {
+	var appErr *temporal.ApplicationError
+	return errors.As(err, &appErr) && appErr.NonRetryable()
+}
+
+// continueSync ends the run with a continue-as-new that resumes the active phase at nextPage.
+func continueSync(ctx workflow.Context, input SyncWorkflowInput, progress SyncProgress, nextPage int) error {
+	progress.Continuations++
+	input.Page = nextPage
+	input.Progress = &progress
+	workflow.GetLogger(ctx).Info("sync workflow continuing as new", "site_id", input.SiteID, "users_done", progress.UsersDone, "next_page", nextPage, "continuations", progress.Continuations)
+	return workflow.NewContinueAsNewError(ctx, syncWorkflowName, input)
+}
+
+// mergePagesSummary adds one paged batch to the running total of its phase. Total is the
+// builder's remote count, so the largest value seen is kept rather than summed.
+func mergePagesSummary(total *SyncSummary, batch SyncSummary) *SyncSummary {
+	if total == nil {
+		return &batch
+	}
+	merged := *total
+	merged.Inserted += batch.Inserted
+	merged.Skipped += batch.Skipped
+	merged.Pages += batch.Pages
+	merged.Total = max(merged.Total, batch.Total)
+	merged.FetchDuration += batch.FetchDuration
+	merged.PersistDuration += batch.PersistDuration
+	merged.RetriesObserved += batch.RetriesObserved
+	return &merged
+}
+
+// syncChangesFromWatermark reads the stored seq, then alternates between ingesting a bounded
+// batch of changes and saving the new seq. Every step is an activity, so a crashed or retried
+// workflow resumes from the last saved watermark rather than from scratch. Each batch is also
+// added to live. Once cancelled reports true it stops before the next batch, with the watermark
+// already saved for everything ingested.
+func syncChangesFromWatermark(ctx workflow.Context, siteID, baseURLOverride string, live *LiveSyncProgress, cancelled func() bool) (SyncSummary, error) {
+	var since int64
+	if err := workflow.ExecuteActivity(ctx, getWatermarkActivityName, siteID).Get(ctx, &since); err != nil {
+		return SyncSummary{}, err
+	}
+	summary := SyncSummary{}
+	for {
+		var batch ChangesBatchResult
+		input := SyncChangesInput{SiteID: siteID, Since: since, MaxPages: changesPagesPerActivity, BuilderBaseURL: baseURLOverride}
+		if err := workflow.ExecuteActivity(ctx, syncChangesActivityName, input).Get(ctx, &batch); err != nil {
+			return summary, err
+		}
+		live.add(batch.Summary)
+		summary.Inserted += batch.Summary.Inserted
+		summary.Skipped += batch.Summary.Skipped
+		summary.Pages += batch.Summary.Pages
+		summary.Total += batch.Summary.Total
+		summary.FetchDuration += batch.Summary.FetchDuration
+		summary.PersistDuration += batch.Summary.PersistDuration
+		summary.RetriesObserved += batch.Summary.RetriesObserved
+		if batch.NextSeq > since {
+			if err := workflow.ExecuteActivity(ctx, saveWatermarkActivityName, siteID, batch.NextSeq).Get(ctx, nil); err != nil {
+				return summary, err
+			}
+			since = batch.NextSeq
+		}
+		if !batch.HasMore || cancelled() {
+			return summary, nil
+		}
+	}
+}
+
+// SyncWorkerOption customises RegisterSyncWorker.
+type SyncWorkerOption func(*syncWorkerOptions)
+
+type syncWorkerOptions struct {
+	metrics *metrics.Registry
+}
+
+// WithTemporalMetrics records activity and workflow executions in reg through a
+// TemporalMetricsInterceptor. Without it the worker records no Temporal metrics.
+func WithTemporalMetrics(reg *metrics.Registry) SyncWorkerOption {
+	return func(o *syncWorkerOptions) {
+		o.metrics = reg
+	}
+}
+
 // RegisterSyncWorker wires up the Temporal worker consuming the sync task queue.
-func RegisterSyncWorker(c client.Client, srv *Server, logger *slog.Logger) temporalworker.Worker {
-	w := temporalworker.New(c, syncTaskQueue, temporalworker.Options{})
+func RegisterSyncWorker(c client.Client, srv *Server, logger *slog.Logger, opts ...SyncWorkerOption) temporalworker.Worker {
+	var options syncWorkerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	interceptors := []interceptor.WorkerInterceptor{NewSiteLoggingInterceptor()}
+	if options.metrics != nil {
+		interceptors = append(interceptors, NewTemporalMetricsInterceptor(options.metrics))
+	}
+	w := temporalworker.New(c, syncTaskQueue, temporalworker.Options{
+		Interceptors: interceptors,
+	})
 	w.RegisterWorkflowWithOptions(SyncSiteWorkflow, workflow.RegisterOptions{Name: syncWorkflowName})
 	activities := NewSyncActivities(srv, logger.With("component", "sync.activities"))
 	w.RegisterActivityWithOptions(activities.SyncUsersActivity, activity.RegisterOptions{Name: syncUsersActivityName})
 	w.RegisterActivityWithOptions(activities.SyncOrdersActivity, activity.RegisterOptions{Name: syncOrdersActivityName})
+	w.RegisterActivityWithOptions(activities.SyncChangesActivity, activity.RegisterOptions{Name: syncChangesActivityName})
+	w.RegisterActivityWithOptions(activities.GetWatermarkActivity, activity.RegisterOptions{Name: getWatermarkActivityName})
+	w.RegisterActivityWithOptions(activities.SaveWatermarkActivity, activity.RegisterOptions{Name: saveWatermarkActivityName})
 	return w
 }
 
 // TemporalOrchestrator starts workflows through the Temporal client so every sync flows through the same pipeline.
 type TemporalOrchestrator struct {
 	client client.Client
+	runs   *Store
 	logger *slog.Logger
 }
 
-func NewTemporalOrchestrator(c client.Client, logger *slog.Logger) *TemporalOrchestrator {
-	return &TemporalOrchestrator{client: c, logger: logger.With("component", "sync.orchestrator")}
+// OrchestratorOption customises optional TemporalOrchestrator collaborators.
+type OrchestratorOption func(*TemporalOrchestrator)
+
+// WithSyncRunStore records every finished workflow in the store's sync_runs history.
+func WithSyncRunStore(store *Store) OrchestratorOption {
+	return func(o *TemporalOrchestrator) {
+		o.runs = store
+	}
 }
 
-func (o *TemporalOrchestrator) RunSync(ctx context.Context, input SyncWorkflowInput) (SyncWorkflowResult, error) {
-	workflowID := fmt.Sprintf("sync-%s-%d", input.SiteID, time.Now().UnixNano())
-	options := client.StartWorkflowOptions{
-		ID:                       workflowID,
-		TaskQueue:                syncTaskQueue,
-		WorkflowIDReusePolicy:    enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE,
-		WorkflowExecutionTimeout: 30 * time.Minute,
+func NewTemporalOrchestrator(c client.Client, logger *slog.Logger, opts ...OrchestratorOption) *TemporalOrchestrator {
+	o := &TemporalOrchestrator{client: c, logger: logger.With("component", "sync.orchestrator")}
+	for _, opt := range opts {
+		opt(o)
 	}
+	return o
+}
+
+func (o *TemporalOrchestrator) RunSync(ctx context.Context, input SyncWorkflowInput) (SyncWorkflowResult, error) {
+	options := syncWorkflowOptions(input)
+	startedAt := time.Now().UTC()
 	we, err := o.client.ExecuteWorkflow(ctx, options, SyncSiteWorkflow, input)
 	if err != nil {
 		o.logger.Error("start workflow failed", "site_id", input.SiteID, "error", err)
@@ -144,31 +641,105 @@ func (o *TemporalOrchestrator) RunSync(ctx context.Context, input SyncWorkflowIn
 		o.logger.Error("wait workflow failed", "workflow_id", we.GetID(), "error", err)
 		result.WorkflowID = we.GetID()
 		result.RunID = we.GetRunID()
+		o.recordRun(ctx, input, result, startedAt, err)
 		return result, err
 	}
 	result.WorkflowID = we.GetID()
 	result.RunID = we.GetRunID()
 	o.logger.Info("workflow completed", "workflow_id", result.WorkflowID, "run_id", result.RunID, "site_id", input.SiteID, "include_users", input.IncludeUsers, "include_orders", input.IncludeOrders)
+	o.recordRun(ctx, input, result, startedAt, nil)
 	return result, nil
 }
 
 func (o *TemporalOrchestrator) RunSyncAsync(ctx context.Context, input SyncWorkflowInput) (string, error) {
-	workflowID := fmt.Sprintf("sync-%s-%d", input.SiteID, time.Now().UnixNano())
-	options := client.StartWorkflowOptions{
-		ID:                       workflowID,
-		TaskQueue:                syncTaskQueue,
-		WorkflowIDReusePolicy:    enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE,
-		WorkflowExecutionTimeout: 30 * time.Minute,
-	}
+	options := syncWorkflowOptions(input)
+	startedAt := time.Now().UTC()
 	we, err := o.client.ExecuteWorkflow(ctx, options, SyncSiteWorkflow, input)
 	if err != nil {
 		o.logger.Error("start workflow async failed", "site_id", input.SiteID, "error", err)
 		return "", err
 	}
 	o.logger.Info("workflow dispatched", "workflow_id", we.GetID(), "run_id", we.GetRunID(), "site_id", input.SiteID)
+	if o.runs != nil {
+		// Nobody waits on async runs, so wait in the background purely to record the outcome.
+		go func(ctx context.Context) {
+			var result SyncWorkflowResult
+			err := we.Get(ctx, &result)
+			result.WorkflowID = we.GetID()
+			result.RunID = we.GetRunID()
+			o.recordRun(ctx, input, result, startedAt, err)
+		}(context.WithoutCancel(ctx))
+	}
 	return we.GetID(), nil
 }
 
+// QuerySyncProgress asks a running sync workflow how far it has got. An empty runID queries the
+// latest run, which follows the sync across continue-as-new.
+func (o *TemporalOrchestrator) QuerySyncProgress(ctx context.Context, workflowID, runID string) (LiveSyncProgress, error) {
+	value, err := o.client.QueryWorkflow(ctx, workflowID, runID, syncProgressQueryName)
+	if err != nil {
+		return LiveSyncProgress{}, err
+	}
+	var progress LiveSyncProgress
+	if err := value.Get(&progress); err != nil {
+		return LiveSyncProgress{}, fmt.Errorf("decode sync progress: %w", err)
+	}
+	return progress, nil
+}
+
+// CancelSync signals a running sync workflow to stop before its next activity. The sync then
+// completes normally with a partial result marked Cancelled.
+func (o *TemporalOrchestrator) CancelSync(ctx context.Context, workflowID string) error {
+	err := o.client.SignalWorkflow(ctx, workflowID, "", syncCancelSignalName, nil)
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
+		}
+		return fmt.Errorf("cancel sync: %w", err)
+	}
+	o.logger.Info("sync cancel requested", "workflow_id", workflowID)
+	return nil
+}
+
+// recordRun stores a finished workflow in sync_runs. Failures are logged, never returned, so
+// history bookkeeping cannot fail a sync.
+func (o *TemporalOrchestrator) recordRun(ctx context.Context, input SyncWorkflowInput, result SyncWorkflowResult, startedAt time.Time, runErr error) {
+	if o.runs == nil {
+		return
+	}
+	// The builder URL override applies to this run only and is not kept in the history.
+	input.BuilderBaseURL = ""
+	run := SyncRun{
+		WorkflowID:  result.WorkflowID,
+		RunID:       result.RunID,
+		SiteID:      input.SiteID,
+		Reason:      input.Reason,
+		Input:       input,
+		Status:      SyncRunStatusSuccess,
+		StartedAt:   startedAt,
+		CompletedAt: time.Now().UTC(),
+	}
+	for _, summary := range []*SyncSummary{result.Users, result.Orders, result.Changes} {
+		if summary == nil {
+			continue
+		}
+		run.Inserted += summary.Inserted
+		run.Skipped += summary.Skipped
+		run.Pages += summary.Pages
+	}
+	if result.Cancelled {
+		run.Status = SyncRunStatusCancelled
+	}
+	if runErr != nil {
+		run.Status = SyncRunStatusFailed
+		run.Error = runErr.Error()
+	}
+	if _, err := o.runs.RecordSyncRun(context.WithoutCancel(ctx), run); err != nil {
+		o.logger.Error("record sync run failed", "workflow_id", run.WorkflowID, "site_id", run.SiteID, "error", err)
+	}
+}
+
 // SyncTaskQueue exposes the queue name so callers can reference it in metrics/tests.
 func SyncTaskQueue() string {
 	return syncTaskQueue
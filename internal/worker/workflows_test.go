@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/client"
+)
+
+func TestRecordRunDropsBuilderBaseURLOverride(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	o := &TemporalOrchestrator{runs: store, logger: discardLogger()}
+	input := SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, Reason: "api-sync", BuilderBaseURL: "http://staging-builder"}
+	o.recordRun(ctx, input, SyncWorkflowResult{WorkflowID: "sync-s1", RunID: "r1"}, time.Now().UTC(), nil)
+
+	page, err := store.ListSyncRuns(ctx, SyncRunFilter{SiteID: "s1"})
+	if err != nil {
+		t.Fatalf("list sync runs: %v", err)
+	}
+	if len(page.Runs) != 1 {
+		t.Fatalf("recorded %d runs, want 1", len(page.Runs))
+	}
+	if got := page.Runs[0].Input.BuilderBaseURL; got != "" {
+		t.Fatalf("persisted builder_base_url = %q, want it dropped", got)
+	}
+}
+
+func TestReplaySyncRunDropsBuilderBaseURLOverride(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	// A run recorded before the override was stripped.
+	id, err := store.RecordSyncRun(ctx, SyncRun{
+		WorkflowID: "sync-s1", RunID: "r1", SiteID: "s1", Reason: "api-sync", Status: SyncRunStatusSuccess,
+		Input:     SyncWorkflowInput{SiteID: "s1", IncludeUsers: true, Reason: "api-sync", BuilderBaseURL: "http://staging-builder"},
+		StartedAt: time.Now().UTC(), CompletedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("record sync run: %v", err)
+	}
+	orch := &fakeOrchestrator{}
+	h := NewServer(store, NewBuilderClient(), orch, discardLogger()).Router()
+
+	rec := serve(t, h, http.MethodPost, "/worker/sync-runs/"+strconv.FormatInt(id, 10)+"/replay", "", nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("replay: status %d, body %s", rec.Code, rec.Body)
+	}
+	if len(orch.started) != 1 {
+		t.Fatalf("started %d workflows, want 1", len(orch.started))
+	}
+	if got := orch.started[0]; got.BuilderBaseURL != "" || got.ReplayOf != id {
+		t.Fatalf("replayed input = %+v, want no builder_base_url and replay_of %d", got, id)
+	}
+}
+
+func TestSyncStartOptionsCarrySiteIDSearchAttribute(t *testing.T) {
+	for name, opts := range map[string]client.StartWorkflowOptions{
+		"one-off": syncWorkflowOptions(SyncWorkflowInput{SiteID: "s1"}),
+		"cron":    cronSyncOptions("s1", DefaultAutoSyncCron),
+	} {
+		got, ok := opts.TypedSearchAttributes.GetKeyword(siteIDSearchAttributeKey)
+		if !ok || got != "s1" {
+			t.Errorf("%s: %s search attribute = %q (set %v), want s1", name, SiteIDSearchAttribute, got, ok)
+		}
+	}
+}